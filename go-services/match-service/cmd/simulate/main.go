@@ -0,0 +1,140 @@
+// Command simulate plays bot matches through the match service's rules engine
+// and reports on game balance: seat win rates, match lengths, comebacks and how
+// much each ability moves the win rate.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+
+	"match-service/internal/engine"
+)
+
+// Simulation output formats
+const (
+	simulationFormatText = "text"
+	simulationFormatJSON = "json"
+	simulationFormatCSV  = "csv"
+)
+
+// randomLoadouts is the -loadouts value that equips every seat at random each match
+const randomLoadouts = "random"
+
+// simulationConfig is what a balance simulation plays and how it is run
+type simulationConfig struct {
+	engine.SimulationConfig
+	Matches int
+	Workers int
+	// ComebackMargin is how far behind a winner must have been for a comeback
+	ComebackMargin int
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+// run runs the balance simulator from the command line and returns the exit code
+func run(args []string) int {
+	flags := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: simulate [flags]")
+		fmt.Fprintln(flags.Output(), "Plays bot matches through the rules engine and reports on game balance.")
+		flags.PrintDefaults()
+	}
+	mode := flags.String("mode", models.GameModeClassic, "game mode to play")
+	settings := flags.String("settings", "", "mode settings as a JSON object, as a match would be created with")
+	bots := flags.String("bots", "medium,medium", "comma separated bot difficulty of each seat")
+	loadouts := flags.String("loadouts", "", `semicolon separated abilities of each seat, comma separated; "none" for no abilities, empty for the difficulty's, or "random"`)
+	matches := flags.Int("matches", 10000, "number of matches to play")
+	workers := flags.Int("workers", runtime.NumCPU(), "matches played in parallel")
+	seed := flags.Int64("seed", 0, "seed for repeatable runs, 0 for fresh seeds")
+	comeback := flags.Int("comeback", 20, "points a winner must have trailed by to count as a comeback")
+	format := flags.String("format", simulationFormatText, "output format: text, json or csv")
+	out := flags.String("out", "", "file to write the report to, stdout when empty")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	config, err := parseSimulationConfig(*mode, *settings, *bots, *loadouts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "simulate:", err)
+		return 2
+	}
+	config.Matches = *matches
+	config.Workers = *workers
+	config.Seed = *seed
+	config.ComebackMargin = *comeback
+
+	write, err := simulationWriter(*format)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "simulate:", err)
+		return 2
+	}
+
+	report, err := simulate(config, os.Stderr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "simulate:", err)
+		return 1
+	}
+
+	output := io.Writer(os.Stdout)
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "simulate:", err)
+			return 1
+		}
+		defer file.Close()
+		output = file
+	}
+	if err := write(output, report); err != nil {
+		fmt.Fprintln(os.Stderr, "simulate: failed to write report:", err)
+		return 1
+	}
+	return 0
+}
+
+// parseSimulationConfig reads the match setup flags
+func parseSimulationConfig(mode, settings, bots, loadouts string) (*simulationConfig, error) {
+	config := &simulationConfig{SimulationConfig: engine.SimulationConfig{Mode: mode}}
+	if settings != "" {
+		if err := json.Unmarshal([]byte(settings), &config.Settings); err != nil {
+			return nil, fmt.Errorf("invalid settings: %w", err)
+		}
+	}
+
+	for _, difficulty := range strings.Split(bots, ",") {
+		config.Bots = append(config.Bots, strings.TrimSpace(difficulty))
+	}
+
+	switch loadouts = strings.TrimSpace(loadouts); loadouts {
+	case "":
+	case randomLoadouts:
+		config.RandomLoadouts = true
+	default:
+		seats := strings.Split(loadouts, ";")
+		if len(seats) > len(config.Bots) {
+			return nil, fmt.Errorf("%d loadouts given for %d seats", len(seats), len(config.Bots))
+		}
+		config.Loadouts = make([][]string, len(config.Bots))
+		for i, seat := range seats {
+			switch seat = strings.TrimSpace(seat); seat {
+			case "":
+			case "none":
+				config.Loadouts[i] = make([]string, 0)
+			default:
+				for _, abilityID := range strings.Split(seat, ",") {
+					config.Loadouts[i] = append(config.Loadouts[i], strings.TrimSpace(abilityID))
+				}
+			}
+		}
+	}
+	return config, nil
+}
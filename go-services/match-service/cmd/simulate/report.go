@@ -0,0 +1,277 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"match-service/internal/engine"
+)
+
+// simulationReport is the balance report of a simulation run
+type simulationReport struct {
+	Mode         string                 `json:"mode"`
+	Settings     map[string]interface{} `json:"settings,omitempty"`
+	Matches      int                    `json:"matches"`
+	Failed       int                    `json:"failed"`
+	Draws        int                    `json:"draws"`
+	DrawRate     float64                `json:"drawRate"`
+	Seats        []seatReport           `json:"seats"`
+	Turns        lengthReport           `json:"turns"`
+	AverageRolls float64                `json:"averageRolls"`
+	Comebacks    int                    `json:"comebacks"`
+	// ComebackRate is the share of decided matches won by a player who trailed
+	// by at least ComebackMargin points
+	ComebackRate   float64         `json:"comebackRate"`
+	ComebackMargin int             `json:"comebackMargin"`
+	Abilities      []abilityReport `json:"abilities"`
+	ElapsedSeconds float64         `json:"elapsedSeconds"`
+}
+
+// seatReport is how one seat did
+type seatReport struct {
+	Seat       int      `json:"seat"`
+	Difficulty string   `json:"difficulty"`
+	Loadout    []string `json:"loadout,omitempty"`
+	Wins       int      `json:"wins"`
+	WinRate    float64  `json:"winRate"`
+}
+
+// lengthReport is the distribution of match lengths, in turns
+type lengthReport struct {
+	Mean      float64        `json:"mean"`
+	Min       int            `json:"min"`
+	P10       int            `json:"p10"`
+	P50       int            `json:"p50"`
+	P90       int            `json:"p90"`
+	P99       int            `json:"p99"`
+	Max       int            `json:"max"`
+	Histogram []lengthBucket `json:"histogram"`
+}
+
+// lengthBucket counts the matches that lasted a number of turns
+type lengthBucket struct {
+	Turns   int `json:"turns"`
+	Matches int `json:"matches"`
+}
+
+// abilityReport is how an ability did, counted per seat and match. Impact is
+// the win rate with the ability equipped less the win rate without it.
+type abilityReport struct {
+	Ability         string  `json:"ability"`
+	Equipped        int     `json:"equipped"`
+	Used            int     `json:"used"`
+	UsesPerMatch    float64 `json:"usesPerMatch"`
+	WinRateEquipped float64 `json:"winRateEquipped"`
+	WinRateUsed     float64 `json:"winRateUsed"`
+	WinRateWithout  float64 `json:"winRateWithout"`
+	Impact          float64 `json:"impact"`
+}
+
+// ratio divides, counting nothing out of nothing as 0
+func ratio(n, of int) float64 {
+	if of == 0 {
+		return 0
+	}
+	return float64(n) / float64(of)
+}
+
+func newSimulationReport(config *simulationConfig, tally *simulationTally, elapsed time.Duration) *simulationReport {
+	report := &simulationReport{
+		Mode:           config.Mode,
+		Settings:       config.Settings,
+		Matches:        tally.matches,
+		Failed:         tally.failed,
+		Draws:          tally.draws,
+		DrawRate:       ratio(tally.draws, tally.matches),
+		AverageRolls:   ratio(tally.rolls, tally.matches),
+		Comebacks:      tally.comebacks,
+		ComebackRate:   ratio(tally.comebacks, tally.decided),
+		ComebackMargin: config.ComebackMargin,
+		Abilities:      make([]abilityReport, 0, len(tally.abilities)),
+		ElapsedSeconds: elapsed.Seconds(),
+	}
+
+	for seat, difficulty := range config.Bots {
+		seatReport := seatReport{
+			Seat:       seat + 1,
+			Difficulty: difficulty,
+			Wins:       tally.wins[seat],
+			WinRate:    ratio(tally.wins[seat], tally.matches),
+		}
+		if seat < len(config.Loadouts) {
+			seatReport.Loadout = config.Loadouts[seat]
+		}
+		if loadout, ok := engine.BotLoadout(difficulty); ok && seatReport.Loadout == nil && !config.RandomLoadouts {
+			seatReport.Loadout = loadout
+		}
+		report.Seats = append(report.Seats, seatReport)
+	}
+
+	lengths := make([]int, 0, len(tally.turns))
+	for turns := range tally.turns {
+		lengths = append(lengths, turns)
+	}
+	sort.Ints(lengths)
+	percentile := func(p float64) int {
+		counted := 0
+		for _, turns := range lengths {
+			counted += tally.turns[turns]
+			if float64(counted) >= p*float64(tally.matches) {
+				return turns
+			}
+		}
+		return lengths[len(lengths)-1]
+	}
+	total := 0
+	for _, turns := range lengths {
+		total += turns * tally.turns[turns]
+		report.Turns.Histogram = append(report.Turns.Histogram, lengthBucket{Turns: turns, Matches: tally.turns[turns]})
+	}
+	if len(lengths) > 0 {
+		report.Turns.Mean = ratio(total, tally.matches)
+		report.Turns.Min = lengths[0]
+		report.Turns.P10 = percentile(0.1)
+		report.Turns.P50 = percentile(0.5)
+		report.Turns.P90 = percentile(0.9)
+		report.Turns.P99 = percentile(0.99)
+		report.Turns.Max = lengths[len(lengths)-1]
+	}
+
+	seatMatches := tally.matches * len(config.Bots)
+	seatWins := tally.decided
+	for abilityID, ability := range tally.abilities {
+		without := seatMatches - ability.equipped
+		withoutWins := seatWins - ability.equippedWins
+		abilityReport := abilityReport{
+			Ability:         abilityID,
+			Equipped:        ability.equipped,
+			Used:            ability.used,
+			UsesPerMatch:    ratio(ability.uses, ability.equipped),
+			WinRateEquipped: ratio(ability.equippedWins, ability.equipped),
+			WinRateUsed:     ratio(ability.usedWins, ability.used),
+			WinRateWithout:  ratio(withoutWins, without),
+		}
+		if without > 0 {
+			abilityReport.Impact = abilityReport.WinRateEquipped - abilityReport.WinRateWithout
+		}
+		report.Abilities = append(report.Abilities, abilityReport)
+	}
+	sort.Slice(report.Abilities, func(i, j int) bool {
+		return report.Abilities[i].Ability < report.Abilities[j].Ability
+	})
+	return report
+}
+
+// simulationWriter returns the writer for a report format
+func simulationWriter(format string) (func(io.Writer, *simulationReport) error, error) {
+	switch format {
+	case simulationFormatText:
+		return writeSimulationText, nil
+	case simulationFormatJSON:
+		return writeSimulationJSON, nil
+	case simulationFormatCSV:
+		return writeSimulationCSV, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// writeSimulationJSON writes the report as JSON
+func writeSimulationJSON(w io.Writer, report *simulationReport) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// writeSimulationCSV writes the report as metric, subject, value rows, which
+// load straight into a spreadsheet or dataframe
+func writeSimulationCSV(w io.Writer, report *simulationReport) error {
+	writer := csv.NewWriter(w)
+	row := func(metric, subject string, value interface{}) {
+		writer.Write([]string{metric, subject, fmt.Sprint(value)})
+	}
+	float := func(value float64) string {
+		return strconv.FormatFloat(value, 'f', 6, 64)
+	}
+
+	row("metric", "subject", "value")
+	row("matches", report.Mode, report.Matches)
+	row("failed", report.Mode, report.Failed)
+	row("draw_rate", report.Mode, float(report.DrawRate))
+	for _, seat := range report.Seats {
+		subject := fmt.Sprintf("seat%d", seat.Seat)
+		row("difficulty", subject, seat.Difficulty)
+		row("wins", subject, seat.Wins)
+		row("win_rate", subject, float(seat.WinRate))
+	}
+	row("turns_mean", report.Mode, float(report.Turns.Mean))
+	row("turns_p10", report.Mode, report.Turns.P10)
+	row("turns_p50", report.Mode, report.Turns.P50)
+	row("turns_p90", report.Mode, report.Turns.P90)
+	row("turns_p99", report.Mode, report.Turns.P99)
+	row("turns_max", report.Mode, report.Turns.Max)
+	for _, bucket := range report.Turns.Histogram {
+		row("turns_histogram", strconv.Itoa(bucket.Turns), bucket.Matches)
+	}
+	row("rolls_mean", report.Mode, float(report.AverageRolls))
+	row("comeback_rate", report.Mode, float(report.ComebackRate))
+	for _, ability := range report.Abilities {
+		row("ability_equipped", ability.Ability, ability.Equipped)
+		row("ability_uses_per_match", ability.Ability, float(ability.UsesPerMatch))
+		row("ability_win_rate_equipped", ability.Ability, float(ability.WinRateEquipped))
+		row("ability_win_rate_used", ability.Ability, float(ability.WinRateUsed))
+		row("ability_win_rate_without", ability.Ability, float(ability.WinRateWithout))
+		row("ability_impact", ability.Ability, float(ability.Impact))
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeSimulationText writes the report as readable tables
+func writeSimulationText(w io.Writer, report *simulationReport) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s: %d matches in %.1fs", report.Mode, report.Matches, report.ElapsedSeconds)
+	if report.Failed > 0 {
+		fmt.Fprintf(tw, " (%d failed)", report.Failed)
+	}
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw)
+
+	fmt.Fprintln(tw, "seat\tdifficulty\tloadout\twins\twin rate")
+	for _, seat := range report.Seats {
+		loadout := strings.Join(seat.Loadout, ",")
+		if loadout == "" {
+			loadout = "-"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%.2f%%\n", seat.Seat, seat.Difficulty, loadout, seat.Wins, 100*seat.WinRate)
+	}
+	fmt.Fprintf(tw, "draws\t\t\t%d\t%.2f%%\n", report.Draws, 100*report.DrawRate)
+	fmt.Fprintln(tw)
+
+	fmt.Fprintf(tw, "turns\tmean %.1f\tp10 %d\tp50 %d\tp90 %d\tp99 %d\tmax %d\n", report.Turns.Mean,
+		report.Turns.P10, report.Turns.P50, report.Turns.P90, report.Turns.P99, report.Turns.Max)
+	fmt.Fprintf(tw, "rolls\tmean %.1f\n", report.AverageRolls)
+	fmt.Fprintf(tw, "comebacks\t%.2f%% of decided matches won from %d or more behind\n", 100*report.ComebackRate, report.ComebackMargin)
+
+	if len(report.Abilities) > 0 {
+		fmt.Fprintln(tw)
+		fmt.Fprintln(tw, "ability\tequipped\tuses/match\twin rate equipped\twin rate used\twin rate without\timpact")
+		for _, ability := range report.Abilities {
+			impact := "-"
+			if ability.Equipped < report.Matches*len(report.Seats) {
+				impact = fmt.Sprintf("%+.2f%%", 100*ability.Impact)
+			}
+			fmt.Fprintf(tw, "%s\t%d\t%.2f\t%.2f%%\t%.2f%%\t%.2f%%\t%s\n", ability.Ability, ability.Equipped, ability.UsesPerMatch,
+				100*ability.WinRateEquipped, 100*ability.WinRateUsed, 100*ability.WinRateWithout, impact)
+		}
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+
+	"match-service/internal/engine"
+)
+
+// playedMatch is a finished two seat match, as a simulation would return it
+type playedMatch struct {
+	winner   string
+	loadouts map[string][]string
+	uses     map[string]map[string]int
+	deficits map[string]int
+}
+
+// newReport tallies finished matches and reports on them
+func newReport(config *simulationConfig, matches []playedMatch) *simulationReport {
+	tally := newSimulationTally(len(config.Bots))
+	for _, played := range matches {
+		state := &models.MatchState{
+			Players:     []string{"seat1", "seat2"},
+			PlayerData:  make(map[string]models.MatchPlayer),
+			Winner:      played.winner,
+			TurnNumber:  10,
+			AbilityUses: played.uses,
+		}
+		for playerID, abilityIDs := range played.loadouts {
+			state.PlayerData[playerID] = models.MatchPlayer{UserID: playerID, Loadout: models.Loadout{Abilities: abilityIDs}}
+		}
+		tally.add(&engine.SimulatedMatch{State: state, Deficits: played.deficits}, config.ComebackMargin)
+	}
+	return newSimulationReport(config, tally, 0)
+}
+
+// newTestConfig is a two seat setup with the given loadouts
+func newTestConfig(loadouts ...[]string) *simulationConfig {
+	return &simulationConfig{
+		SimulationConfig: engine.SimulationConfig{
+			Mode:     models.GameModeClassic,
+			Bots:     []string{"medium", "medium"},
+			Loadouts: loadouts,
+		},
+		ComebackMargin: 20,
+	}
+}
+
+// assertRate compares a reported rate
+func assertRate(t *testing.T, name string, got, want float64) {
+	t.Helper()
+	if math.Abs(got-want) > 1e-9 {
+		t.Errorf("%s = %v, want %v", name, got, want)
+	}
+}
+
+func TestSeatWinRate(t *testing.T) {
+	report := newReport(newTestConfig(), []playedMatch{
+		{winner: "seat1"},
+		{winner: "seat1"},
+		{winner: "seat2"},
+		{},
+	})
+
+	if report.Matches != 4 || report.Draws != 1 {
+		t.Fatalf("report has %d matches and %d draws, want 4 and 1", report.Matches, report.Draws)
+	}
+	if len(report.Seats) != 2 {
+		t.Fatalf("report has %d seats, want 2", len(report.Seats))
+	}
+	if report.Seats[0].Wins != 2 || report.Seats[1].Wins != 1 {
+		t.Errorf("seat wins = %d and %d, want 2 and 1", report.Seats[0].Wins, report.Seats[1].Wins)
+	}
+	assertRate(t, "seat 1 win rate", report.Seats[0].WinRate, 0.5)
+	assertRate(t, "seat 2 win rate", report.Seats[1].WinRate, 0.25)
+	assertRate(t, "draw rate", report.DrawRate, 0.25)
+}
+
+func TestComebackRate(t *testing.T) {
+	report := newReport(newTestConfig(), []playedMatch{
+		// Trailed by the margin
+		{winner: "seat1", deficits: map[string]int{"seat1": 20, "seat2": 5}},
+		// Trailed, but not by enough
+		{winner: "seat2", deficits: map[string]int{"seat1": 30, "seat2": 19}},
+		// Led throughout
+		{winner: "seat2", deficits: map[string]int{"seat1": 40}},
+		// The loser's deficit is no comeback for the winner
+		{winner: "seat1", deficits: map[string]int{"seat2": 50}},
+		// Draws are left out of the rate
+		{deficits: map[string]int{"seat1": 25, "seat2": 25}},
+	})
+
+	if report.Comebacks != 1 {
+		t.Errorf("comebacks = %d, want 1", report.Comebacks)
+	}
+	assertRate(t, "comeback rate", report.ComebackRate, 0.25)
+}
+
+func TestAbilityImpact(t *testing.T) {
+	report := newReport(newTestConfig([]string{"luck_turner"}, []string{"luck_turner", "pan_slap"}), []playedMatch{
+		{
+			winner:   "seat2",
+			loadouts: map[string][]string{"seat1": {"luck_turner"}, "seat2": {"luck_turner", "pan_slap"}},
+			uses:     map[string]map[string]int{"seat2": {"pan_slap": 2}},
+		},
+		{
+			winner:   "seat2",
+			loadouts: map[string][]string{"seat1": {"luck_turner"}, "seat2": {"luck_turner", "pan_slap"}},
+			uses:     map[string]map[string]int{"seat1": {"luck_turner": 1}, "seat2": {"pan_slap": 1}},
+		},
+		{
+			winner:   "seat1",
+			loadouts: map[string][]string{"seat1": {"luck_turner"}, "seat2": {"luck_turner", "pan_slap"}},
+		},
+		{
+			loadouts: map[string][]string{"seat1": {"luck_turner"}, "seat2": {"luck_turner", "pan_slap"}},
+			uses:     map[string]map[string]int{"seat2": {"pan_slap": 1}},
+		},
+	})
+
+	abilities := make(map[string]abilityReport)
+	for _, ability := range report.Abilities {
+		abilities[ability.Ability] = ability
+	}
+	if len(abilities) != 2 {
+		t.Fatalf("report has %d abilities, want 2", len(abilities))
+	}
+
+	// Equipped by one seat in every match: won 2 of 4 equipped, and 1 of the
+	// 4 seat matches without it
+	panSlap := abilities["pan_slap"]
+	if panSlap.Equipped != 4 || panSlap.Used != 3 {
+		t.Errorf("pan_slap equipped %d and used %d times, want 4 and 3", panSlap.Equipped, panSlap.Used)
+	}
+	assertRate(t, "pan_slap uses per match", panSlap.UsesPerMatch, 1)
+	assertRate(t, "pan_slap win rate equipped", panSlap.WinRateEquipped, 0.5)
+	assertRate(t, "pan_slap win rate used", panSlap.WinRateUsed, 2.0/3)
+	assertRate(t, "pan_slap win rate without", panSlap.WinRateWithout, 0.25)
+	assertRate(t, "pan_slap impact", panSlap.Impact, 0.25)
+
+	// Equipped by every seat, so there is nothing to compare against
+	luckTurner := abilities["luck_turner"]
+	if luckTurner.Equipped != 8 || luckTurner.Used != 1 {
+		t.Errorf("luck_turner equipped %d and used %d times, want 8 and 1", luckTurner.Equipped, luckTurner.Used)
+	}
+	assertRate(t, "luck_turner win rate equipped", luckTurner.WinRateEquipped, 3.0/8)
+	assertRate(t, "luck_turner impact", luckTurner.Impact, 0)
+}
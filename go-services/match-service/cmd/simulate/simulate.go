@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"match-service/internal/engine"
+)
+
+// simulationProgressEvery is how often progress is reported on stderr
+const simulationProgressEvery = 10 * time.Second
+
+// simulationTally accumulates the results of simulated matches
+type simulationTally struct {
+	matches int
+	failed  int
+	draws   int
+	wins    []int
+	// turns counts matches by the number of turns they lasted
+	turns     map[int]int
+	rolls     int
+	decided   int
+	comebacks int
+	abilities map[string]*abilityTally
+}
+
+// abilityTally accumulates how an ability did, counted per seat and match
+type abilityTally struct {
+	equipped     int
+	equippedWins int
+	used         int
+	usedWins     int
+	uses         int
+}
+
+func newSimulationTally(seats int) *simulationTally {
+	return &simulationTally{
+		wins:      make([]int, seats),
+		turns:     make(map[int]int),
+		abilities: make(map[string]*abilityTally),
+	}
+}
+
+// add counts one match
+func (t *simulationTally) add(match *engine.SimulatedMatch, comebackMargin int) {
+	state := match.State
+	t.matches++
+	t.turns[state.TurnNumber]++
+	for _, event := range state.ActionHistory {
+		if event.Type == "roll_dice" {
+			t.rolls++
+		}
+	}
+
+	if state.Winner == "" {
+		t.draws++
+	} else {
+		t.decided++
+		if match.Deficits[state.Winner] >= comebackMargin {
+			t.comebacks++
+		}
+	}
+
+	for seat, playerID := range state.Players {
+		won := state.Winner == playerID
+		if won {
+			t.wins[seat]++
+		}
+		for _, abilityID := range state.PlayerData[playerID].Loadout.Abilities {
+			ability := t.ability(abilityID)
+			uses := state.AbilityUses[playerID][abilityID]
+			ability.equipped++
+			ability.uses += uses
+			if won {
+				ability.equippedWins++
+			}
+			if uses > 0 {
+				ability.used++
+				if won {
+					ability.usedWins++
+				}
+			}
+		}
+	}
+}
+
+// ability returns the tally of an ability, starting one when needed
+func (t *simulationTally) ability(abilityID string) *abilityTally {
+	ability, ok := t.abilities[abilityID]
+	if !ok {
+		ability = &abilityTally{}
+		t.abilities[abilityID] = ability
+	}
+	return ability
+}
+
+// merge adds another tally into this one
+func (t *simulationTally) merge(other *simulationTally) {
+	t.matches += other.matches
+	t.failed += other.failed
+	t.draws += other.draws
+	for seat, wins := range other.wins {
+		t.wins[seat] += wins
+	}
+	for turns, matches := range other.turns {
+		t.turns[turns] += matches
+	}
+	t.rolls += other.rolls
+	t.decided += other.decided
+	t.comebacks += other.comebacks
+	for abilityID, tally := range other.abilities {
+		ability := t.ability(abilityID)
+		ability.equipped += tally.equipped
+		ability.equippedWins += tally.equippedWins
+		ability.used += tally.used
+		ability.usedWins += tally.usedWins
+		ability.uses += tally.uses
+	}
+}
+
+// simulate plays the configured matches across the workers and reports on
+// them. Progress is written to the progress writer while it runs.
+func simulate(config *simulationConfig, progress io.Writer) (*simulationReport, error) {
+	if config.Matches < 1 {
+		return nil, fmt.Errorf("at least one match must be played")
+	}
+	if config.Workers < 1 {
+		config.Workers = 1
+	}
+	if _, err := engine.NewSimulation(&config.SimulationConfig); err != nil {
+		return nil, err
+	}
+
+	started := time.Now()
+	var next, played int64
+	tallies := make([]*simulationTally, config.Workers)
+	errs := make([]error, config.Workers)
+	var wg sync.WaitGroup
+	for worker := range tallies {
+		tallies[worker] = newSimulationTally(len(config.Bots))
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			s, err := engine.NewSimulation(&config.SimulationConfig)
+			if err != nil {
+				errs[worker] = err
+				return
+			}
+			tally := tallies[worker]
+			for {
+				index := int(atomic.AddInt64(&next, 1)) - 1
+				if index >= config.Matches {
+					return
+				}
+				match, err := s.Play(index)
+				atomic.AddInt64(&played, 1)
+				if err != nil {
+					// One broken match is reported, not the end of the run
+					if tally.failed == 0 && errs[worker] == nil {
+						errs[worker] = err
+					}
+					tally.failed++
+					continue
+				}
+				tally.add(match, config.ComebackMargin)
+			}
+		}(worker)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	ticker := time.NewTicker(simulationProgressEvery)
+	defer ticker.Stop()
+	for finished := false; !finished; {
+		select {
+		case <-done:
+			finished = true
+		case <-ticker.C:
+			fmt.Fprintf(progress, "simulated %d/%d matches\n", atomic.LoadInt64(&played), config.Matches)
+		}
+	}
+
+	total := newSimulationTally(len(config.Bots))
+	for _, tally := range tallies {
+		total.merge(tally)
+	}
+	for _, err := range errs {
+		if err != nil {
+			if total.matches == 0 {
+				return nil, err
+			}
+			fmt.Fprintf(progress, "%d matches failed, first error: %v\n", total.failed, err)
+			break
+		}
+	}
+	return newSimulationReport(config, total, time.Since(started)), nil
+}
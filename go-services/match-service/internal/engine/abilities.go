@@ -0,0 +1,522 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+// Ability categories
+const (
+	abilityCategoryTactical = "tactical"
+	abilityCategoryDefense  = "defense"
+	abilityCategoryAttack   = "attack"
+	abilityCategoryUtility  = "utility"
+)
+
+// Ability timing windows
+const (
+	// timingOwnTurn allows the ability at any point of the user's turn
+	timingOwnTurn = "own_turn"
+	// timingOpponentTurn allows the ability while another player is taking their turn
+	timingOpponentTurn = "opponent_turn"
+	// timingPreRoll allows the ability on the user's turn before their first roll
+	timingPreRoll = "pre_roll"
+	// timingPostBank allows the ability after a bank, until the next roll
+	timingPostBank = "post_bank"
+)
+
+// Ability IDs
+const (
+	abilityLuckTurner = "luck_turner"
+	abilityPanSlap    = "pan_slap"
+	abilityHardHat    = "hard_hat"
+	abilitySiphon     = "score_siphon"
+	abilityAuraForge  = "aura_forge"
+	abilityVitalRush  = "vital_rush"
+)
+
+// Ability tuning
+const (
+	luckTurnerSingleOneFactor = 0.5
+	hardHatShieldRolls        = 3
+	siphonStealPercent        = 25
+	auraForgeGrant            = 6
+	vitalRushMultiplier       = 1.5
+)
+
+// abilityReasonUse is the AURA ledger reason for ability costs and grants
+const abilityReasonUse = "ability"
+
+// abilityUse describes a single use of an ability
+type abilityUse struct {
+	ability  *Ability
+	playerID string
+	targetID string
+	action   *models.GameAction
+}
+
+// Ability defines an ability the engine can resolve
+type Ability struct {
+	ID       string
+	Name     string
+	Category string
+	// StarCost is the loadout budget the ability takes up
+	StarCost int
+	// Costs lists the AURA cost of each successive use; later uses repeat the last cost
+	Costs []int
+	// MaxUses limits uses per match, 0 means unlimited
+	MaxUses int
+	Timing  string
+	// Target picks the player the ability affects, which is the user for self abilities
+	Target func(state *models.MatchState, playerID string) (string, error)
+	// Apply resolves the ability's effect
+	Apply func(activeMatch *ActiveMatch, use *abilityUse) *models.GameActionResult
+}
+
+// Cost returns the AURA cost of the ability after a number of previous uses
+func (a *Ability) Cost(uses int) int {
+	if len(a.Costs) == 0 {
+		return 0
+	}
+	if uses >= len(a.Costs) {
+		return a.Costs[len(a.Costs)-1]
+	}
+	return a.Costs[uses]
+}
+
+// AbilityRegistry holds all abilities players can use
+type AbilityRegistry struct {
+	abilities map[string]*Ability
+	mutex     sync.RWMutex
+}
+
+// NewAbilityRegistry creates an empty ability registry
+func NewAbilityRegistry() *AbilityRegistry {
+	return &AbilityRegistry{abilities: make(map[string]*Ability)}
+}
+
+// Register adds an ability
+func (ar *AbilityRegistry) Register(ability *Ability) {
+	ar.mutex.Lock()
+	defer ar.mutex.Unlock()
+
+	ar.abilities[ability.ID] = ability
+}
+
+// Get returns an ability by ID
+func (ar *AbilityRegistry) Get(id string) (*Ability, bool) {
+	ar.mutex.RLock()
+	defer ar.mutex.RUnlock()
+
+	ability, exists := ar.abilities[id]
+	return ability, exists
+}
+
+// Abilities returns the IDs of all registered abilities
+func (ar *AbilityRegistry) Abilities() []string {
+	ar.mutex.RLock()
+	defer ar.mutex.RUnlock()
+
+	ids := make([]string, 0, len(ar.abilities))
+	for id := range ar.abilities {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// defaultAbilityRegistry registers the shipped abilities
+func defaultAbilityRegistry() *AbilityRegistry {
+	registry := NewAbilityRegistry()
+
+	registry.Register(&Ability{
+		ID:       abilityLuckTurner,
+		Name:     "Luck Turner",
+		Category: abilityCategoryTactical,
+		StarCost: 4,
+		Costs:    []int{3, 6},
+		Timing:   timingPreRoll,
+		Target:   targetSelf,
+		Apply:    applyLuckTurner,
+	})
+
+	registry.Register(&Ability{
+		ID:       abilityPanSlap,
+		Name:     "Pan Slap",
+		Category: abilityCategoryDefense,
+		StarCost: 5,
+		Costs:    []int{5},
+		MaxUses:  1,
+		Timing:   timingOpponentTurn,
+		Target:   targetCurrentPlayer,
+		Apply:    applyPanSlap,
+	})
+
+	registry.Register(&Ability{
+		ID:       abilityHardHat,
+		Name:     "Hard Hat",
+		Category: abilityCategoryDefense,
+		StarCost: 4,
+		Costs:    []int{4},
+		MaxUses:  1,
+		Timing:   timingOpponentTurn,
+		Target:   targetSelf,
+		Apply:    applyHardHat,
+	})
+
+	registry.Register(&Ability{
+		ID:       abilitySiphon,
+		Name:     "Siphon",
+		Category: abilityCategoryAttack,
+		StarCost: 4,
+		Costs:    []int{2},
+		MaxUses:  1,
+		Timing:   timingPostBank,
+		Target:   targetSiphonBank,
+		Apply:    applySiphon,
+	})
+
+	registry.Register(&Ability{
+		ID:       abilityAuraForge,
+		Name:     "Aura Forge",
+		Category: abilityCategoryUtility,
+		StarCost: 3,
+		MaxUses:  1,
+		Timing:   timingOwnTurn,
+		Target:   targetSelf,
+		Apply:    applyAuraForge,
+	})
+
+	registry.Register(&Ability{
+		ID:       abilityVitalRush,
+		Name:     "Vital Rush",
+		Category: abilityCategoryTactical,
+		StarCost: 4,
+		Costs:    []int{4},
+		MaxUses:  1,
+		Timing:   timingPreRoll,
+		Target:   targetSelf,
+		Apply:    applyVitalRush,
+	})
+
+	return registry
+}
+
+// inTimingWindow reports whether a player may act in the given timing window
+func inTimingWindow(state *models.MatchState, playerID, timing string) bool {
+	switch timing {
+	case timingOwnTurn:
+		return state.CurrentTurn == playerID
+	case timingOpponentTurn:
+		return state.CurrentTurn != "" && state.CurrentTurn != playerID
+	case timingPreRoll:
+		return state.CurrentTurn == playerID && !rolledThisTurn(state)
+	case timingPostBank:
+		_, ok := lastBank(state)
+		return ok
+	default:
+		return false
+	}
+}
+
+// rolledThisTurn reports whether the current player has rolled this turn
+func rolledThisTurn(state *models.MatchState) bool {
+	for i := len(state.ActionHistory) - 1; i >= 0; i-- {
+		roll := state.ActionHistory[i].Roll
+		if roll != nil && roll.TurnNumber == state.TurnNumber {
+			return true
+		}
+		if roll != nil && roll.TurnNumber < state.TurnNumber {
+			return false
+		}
+	}
+	return false
+}
+
+// lastBank returns the most recent bank when no dice have been rolled since
+func lastBank(state *models.MatchState) (*models.GameAction, bool) {
+	for i := len(state.ActionHistory) - 1; i >= 0; i-- {
+		action := &state.ActionHistory[i]
+		switch action.Type {
+		case "hold_dice", "bank":
+			return action, true
+		case "roll_dice", "end_turn", "choose_parity":
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// targetSelf targets the player using the ability
+func targetSelf(state *models.MatchState, playerID string) (string, error) {
+	return playerID, nil
+}
+
+// targetCurrentPlayer targets the opponent whose turn it is
+func targetCurrentPlayer(state *models.MatchState, playerID string) (string, error) {
+	if state.CurrentTurn == "" || state.CurrentTurn == playerID {
+		return "", fmt.Errorf("no opponent is taking a turn")
+	}
+	return state.CurrentTurn, nil
+}
+
+// targetLastBanker targets the opponent who banked most recently
+func targetLastBanker(state *models.MatchState, playerID string) (string, error) {
+	bank, ok := lastBank(state)
+	if !ok || bank.PlayerID == playerID {
+		return "", fmt.Errorf("no opponent bank to target")
+	}
+	return bank.PlayerID, nil
+}
+
+// targetSiphonBank targets the opponent who banked most recently, when the bank
+// scored points. Countdown modes bank by lowering the score, so their banks
+// leave nothing to siphon.
+func targetSiphonBank(state *models.MatchState, playerID string) (string, error) {
+	targetID, err := targetLastBanker(state, playerID)
+	if err != nil {
+		return "", err
+	}
+	bank, _ := lastBank(state)
+	if intSetting(bank.StateChanges, "scoreChange", 0) <= 0 {
+		return "", fmt.Errorf("%s's bank scored no points", targetID)
+	}
+	return targetID, nil
+}
+
+// findEffect returns the index of a player's active effect, or -1
+func findEffect(state *models.MatchState, abilityID, playerID string) int {
+	for i, effect := range state.ActiveEffects {
+		if effect.AbilityID == abilityID && effect.PlayerID == playerID {
+			return i
+		}
+	}
+	return -1
+}
+
+// removeEffect drops the active effect at index i
+func removeEffect(state *models.MatchState, i int) {
+	state.ActiveEffects = append(state.ActiveEffects[:i], state.ActiveEffects[i+1:]...)
+}
+
+// consumeEffect removes a player's active effect and reports whether it was in force
+func consumeEffect(state *models.MatchState, abilityID, playerID string) bool {
+	i := findEffect(state, abilityID, playerID)
+	if i < 0 {
+		return false
+	}
+	removeEffect(state, i)
+	return true
+}
+
+// tickRollEffects counts a roll against every effect that lasts a number of rolls
+func tickRollEffects(state *models.MatchState) {
+	effects := state.ActiveEffects[:0]
+	for _, effect := range state.ActiveEffects {
+		if effect.RollsRemaining > 0 {
+			effect.RollsRemaining--
+			if effect.RollsRemaining == 0 {
+				continue
+			}
+		}
+		effects = append(effects, effect)
+	}
+	state.ActiveEffects = effects
+}
+
+// expireTurnEffects drops effects limited to a turn that has ended
+func expireTurnEffects(state *models.MatchState) {
+	effects := state.ActiveEffects[:0]
+	for _, effect := range state.ActiveEffects {
+		if effect.TurnNumber != 0 && effect.TurnNumber < state.TurnNumber {
+			continue
+		}
+		effects = append(effects, effect)
+	}
+	state.ActiveEffects = effects
+}
+
+// applyLuckTurner halves the chance of a single 1 on the user's next roll
+func applyLuckTurner(activeMatch *ActiveMatch, use *abilityUse) *models.GameActionResult {
+	state := activeMatch.State
+	state.ActiveEffects = append(state.ActiveEffects, models.ActiveEffect{
+		AbilityID:  abilityLuckTurner,
+		PlayerID:   use.playerID,
+		TurnNumber: state.TurnNumber,
+	})
+
+	// The turn is logged so verification knows which roll the dice were reweighted for
+	return &models.GameActionResult{
+		Success:       true,
+		Message:       "Luck Turner: a single 1 is half as likely on the next roll",
+		Data:          map[string]interface{}{"turn": state.TurnNumber},
+		SpecialEffect: abilityLuckTurner,
+	}
+}
+
+// applyPanSlap ends the opponent's turn at once, banking their turn score
+func applyPanSlap(activeMatch *ActiveMatch, use *abilityUse) *models.GameActionResult {
+	state := activeMatch.State
+	result := activeMatch.Rules.ProcessBank(state, use.targetID)
+	if !result.Success {
+		// Modes without banking simply lose the turn
+		result = &models.GameActionResult{
+			Success:     true,
+			Data:        map[string]interface{}{"forfeited": state.TurnScore},
+			ScoreChange: -state.TurnScore,
+			NewScore:    state.Scores[use.targetID],
+		}
+	}
+
+	result.Message = fmt.Sprintf("Pan Slap: %s's turn is over", use.targetID)
+	result.SpecialEffect = abilityPanSlap
+	result.TurnOver = true
+	return result
+}
+
+// applyHardHat shields the user from opponent abilities for the next few rolls
+func applyHardHat(activeMatch *ActiveMatch, use *abilityUse) *models.GameActionResult {
+	state := activeMatch.State
+	state.ActiveEffects = append(state.ActiveEffects, models.ActiveEffect{
+		AbilityID:      abilityHardHat,
+		PlayerID:       use.playerID,
+		RollsRemaining: hardHatShieldRolls,
+	})
+
+	return &models.GameActionResult{
+		Success:       true,
+		Message:       fmt.Sprintf("Hard Hat: shielded for %d rolls", hardHatShieldRolls),
+		Data:          make(map[string]interface{}),
+		SpecialEffect: abilityHardHat,
+	}
+}
+
+// applySiphon steals a share of the points the opponent just banked, never
+// taking more than they have
+func applySiphon(activeMatch *ActiveMatch, use *abilityUse) *models.GameActionResult {
+	state := activeMatch.State
+	bank, _ := lastBank(state)
+	banked := intSetting(bank.StateChanges, "scoreChange", 0)
+	stolen := banked * siphonStealPercent / 100
+	if stolen > state.Scores[use.targetID] {
+		stolen = state.Scores[use.targetID]
+	}
+	if stolen < 0 {
+		stolen = 0
+	}
+
+	state.Scores[use.targetID] -= stolen
+	state.Scores[use.playerID] += stolen
+
+	return &models.GameActionResult{
+		Success:       true,
+		Message:       fmt.Sprintf("Siphon: %d points taken from %s", stolen, use.targetID),
+		Data:          map[string]interface{}{"stolen": stolen, "target": use.targetID},
+		ScoreChange:   stolen,
+		NewScore:      state.Scores[use.playerID],
+		SpecialEffect: abilitySiphon,
+	}
+}
+
+// applyAuraForge grants the user AURA
+func applyAuraForge(activeMatch *ActiveMatch, use *abilityUse) *models.GameActionResult {
+	aura := recordAura(activeMatch.State, use.action, use.playerID, auraForgeGrant, abilityReasonUse, abilityAuraForge)
+
+	return &models.GameActionResult{
+		Success:       true,
+		Message:       fmt.Sprintf("Aura Forge: +%d AURA", auraForgeGrant),
+		Data:          map[string]interface{}{"aura": aura.Balance},
+		SpecialEffect: abilityAuraForge,
+	}
+}
+
+// applyVitalRush multiplies the user's turn score when they bank this turn
+func applyVitalRush(activeMatch *ActiveMatch, use *abilityUse) *models.GameActionResult {
+	state := activeMatch.State
+	state.ActiveEffects = append(state.ActiveEffects, models.ActiveEffect{
+		AbilityID:  abilityVitalRush,
+		PlayerID:   use.playerID,
+		TurnNumber: state.TurnNumber,
+	})
+
+	return &models.GameActionResult{
+		Success:       true,
+		Message:       fmt.Sprintf("Vital Rush: turn score x%.1f when banked", vitalRushMultiplier),
+		Data:          make(map[string]interface{}),
+		SpecialEffect: abilityVitalRush,
+	}
+}
+
+// handleUseAbility validates and resolves a use_ability action
+func (ge *GameEngine) handleUseAbility(activeMatch *ActiveMatch, action *models.GameAction) error {
+	state := activeMatch.State
+	abilityID, _ := action.Data["ability_id"].(string)
+	ability, exists := ge.abilities.Get(abilityID)
+	if !exists {
+		return fmt.Errorf("unknown ability: %s", abilityID)
+	}
+	player, ok := state.PlayerData[action.PlayerID]
+	if !ok {
+		return fmt.Errorf("player not in match: %s", action.PlayerID)
+	}
+	if !hasEquipped(player, ability.ID) {
+		return fmt.Errorf("%s is not in the player's loadout", ability.Name)
+	}
+
+	if !inTimingWindow(state, action.PlayerID, ability.Timing) {
+		return fmt.Errorf("%s cannot be used now, it requires the %s window", ability.Name, ability.Timing)
+	}
+
+	uses := state.AbilityUses[action.PlayerID][ability.ID]
+	if ability.MaxUses > 0 && uses >= ability.MaxUses {
+		return fmt.Errorf("%s can only be used %d time(s) per match", ability.Name, ability.MaxUses)
+	}
+	if findEffect(state, ability.ID, action.PlayerID) >= 0 {
+		return fmt.Errorf("%s is already active", ability.Name)
+	}
+
+	targetID, err := ability.Target(state, action.PlayerID)
+	if err != nil {
+		return fmt.Errorf("%s has no target: %w", ability.Name, err)
+	}
+
+	if _, err := spendAura(state, action, action.PlayerID, ability.Cost(uses), abilityReasonUse, ability.ID); err != nil {
+		return fmt.Errorf("cannot use %s: %w", ability.Name, err)
+	}
+	if state.AbilityUses == nil {
+		state.AbilityUses = make(map[string]map[string]int)
+	}
+	if state.AbilityUses[action.PlayerID] == nil {
+		state.AbilityUses[action.PlayerID] = make(map[string]int)
+	}
+	state.AbilityUses[action.PlayerID][ability.ID] = uses + 1
+
+	use := &abilityUse{
+		ability:  ability,
+		playerID: action.PlayerID,
+		targetID: targetID,
+		action:   action,
+	}
+
+	// A Hard Hat on the target absorbs the ability, cost and all
+	var result *models.GameActionResult
+	if targetID != action.PlayerID && consumeEffect(state, abilityHardHat, targetID) {
+		result = &models.GameActionResult{
+			Success:       true,
+			Message:       fmt.Sprintf("%s was blocked by Hard Hat", ability.Name),
+			Data:          map[string]interface{}{"blocked": true},
+			SpecialEffect: abilityHardHat,
+		}
+	} else {
+		result = ability.Apply(activeMatch, use)
+	}
+
+	result.Data["ability"] = ability.ID
+	result.Data["target"] = targetID
+	result.Data["cost"] = ability.Cost(uses)
+	ge.recordActionResult(activeMatch, action, result)
+	return nil
+}
@@ -0,0 +1,58 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+func TestSiphon(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        string
+		banked      int
+		targetScore int
+		stolen      int
+		rejected    bool
+	}{
+		{name: "takes a share of the bank", mode: models.GameModeClassic, banked: 12, targetScore: 40, stolen: 3},
+		{name: "small bank rounds down", mode: models.GameModeClassic, banked: 3, targetScore: 40, stolen: 0},
+		{name: "never takes more than the target has", mode: models.GameModeClassic, banked: 40, targetScore: 4, stolen: 4},
+		{name: "countdown bank has nothing to take", mode: models.GameModeZeroHour, banked: -40, targetScore: 60, rejected: true},
+		{name: "overshot bank has nothing to take", mode: models.GameModeZeroHour, banked: 0, targetScore: 60, rejected: true},
+	}
+
+	siphon, _ := defaultAbilityRegistry().Get(abilitySiphon)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, state := newModeMatch(t, tt.mode, nil, "a", "b")
+			state.Scores["a"], state.Scores["b"] = 20, tt.targetScore
+			state.ActionHistory = []models.GameAction{{
+				PlayerID:     "b",
+				Type:         "bank",
+				Success:      true,
+				StateChanges: map[string]interface{}{"scoreChange": tt.banked},
+			}}
+
+			targetID, err := siphon.Target(state, "a")
+			if tt.rejected {
+				if err == nil {
+					t.Fatalf("Target() = %q, want an error", targetID)
+				}
+				return
+			}
+			if err != nil || targetID != "b" {
+				t.Fatalf("Target() = %q, %v, want b", targetID, err)
+			}
+
+			activeMatch := &ActiveMatch{State: state, Rules: rules}
+			result := siphon.Apply(activeMatch, &abilityUse{ability: siphon, playerID: "a", targetID: "b"})
+			if result.ScoreChange != tt.stolen {
+				t.Errorf("stole %d, want %d", result.ScoreChange, tt.stolen)
+			}
+			if state.Scores["a"] != 20+tt.stolen || state.Scores["b"] != tt.targetScore-tt.stolen {
+				t.Errorf("scores = %v after stealing %d", state.Scores, tt.stolen)
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	apperrors "github.com/LukeAtkinz/dashdice/go-services/shared/errors"
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+// actionWaitTimeout bounds how long a caller waits for its action to be applied
+const actionWaitTimeout = 5 * time.Second
+
+// errActionQueueFull is returned when a match cannot take more actions for now
+var errActionQueueFull = errors.New("match update queue is full")
+
+// actionOutcome is what became of a game action: the event it was logged as,
+// or why it was rejected
+type actionOutcome struct {
+	playerID string
+	event    *models.GameAction
+	err      error
+}
+
+// outcomesFromHistory remembers every logged event by ID, so actions retried
+// after a restart still get their original result
+func outcomesFromHistory(history []models.GameAction) map[string]*actionOutcome {
+	outcomes := make(map[string]*actionOutcome, len(history))
+	for i := range history {
+		event := history[i]
+		outcomes[event.ID] = &actionOutcome{playerID: event.PlayerID, event: &event}
+	}
+	return outcomes
+}
+
+// ProcessGameAction applies a player's game action exactly once and returns
+// the event it was logged as. An action retried with the same ID gets the
+// original outcome back instead of running again.
+func (ge *GameEngine) ProcessGameAction(matchID string, action *models.GameAction) (*models.GameAction, error) {
+	activeMatch, exists := ge.GetMatch(matchID)
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", errMatchNotFound, matchID)
+	}
+	return ge.submitAction(activeMatch, action, ge.validateGameAction)
+}
+
+// submitAction queues an action for the match loop and waits for its outcome.
+// Actions are validated as they are queued unless validate is nil, which is
+// reserved for the events other services record through the engine.
+func (ge *GameEngine) submitAction(activeMatch *ActiveMatch, action *models.GameAction, validate func(*ActiveMatch, *models.GameAction) error) (*models.GameAction, error) {
+	if action.ID == "" {
+		return nil, apperrors.InvalidMove("action ID is required")
+	}
+
+	// Retries are answered from the original outcome, or wait for it when
+	// the original is still queued
+	outcome, wait, queued := activeMatch.awaitOutcome(action.ID)
+	if outcome != nil {
+		return outcome.result(action)
+	}
+	if queued {
+		return activeMatch.waitOutcome(action, wait)
+	}
+
+	// Validate action
+	if validate != nil {
+		if err := validate(activeMatch, action); err != nil {
+			activeMatch.stopWaiting(action.ID, wait)
+			return nil, apperrors.InvalidMove(err.Error()).AddDetail("action_id", action.ID)
+		}
+	}
+
+	// Send action to match processing
+	select {
+	case activeMatch.UpdateChan <- action:
+		ge.logger.Debug("Game action queued",
+			zap.String("match_id", activeMatch.Match.ID),
+			zap.String("action_id", action.ID),
+			zap.String("action_type", action.Type),
+			zap.String("player_id", action.PlayerID))
+	default:
+		activeMatch.stopWaiting(action.ID, wait)
+		return nil, errActionQueueFull
+	}
+	return activeMatch.waitOutcome(action, wait)
+}
+
+// waitOutcome waits for a queued action to be applied
+func (am *ActiveMatch) waitOutcome(action *models.GameAction, wait chan *actionOutcome) (*models.GameAction, error) {
+	select {
+	case outcome := <-wait:
+		return outcome.result(action)
+	case <-time.After(actionWaitTimeout):
+		am.stopWaiting(action.ID, wait)
+		return nil, apperrors.Timeout("game action").AddDetail("action_id", action.ID)
+	}
+}
+
+// result is the outcome as seen by the action asking for it. An ID already
+// used by another player is not theirs to replay.
+func (o *actionOutcome) result(action *models.GameAction) (*models.GameAction, error) {
+	if o.playerID != action.PlayerID {
+		return nil, apperrors.InvalidMove("action ID has already been used").
+			AddDetail("action_id", action.ID)
+	}
+	return o.event, o.err
+}
+
+// applyQueuedAction applies an action taken off the match queue, unless it
+// already ran, and records its outcome for the callers waiting on it
+func (ge *GameEngine) applyQueuedAction(activeMatch *ActiveMatch, action *models.GameAction) error {
+	if _, done := activeMatch.findOutcome(action.ID); done {
+		return nil
+	}
+
+	outcome := &actionOutcome{playerID: action.PlayerID}
+	if err := checkExpectedVersion(activeMatch, action); err != nil {
+		outcome.err = err
+	} else if err := ge.executeGameAction(activeMatch, action); err != nil {
+		outcome.err = apperrors.InvalidMove(err.Error()).AddDetail("action_id", action.ID)
+	} else {
+		outcome.event = activeMatch.loggedEvent(action.ID)
+	}
+
+	activeMatch.recordOutcome(action.ID, outcome)
+	return outcome.err
+}
+
+// checkExpectedVersion rejects an action made against a state that has
+// since moved on. The expected version is the sequence of the last event the
+// client saw; passive events logged after it do not make it stale. Actions
+// without an expected version are not checked.
+func checkExpectedVersion(activeMatch *ActiveMatch, action *models.GameAction) error {
+	if action.ExpectedVersion == 0 {
+		return nil
+	}
+
+	activeMatch.mutex.RLock()
+	current := activeMatch.State.Sequence
+	stale := action.ExpectedVersion > current
+	history := activeMatch.State.ActionHistory
+	for i := len(history) - 1; i >= 0 && !stale; i-- {
+		if history[i].Sequence <= action.ExpectedVersion {
+			break
+		}
+		stale = !passiveEvents[history[i].Type]
+	}
+	activeMatch.mutex.RUnlock()
+	if !stale {
+		return nil
+	}
+	return apperrors.InvalidMove("action was made against a stale state").
+		AddDetail("action_id", action.ID).
+		AddDetail("expected_version", action.ExpectedVersion).
+		AddDetail("current_version", current)
+}
+
+// loggedEvent returns a copy of the event an action was just logged as, or
+// nil when it added no event
+func (am *ActiveMatch) loggedEvent(actionID string) *models.GameAction {
+	am.mutex.RLock()
+	defer am.mutex.RUnlock()
+
+	history := am.State.ActionHistory
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].ID == actionID {
+			event := history[i]
+			return &event
+		}
+	}
+	return nil
+}
+
+// findOutcome returns the outcome of an action that has already run
+func (am *ActiveMatch) findOutcome(actionID string) (*actionOutcome, bool) {
+	am.outcomesMutex.Lock()
+	defer am.outcomesMutex.Unlock()
+
+	outcome, done := am.outcomes[actionID]
+	return outcome, done
+}
+
+// awaitOutcome returns the outcome of an action that has already run, or a
+// channel that receives it once it does, reporting whether someone else is
+// already waiting on the same action
+func (am *ActiveMatch) awaitOutcome(actionID string) (*actionOutcome, chan *actionOutcome, bool) {
+	am.outcomesMutex.Lock()
+	defer am.outcomesMutex.Unlock()
+
+	if outcome, done := am.outcomes[actionID]; done {
+		return outcome, nil, false
+	}
+	if am.waiters == nil {
+		am.waiters = make(map[string][]chan *actionOutcome)
+	}
+	queued := len(am.waiters[actionID]) > 0
+	wait := make(chan *actionOutcome, 1)
+	am.waiters[actionID] = append(am.waiters[actionID], wait)
+	return nil, wait, queued
+}
+
+// stopWaiting drops a caller that gave up on an action
+func (am *ActiveMatch) stopWaiting(actionID string, wait chan *actionOutcome) {
+	am.outcomesMutex.Lock()
+	defer am.outcomesMutex.Unlock()
+
+	waiting := am.waiters[actionID]
+	for i, ch := range waiting {
+		if ch == wait {
+			waiting = append(waiting[:i], waiting[i+1:]...)
+			break
+		}
+	}
+	if len(waiting) == 0 {
+		delete(am.waiters, actionID)
+	} else {
+		am.waiters[actionID] = waiting
+	}
+}
+
+// recordOutcome remembers an action's outcome and hands it to everyone waiting on it
+func (am *ActiveMatch) recordOutcome(actionID string, outcome *actionOutcome) {
+	am.outcomesMutex.Lock()
+	defer am.outcomesMutex.Unlock()
+
+	if am.outcomes == nil {
+		am.outcomes = make(map[string]*actionOutcome)
+	}
+	am.outcomes[actionID] = outcome
+	for _, wait := range am.waiters[actionID] {
+		wait <- outcome
+	}
+	delete(am.waiters, actionID)
+}
@@ -0,0 +1,37 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+func TestCheckExpectedVersion(t *testing.T) {
+	events := []string{eventCreateMatch, eventStartMatch, "roll_dice", eventSpectatorJoin, eventDisconnect, eventReconnect}
+
+	tests := []struct {
+		name     string
+		expected int64
+		stale    bool
+	}{
+		{name: "unchecked", expected: 0},
+		{name: "latest event", expected: 6},
+		{name: "only passive events since", expected: 3},
+		{name: "a play event since", expected: 2, stale: true},
+		{name: "ahead of the log", expected: 7, stale: true},
+	}
+
+	state := &models.MatchState{}
+	for _, eventType := range events {
+		appendEvent(state, &models.GameAction{Type: eventType}, &models.GameActionResult{Success: true})
+	}
+	activeMatch := &ActiveMatch{State: state}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkExpectedVersion(activeMatch, &models.GameAction{ID: "action", ExpectedVersion: tt.expected})
+			if stale := err != nil; stale != tt.stale {
+				t.Errorf("checkExpectedVersion() = %v, want stale %v", err, tt.stale)
+			}
+		})
+	}
+}
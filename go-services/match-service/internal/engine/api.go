@@ -0,0 +1,120 @@
+package engine
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	apperrors "github.com/LukeAtkinz/dashdice/go-services/shared/errors"
+)
+
+// Page sizes for list endpoints
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// abortWithError answers a request with the AppError an engine error maps to.
+// Errors with no client-facing meaning are logged and reported as internal.
+func (ms *MatchService) abortWithError(c *gin.Context, err error, operation string) {
+	var appErr *apperrors.AppError
+	switch {
+	case errors.As(err, &appErr):
+	case errors.Is(err, errMatchNotFound):
+		appErr = apperrors.MatchNotFound(c.Param("id"))
+	case errors.Is(err, errPlayerNotInMatch):
+		appErr = apperrors.BadRequest("Player is not in this match")
+	case errors.Is(err, errMatchInProgress):
+		appErr = apperrors.GameInProgress(c.Param("id"))
+	case errors.Is(err, errReplayNotFound):
+		appErr = apperrors.NotFound("Replay")
+	case errors.Is(err, errInvalidReplay), errors.Is(err, errInvalidMatchConfig):
+		appErr = apperrors.ValidationError(err.Error())
+	case errors.Is(err, errSpectatingDisabled):
+		appErr = apperrors.Forbidden("Match does not allow spectators")
+	case errors.Is(err, errSeedNotRevealed):
+		appErr = apperrors.Conflict("Server seed is revealed when the match ends")
+	case errors.Is(err, errFairnessUnsupported):
+		appErr = apperrors.New(apperrors.ErrTypeValidation, "Match was not played with provably fair dice", http.StatusUnprocessableEntity)
+	case errors.Is(err, errActionQueueFull):
+		appErr = apperrors.New(apperrors.ErrTypeService, "Match is busy, try again", http.StatusServiceUnavailable)
+	default:
+		ms.logger.Error("Failed to "+operation,
+			zap.String("match_id", c.Param("id")),
+			zap.Error(err))
+		appErr = apperrors.InternalWrap(err, "Failed to "+operation)
+	}
+	apperrors.AbortWithError(c, appErr)
+}
+
+// pageSize reads the page size a list request asks for
+func pageSize(c *gin.Context) (int, *apperrors.AppError) {
+	raw := c.Query("limit")
+	if raw == "" {
+		return defaultPageSize, nil
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit < 1 || limit > maxPageSize {
+		return 0, apperrors.BadRequestf("limit must be between 1 and %d", maxPageSize)
+	}
+	return limit, nil
+}
+
+// encodeCursor makes a page position opaque to clients
+func encodeCursor(position string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(position))
+}
+
+// decodeCursor reads the page position a request continues from, which is
+// empty for the first page
+func decodeCursor(c *gin.Context) (string, *apperrors.AppError) {
+	raw := c.Query("cursor")
+	if raw == "" {
+		return "", nil
+	}
+	position, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil || len(position) == 0 {
+		return "", apperrors.BadRequest("Invalid cursor")
+	}
+	return string(position), nil
+}
+
+// matchCursor is the page position after a match: its creation time. A
+// player's matches are created one after another, so creation times never tie.
+func matchCursor(createdAt time.Time) string {
+	return encodeCursor(createdAt.UTC().Format(time.RFC3339Nano))
+}
+
+// parseMatchCursor reads a match list position
+func parseMatchCursor(position string) (time.Time, *apperrors.AppError) {
+	if position == "" {
+		return time.Time{}, nil
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, position)
+	if err != nil {
+		return time.Time{}, apperrors.BadRequest("Invalid cursor")
+	}
+	return createdAt, nil
+}
+
+// historyCursor is the page position after an event: its sequence number
+func historyCursor(sequence int64) string {
+	return encodeCursor(strconv.FormatInt(sequence, 10))
+}
+
+// parseHistoryCursor reads an event log position
+func parseHistoryCursor(position string) (int64, *apperrors.AppError) {
+	if position == "" {
+		return 0, nil
+	}
+	sequence, err := strconv.ParseInt(position, 10, 64)
+	if err != nil || sequence < 0 {
+		return 0, apperrors.BadRequest("Invalid cursor")
+	}
+	return sequence, nil
+}
@@ -0,0 +1,564 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+	testutil "github.com/LukeAtkinz/dashdice/go-services/shared/testing"
+)
+
+// newTestRouter serves the handlers under test for matches running on this
+// instance, without forwarding to match owners
+func newTestRouter(matches ...*ActiveMatch) *gin.Engine {
+	ge := newMemoryEngine(newMemoryDB(), "a")
+	for _, activeMatch := range matches {
+		ge.activeMatches[activeMatch.Match.ID] = activeMatch
+	}
+	return newEngineRouter(ge)
+}
+
+// newEngineRouter serves the handlers under test on the given engine
+func newEngineRouter(ge *GameEngine) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	ms := &MatchService{logger: zap.NewNop(), gameEngine: ge}
+
+	router := gin.New()
+	router.POST("/internal/matches", ms.handleCreateMatch)
+	router.GET("/internal/matches/:id", ms.handleGetMatch)
+	router.DELETE("/internal/matches/:id", ms.handleDeleteMatch)
+	router.GET("/internal/matches/:id/state", ms.handleGetMatchState)
+	router.PUT("/internal/matches/:id/state", ms.handleUpdateMatchState)
+	router.POST("/internal/matches/:id/actions", ms.handleGameAction)
+	router.POST("/internal/matches/:id/turn", ms.handleProcessTurn)
+	router.POST("/internal/matches/:id/end", ms.handleEndMatch)
+	router.POST("/internal/matches/:id/players/:userId/disconnect", ms.handlePlayerDisconnect)
+	router.GET("/internal/users/:userId/matches", ms.handleGetUserMatches)
+	router.GET("/internal/matches/:id/history", ms.handleGetMatchHistory)
+	router.GET("/internal/matches/:id/verify", ms.handleVerifyMatch)
+	router.GET("/internal/matches/:id/reconstruct", ms.handleReconstructMatch)
+	return router
+}
+
+// newRunningMatch wraps a match state as a match running on this instance
+func newRunningMatch(state *models.MatchState, queue int) *ActiveMatch {
+	state.PlayerData = map[string]models.MatchPlayer{"a": {UserID: "a"}, "b": {UserID: "b"}}
+	return &ActiveMatch{
+		Match:      &models.Match{ID: state.ID, Players: state.Players},
+		State:      state,
+		UpdateChan: make(chan *models.GameAction, queue),
+	}
+}
+
+func TestMatchAPIErrors(t *testing.T) {
+	revealed := newFairState(t, []fairRoll{{player: "a", turn: 1, index: 0}})
+	revealed.ID = "revealed"
+	hidden := newFairState(t, nil)
+	hidden.ID, hidden.Fairness.ServerSeed = "hidden", ""
+	unfair := &models.MatchState{ID: "unfair", Players: []string{"a", "b"}}
+	busy := newFairState(t, nil)
+	busy.ID = "busy"
+
+	router := newTestRouter(
+		newRunningMatch(revealed, 1),
+		newRunningMatch(hidden, 1),
+		newRunningMatch(unfair, 1),
+		newRunningMatch(busy, 0),
+	)
+
+	tests := []struct {
+		name    string
+		request *testutil.RequestBuilder
+		status  int
+		errType string
+	}{
+		{
+			name:    "verify a revealed match",
+			request: testutil.NewRequest(http.MethodGet, "/internal/matches/revealed/verify"),
+			status:  http.StatusOK,
+		},
+		{
+			name:    "verify before the seed is revealed",
+			request: testutil.NewRequest(http.MethodGet, "/internal/matches/hidden/verify"),
+			status:  http.StatusConflict,
+			errType: "conflict",
+		},
+		{
+			name:    "verify a match without fair dice",
+			request: testutil.NewRequest(http.MethodGet, "/internal/matches/unfair/verify"),
+			status:  http.StatusUnprocessableEntity,
+			errType: "validation_error",
+		},
+		{
+			name:    "reconstruct before the first event",
+			request: testutil.NewRequest(http.MethodGet, "/internal/matches/revealed/reconstruct?sequence=0"),
+			status:  http.StatusBadRequest,
+			errType: "bad_request",
+		},
+		{
+			name:    "disconnect from a match not running here",
+			request: testutil.NewRequest(http.MethodPost, "/internal/matches/gone/players/a/disconnect"),
+			status:  http.StatusNotFound,
+			errType: "match_not_found",
+		},
+		{
+			name:    "disconnect a stranger",
+			request: testutil.NewRequest(http.MethodPost, "/internal/matches/revealed/players/zz/disconnect"),
+			status:  http.StatusBadRequest,
+			errType: "bad_request",
+		},
+		{
+			name:    "disconnect from a busy match",
+			request: testutil.NewRequest(http.MethodPost, "/internal/matches/busy/players/a/disconnect"),
+			status:  http.StatusServiceUnavailable,
+			errType: "service_error",
+		},
+		{
+			name:    "disconnect a player",
+			request: testutil.NewRequest(http.MethodPost, "/internal/matches/revealed/players/a/disconnect"),
+			status:  http.StatusAccepted,
+		},
+		{
+			name:    "restore a running match",
+			request: testutil.NewRequest(http.MethodPut, "/internal/matches/revealed/state"),
+			status:  http.StatusConflict,
+			errType: "game_in_progress",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkResponse(t, tt.request.Execute(router), tt.status, tt.errType)
+		})
+	}
+}
+
+// checkResponse checks a response's status and that it succeeded, or failed
+// with an error of the given type when one is given. It returns the body.
+func checkResponse(t *testing.T, resp *httptest.ResponseRecorder, status int, errType string) map[string]json.RawMessage {
+	t.Helper()
+	if resp.Code != status {
+		t.Fatalf("status = %d, want %d: %s", resp.Code, status, resp.Body)
+	}
+
+	var body struct {
+		Success bool `json:"success"`
+		Error   *struct {
+			Type string `json:"type"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if errType == "" {
+		if !body.Success || body.Error != nil {
+			t.Errorf("response = %s, want success", resp.Body)
+		}
+	} else if body.Success || body.Error == nil || body.Error.Type != errType {
+		t.Errorf("response = %s, want a %s error", resp.Body, errType)
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(resp.Body.Bytes(), &fields); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return fields
+}
+
+// storeEndedMatch records a match the way its owner leaves it when it ends
+func storeEndedMatch(t *testing.T, ge *GameEngine, state *models.MatchState, createdAt time.Time) {
+	t.Helper()
+	ctx := context.Background()
+	match := &models.Match{ID: state.ID, Status: state.Status, Players: state.Players, PlayerIDs: state.Players, CreatedAt: createdAt}
+	if err := ge.dbManager.StoreMatch(ctx, match); err != nil {
+		t.Fatalf("StoreMatch() failed: %v", err)
+	}
+	if _, err := ge.acquireLease(ctx, state.ID); err != nil {
+		t.Fatalf("acquireLease() failed: %v", err)
+	}
+	if err := ge.storeState(ctx, state.ID, state, 0); err != nil {
+		t.Fatalf("storeState() failed: %v", err)
+	}
+	ge.releaseLease(ctx, state.ID)
+}
+
+func TestMatchRecordAPI(t *testing.T) {
+	ge := newMemoryEngine(newMemoryDB(), "a")
+	running := newSyncState(4)
+	running.ID = "running"
+	ge.activeMatches[running.ID] = newRunningMatch(running, 1)
+
+	ended := newSyncState(4)
+	ended.ID, ended.Status = "ended", "completed"
+	completedAt := time.Date(2024, 1, 1, 12, 30, 0, 0, time.UTC)
+	ended.CompletedAt = &completedAt
+	storeEndedMatch(t, ge, ended, completedAt.Add(-30*time.Minute))
+	router := newEngineRouter(ge)
+
+	tests := []struct {
+		name    string
+		request *testutil.RequestBuilder
+		status  int
+		errType string
+		field   string
+		id      string
+	}{
+		{
+			name:    "get a running match",
+			request: testutil.NewRequest(http.MethodGet, "/internal/matches/running"),
+			status:  http.StatusOK,
+			field:   "match",
+			id:      "running",
+		},
+		{
+			name:    "get an ended match",
+			request: testutil.NewRequest(http.MethodGet, "/internal/matches/ended"),
+			status:  http.StatusOK,
+			field:   "match",
+			id:      "ended",
+		},
+		{
+			name:    "get a match never created",
+			request: testutil.NewRequest(http.MethodGet, "/internal/matches/gone"),
+			status:  http.StatusNotFound,
+			errType: "match_not_found",
+		},
+		{
+			name:    "get a running match's state",
+			request: testutil.NewRequest(http.MethodGet, "/internal/matches/running/state"),
+			status:  http.StatusOK,
+			field:   "state",
+			id:      "running",
+		},
+		{
+			name:    "get an ended match's stored state",
+			request: testutil.NewRequest(http.MethodGet, "/internal/matches/ended/state"),
+			status:  http.StatusOK,
+			field:   "state",
+			id:      "ended",
+		},
+		{
+			name:    "get the state of a match never created",
+			request: testutil.NewRequest(http.MethodGet, "/internal/matches/gone/state"),
+			status:  http.StatusNotFound,
+			errType: "match_not_found",
+		},
+		{
+			name:    "delete a running match",
+			request: testutil.NewRequest(http.MethodDelete, "/internal/matches/running"),
+			status:  http.StatusConflict,
+			errType: "game_in_progress",
+		},
+		{
+			name:    "delete an ended match",
+			request: testutil.NewRequest(http.MethodDelete, "/internal/matches/ended"),
+			status:  http.StatusOK,
+		},
+		{
+			name:    "get a deleted match",
+			request: testutil.NewRequest(http.MethodGet, "/internal/matches/ended"),
+			status:  http.StatusNotFound,
+			errType: "match_not_found",
+		},
+		{
+			name:    "get a deleted match's state",
+			request: testutil.NewRequest(http.MethodGet, "/internal/matches/ended/state"),
+			status:  http.StatusNotFound,
+			errType: "match_not_found",
+		},
+		{
+			name:    "delete a match never created",
+			request: testutil.NewRequest(http.MethodDelete, "/internal/matches/gone"),
+			status:  http.StatusNotFound,
+			errType: "match_not_found",
+		},
+	}
+
+	// Cases run in order: the deleted match is gone for the ones after
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields := checkResponse(t, tt.request.Execute(router), tt.status, tt.errType)
+			if tt.field == "" {
+				return
+			}
+			var record struct {
+				ID string `json:"id"`
+			}
+			if err := json.Unmarshal(fields[tt.field], &record); err != nil || record.ID != tt.id {
+				t.Errorf("%s = %s, want %s", tt.field, fields[tt.field], tt.id)
+			}
+		})
+	}
+}
+
+func TestMatchPlayAPI(t *testing.T) {
+	ge := newMemoryEngine(newMemoryDB(), "a")
+	router := newEngineRouter(ge)
+	t.Cleanup(func() {
+		ge.matchesMutex.RLock()
+		defer ge.matchesMutex.RUnlock()
+		for _, activeMatch := range ge.activeMatches {
+			activeMatch.release()
+		}
+	})
+
+	create := func(body map[string]interface{}) *testutil.RequestBuilder {
+		return testutil.NewRequest(http.MethodPost, "/internal/matches").WithJSON().WithBody(body)
+	}
+	invalid := []struct {
+		name    string
+		request *testutil.RequestBuilder
+		errType string
+	}{
+		{
+			name:    "create without a game mode",
+			request: create(map[string]interface{}{"player_ids": []string{"p1", "p2"}, "region": "eu"}),
+			errType: "bad_request",
+		},
+		{
+			name:    "create for one player",
+			request: create(map[string]interface{}{"game_mode": models.GameModeClassic, "player_ids": []string{"p1"}, "region": "eu"}),
+			errType: "validation_error",
+		},
+		{
+			name:    "create in an unknown mode",
+			request: create(map[string]interface{}{"game_mode": "chess", "player_ids": []string{"p1", "p2"}, "region": "eu"}),
+			errType: "validation_error",
+		},
+		{
+			name:    "create with a bot outside the match",
+			request: create(map[string]interface{}{"game_mode": models.GameModeClassic, "player_ids": []string{"p1", "p2"}, "region": "eu", "bots": map[string]string{"p3": "easy"}}),
+			errType: "validation_error",
+		},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			checkResponse(t, tt.request.Execute(router), http.StatusBadRequest, tt.errType)
+		})
+	}
+	if count := ge.GetActiveMatchCount(); count != 0 {
+		t.Fatalf("invalid requests started %d matches", count)
+	}
+
+	fields := checkResponse(t, create(map[string]interface{}{"game_mode": models.GameModeClassic, "player_ids": []string{"p1", "p2"}, "region": "eu"}).Execute(router), http.StatusCreated, "")
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(fields["match"], &created); err != nil || created.ID == "" {
+		t.Fatalf("created match = %s, want an ID", fields["match"])
+	}
+	matchPath := "/internal/matches/" + created.ID
+
+	// The match loop opens the turn decider once it starts
+	var chooser string
+	for deadline := time.Now().Add(5 * time.Second); chooser == ""; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("match never reached the turn decider")
+		}
+		if state, err := ge.MatchState(context.Background(), created.ID); err == nil && state.TurnDecider != nil {
+			chooser = state.TurnDecider.ChooserID
+		}
+	}
+	other := "p1"
+	if chooser == "p1" {
+		other = "p2"
+	}
+
+	action := func(playerID string) *testutil.RequestBuilder {
+		return testutil.NewRequest(http.MethodPost, matchPath+"/actions").WithJSON().WithBody(map[string]interface{}{
+			"action_id": "call_" + playerID,
+			"player_id": playerID,
+			"type":      "choose_parity",
+			"data":      map[string]interface{}{"parity": parityOdd},
+		})
+	}
+	tests := []struct {
+		name      string
+		request   *testutil.RequestBuilder
+		status    int
+		errType   string
+		eventType string
+	}{
+		{
+			name:    "action without a type",
+			request: testutil.NewRequest(http.MethodPost, matchPath+"/actions").WithJSON().WithBody(map[string]interface{}{"action_id": "x", "player_id": chooser}),
+			status:  http.StatusBadRequest,
+			errType: "bad_request",
+		},
+		{
+			name:    "action in a match not running here",
+			request: testutil.NewRequest(http.MethodPost, "/internal/matches/gone/actions").WithJSON().WithBody(map[string]interface{}{"action_id": "x", "player_id": "p1", "type": "roll_dice"}),
+			status:  http.StatusNotFound,
+			errType: "match_not_found",
+		},
+		{
+			name:    "call by the player who does not choose",
+			request: action(other),
+			status:  http.StatusBadRequest,
+			errType: "invalid_move",
+		},
+		{
+			name:      "call by the chooser",
+			request:   action(chooser),
+			status:    http.StatusOK,
+			eventType: "choose_parity",
+		},
+		{
+			name:    "turn with an unreadable body",
+			request: testutil.NewRequest(http.MethodPost, matchPath+"/turn").WithJSON().WithBody("roll"),
+			status:  http.StatusBadRequest,
+			errType: "bad_request",
+		},
+		{
+			name:    "turn in a match not running here",
+			request: testutil.NewRequest(http.MethodPost, "/internal/matches/gone/turn"),
+			status:  http.StatusNotFound,
+			errType: "match_not_found",
+		},
+		{
+			name:      "turn played for the current player",
+			request:   testutil.NewRequest(http.MethodPost, matchPath+"/turn"),
+			status:    http.StatusOK,
+			eventType: "roll_dice",
+		},
+		{
+			name:    "forfeit by a stranger",
+			request: testutil.NewRequest(http.MethodPost, matchPath+"/end").WithJSON().WithBody(map[string]string{"forfeited_by": "p9"}),
+			status:  http.StatusBadRequest,
+			errType: "bad_request",
+		},
+		{
+			name:      "end as a no contest",
+			request:   testutil.NewRequest(http.MethodPost, matchPath+"/end"),
+			status:    http.StatusOK,
+			eventType: eventEndMatch,
+		},
+	}
+
+	// Cases run in order, playing the match from the turn decider to its end
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields := checkResponse(t, tt.request.Execute(router), tt.status, tt.errType)
+			if tt.eventType == "" {
+				return
+			}
+			var event models.GameAction
+			if err := json.Unmarshal(fields["event"], &event); err != nil || event.Type != tt.eventType {
+				t.Errorf("event = %s, want %s", fields["event"], tt.eventType)
+			}
+		})
+	}
+
+	fields = checkResponse(t, testutil.NewRequest(http.MethodGet, matchPath+"/state").Execute(router), http.StatusOK, "")
+	var state models.MatchState
+	if err := json.Unmarshal(fields["state"], &state); err != nil || state.CompletedAt == nil || state.WinReason != models.WinReasonVoid {
+		t.Errorf("state after the end = %s, want a void match", fields["state"])
+	}
+}
+
+func TestUserMatchesPaging(t *testing.T) {
+	ge := newMemoryEngine(newMemoryDB(), "a")
+	created := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		state := &models.MatchState{ID: fmt.Sprintf("m%d", i), Status: "completed", Players: []string{"u", "v"}}
+		storeEndedMatch(t, ge, state, created.Add(time.Duration(i)*time.Minute))
+	}
+	storeEndedMatch(t, ge, &models.MatchState{ID: "other", Status: "completed", Players: []string{"v", "w"}}, created)
+	router := newEngineRouter(ge)
+
+	// Pages follow each other newest first until the cursor runs out
+	var pages [][]string
+	cursor := ""
+	for {
+		path := "/internal/users/u/matches?limit=2"
+		if cursor != "" {
+			path += "&cursor=" + cursor
+		}
+		fields := checkResponse(t, testutil.NewRequest(http.MethodGet, path).Execute(router), http.StatusOK, "")
+		var matches []models.Match
+		if err := json.Unmarshal(fields["matches"], &matches); err != nil {
+			t.Fatalf("failed to decode matches: %v", err)
+		}
+		page := make([]string, len(matches))
+		for i, match := range matches {
+			page[i] = match.ID
+		}
+		pages = append(pages, page)
+		if err := json.Unmarshal(fields["next_cursor"], &cursor); err != nil {
+			t.Fatalf("failed to decode cursor: %v", err)
+		}
+		if cursor == "" || len(pages) > 5 {
+			break
+		}
+	}
+	if got, want := fmt.Sprint(pages), "[[m4 m3] [m2 m1] [m0]]"; got != want {
+		t.Errorf("pages = %s, want %s", got, want)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{name: "limit of zero", query: "limit=0"},
+		{name: "limit above the maximum", query: fmt.Sprintf("limit=%d", maxPageSize+1)},
+		{name: "limit that is no number", query: "limit=ten"},
+		{name: "cursor that is not base64", query: "cursor=%21%21"},
+		{name: "cursor that is not a time", query: "cursor=" + encodeCursor("yesterday")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := testutil.NewRequest(http.MethodGet, "/internal/users/u/matches?"+tt.query).Execute(router)
+			checkResponse(t, resp, http.StatusBadRequest, "bad_request")
+		})
+	}
+}
+
+func TestMatchHistoryPaging(t *testing.T) {
+	state := newSyncState(5)
+	router := newTestRouter(newRunningMatch(state, 1))
+
+	var pages [][]int64
+	cursor := ""
+	for {
+		path := "/internal/matches/match/history?limit=2"
+		if cursor != "" {
+			path += "&cursor=" + cursor
+		}
+		fields := checkResponse(t, testutil.NewRequest(http.MethodGet, path).Execute(router), http.StatusOK, "")
+		var events []models.GameAction
+		if err := json.Unmarshal(fields["events"], &events); err != nil {
+			t.Fatalf("failed to decode events: %v", err)
+		}
+		page := make([]int64, len(events))
+		for i, event := range events {
+			page[i] = event.Sequence
+		}
+		pages = append(pages, page)
+		if err := json.Unmarshal(fields["next_cursor"], &cursor); err != nil {
+			t.Fatalf("failed to decode cursor: %v", err)
+		}
+		if cursor == "" || len(pages) > 5 {
+			break
+		}
+	}
+	if got, want := fmt.Sprint(pages), "[[1 2] [3 4] [5]]"; got != want {
+		t.Errorf("pages = %s, want %s", got, want)
+	}
+
+	// A cursor past the end gives an empty last page
+	resp := testutil.NewRequest(http.MethodGet, "/internal/matches/match/history?cursor="+historyCursor(9)).Execute(router)
+	fields := checkResponse(t, resp, http.StatusOK, "")
+	if string(fields["events"]) != "[]" {
+		t.Errorf("events past the end = %s, want none", fields["events"])
+	}
+	resp = testutil.NewRequest(http.MethodGet, "/internal/matches/match/history?cursor="+encodeCursor("-1")).Execute(router)
+	checkResponse(t, resp, http.StatusBadRequest, "bad_request")
+}
@@ -0,0 +1,71 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+// AURA earned from dice rolls
+const (
+	auraPerRoll   = 1
+	auraPerDouble = 2
+)
+
+// AURA transaction reasons
+const (
+	auraReasonRoll      = "roll"
+	auraReasonDouble    = "double"
+	auraReasonSnakeEyes = "snake_eyes"
+)
+
+// auraBalance returns a player's current AURA
+func auraBalance(state *models.MatchState, playerID string) int {
+	return state.Aura[playerID]
+}
+
+// recordAura applies an AURA change, positive or negative, and adds it to the action's ledger
+func recordAura(state *models.MatchState, action *models.GameAction, playerID string, amount int, reason, source string) models.AuraTransaction {
+	if state.Aura == nil {
+		state.Aura = make(map[string]int)
+	}
+	state.Aura[playerID] += amount
+
+	transaction := models.AuraTransaction{
+		PlayerID:   playerID,
+		Amount:     amount,
+		Reason:     reason,
+		Source:     source,
+		Balance:    state.Aura[playerID],
+		TurnNumber: state.TurnNumber,
+		Timestamp:  action.Timestamp,
+	}
+	action.AuraTransactions = append(action.AuraTransactions, transaction)
+	return transaction
+}
+
+// spendAura takes AURA from a player, failing when the balance is too low
+func spendAura(state *models.MatchState, action *models.GameAction, playerID string, amount int, reason, source string) (models.AuraTransaction, error) {
+	if balance := auraBalance(state, playerID); balance < amount {
+		return models.AuraTransaction{}, fmt.Errorf("insufficient AURA: need %d, have %d", amount, balance)
+	}
+	return recordAura(state, action, playerID, -amount, reason, source), nil
+}
+
+// rollAura returns the AURA a roll earns and the reason it is credited under
+func rollAura(roll *models.DiceRoll) (int, string) {
+	switch {
+	case isSnakeEyes(roll):
+		return auraPerDouble, auraReasonSnakeEyes
+	case roll.IsDouble:
+		return auraPerDouble, auraReasonDouble
+	default:
+		return auraPerRoll, auraReasonRoll
+	}
+}
+
+// creditRollAura credits the roller with the AURA their roll earned
+func creditRollAura(state *models.MatchState, action *models.GameAction, roll *models.DiceRoll) models.AuraTransaction {
+	amount, reason := rollAura(roll)
+	return recordAura(state, action, roll.PlayerID, amount, reason, "")
+}
@@ -0,0 +1,68 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+func TestCreditRollAura(t *testing.T) {
+	tests := []struct {
+		name   string
+		dice   [2]int
+		amount int
+		reason string
+	}{
+		{name: "plain roll", dice: [2]int{2, 5}, amount: auraPerRoll, reason: auraReasonRoll},
+		{name: "double", dice: [2]int{4, 4}, amount: auraPerDouble, reason: auraReasonDouble},
+		{name: "snake eyes", dice: [2]int{1, 1}, amount: auraPerDouble, reason: auraReasonSnakeEyes},
+	}
+
+	at := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	state := &models.MatchState{TurnNumber: 3}
+	balance := 0
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action := &models.GameAction{Type: "roll_dice", PlayerID: "a", Timestamp: at}
+			roll := &models.DiceRoll{PlayerID: "a", Dice1: tt.dice[0], Dice2: tt.dice[1], IsDouble: tt.dice[0] == tt.dice[1]}
+			creditRollAura(state, action, roll)
+
+			balance += tt.amount
+			if len(action.AuraTransactions) != 1 {
+				t.Fatalf("ledger has %d entries, want 1", len(action.AuraTransactions))
+			}
+			want := models.AuraTransaction{PlayerID: "a", Amount: tt.amount, Reason: tt.reason, Balance: balance, TurnNumber: 3, Timestamp: at}
+			if got := action.AuraTransactions[0]; got != want {
+				t.Errorf("ledger entry = %+v, want %+v", got, want)
+			}
+			if got := auraBalance(state, "a"); got != balance {
+				t.Errorf("balance = %d, want %d", got, balance)
+			}
+		})
+	}
+}
+
+func TestSpendAura(t *testing.T) {
+	state := &models.MatchState{Aura: map[string]int{"a": 3}}
+
+	overspend := &models.GameAction{Type: "use_ability", PlayerID: "a"}
+	if _, err := spendAura(state, overspend, "a", 4, abilityReasonUse, abilityPanSlap); err == nil {
+		t.Fatal("spendAura() accepted a spend beyond the balance")
+	}
+	if state.Aura["a"] != 3 || len(overspend.AuraTransactions) != 0 {
+		t.Errorf("rejected spend left balance %d and %d ledger entries, want 3 and none", state.Aura["a"], len(overspend.AuraTransactions))
+	}
+
+	spend := &models.GameAction{Type: "use_ability", PlayerID: "a"}
+	transaction, err := spendAura(state, spend, "a", 3, abilityReasonUse, abilityPanSlap)
+	if err != nil {
+		t.Fatalf("spendAura() failed: %v", err)
+	}
+	if transaction.Amount != -3 || transaction.Balance != 0 || transaction.Source != abilityPanSlap {
+		t.Errorf("ledger entry = %+v, want -3 from %s leaving 0", transaction, abilityPanSlap)
+	}
+	if state.Aura["a"] != 0 || len(spend.AuraTransactions) != 1 {
+		t.Errorf("spend left balance %d and %d ledger entries, want 0 and 1", state.Aura["a"], len(spend.AuraTransactions))
+	}
+}
@@ -0,0 +1,931 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+// Bot difficulties
+const (
+	botEasy   = "easy"
+	botMedium = "medium"
+	botHard   = "hard"
+	botExpert = "expert"
+	// botAuto plays at the difficulty rated nearest the match's human players
+	botAuto = "auto"
+)
+
+// Bot think time tuning
+const (
+	// botHesitation is how much longer a coin flip decision takes than an obvious one
+	botHesitation = 1.0
+	// botThinkJitter is the spread of the lognormal jitter on every think time
+	botThinkJitter = 0.3
+	// botThinkShare is the most of the time left on the clock a bot spends thinking
+	botThinkShare = 0.5
+)
+
+// Bot ability tuning
+const (
+	// botSlapTurnScore is the opponent turn score worth a Pan Slap in modes that forfeit it
+	botSlapTurnScore = 10
+	// botSiphonBank is the opponent bank worth a Siphon
+	botSiphonBank = 12
+	// botThreatMargin is how close to the target an opponent is before an
+	// aggressive bot stops banking short of the win
+	botThreatMargin = 15
+	// botClearGain is the expected gain, in points, that makes a bank or roll obvious
+	botClearGain = 4.0
+)
+
+// errInvalidBots is returned when a match asks for bots it cannot seat
+var errInvalidBots = errors.New("invalid bots")
+
+// botLevel tunes how well a bot difficulty plays
+type botLevel struct {
+	ID string
+	// TargetRating is the rating the difficulty is tuned to play at, and the
+	// rating humans are rated against when they play it
+	TargetRating int
+	// Level and Loadout are the progression the bot plays with
+	Level   int
+	Loadout []string
+	// HoldAt banks once the turn score reaches it; 0 weighs every roll on its expected value
+	HoldAt int
+	// Lookahead is how many rolls ahead Zero Hour is searched
+	Lookahead int
+	// Aggressive keeps rolling for the win once an opponent is close to finishing
+	Aggressive bool
+	// Blunder is the chance of rolling instead of banking, or the other way round
+	Blunder float64
+	// AbilityRate is the chance of using an ability when one is worth using
+	AbilityRate float64
+	// ThinkMin and ThinkMax bound the usual time taken over a move
+	ThinkMin time.Duration
+	ThinkMax time.Duration
+}
+
+// botLevels lists the bot difficulties, easiest first
+var botLevels = []*botLevel{
+	{
+		ID:           botEasy,
+		TargetRating: 800,
+		Level:        1,
+		HoldAt:       12,
+		Lookahead:    1,
+		Blunder:      0.2,
+		ThinkMin:     1200 * time.Millisecond,
+		ThinkMax:     3 * time.Second,
+	},
+	{
+		ID:           botMedium,
+		TargetRating: 1200,
+		Level:        1,
+		Loadout:      []string{abilityLuckTurner},
+		HoldAt:       20,
+		Lookahead:    2,
+		Blunder:      0.08,
+		AbilityRate:  0.5,
+		ThinkMin:     900 * time.Millisecond,
+		ThinkMax:     2400 * time.Millisecond,
+	},
+	{
+		ID:           botHard,
+		TargetRating: 1600,
+		Level:        3,
+		Loadout:      []string{abilityLuckTurner, abilitySiphon},
+		Lookahead:    3,
+		Blunder:      0.03,
+		AbilityRate:  0.85,
+		ThinkMin:     700 * time.Millisecond,
+		ThinkMax:     2 * time.Second,
+	},
+	{
+		ID:           botExpert,
+		TargetRating: 2000,
+		Level:        10,
+		Loadout:      []string{abilityLuckTurner, abilityPanSlap, abilitySiphon},
+		Lookahead:    4,
+		Aggressive:   true,
+		AbilityRate:  1,
+		ThinkMin:     600 * time.Millisecond,
+		ThinkMax:     1800 * time.Millisecond,
+	},
+}
+
+// botLevelFor returns the tuning of a bot difficulty
+func botLevelFor(difficulty string) (*botLevel, bool) {
+	for _, level := range botLevels {
+		if level.ID == difficulty {
+			return level, true
+		}
+	}
+	return nil, false
+}
+
+// BotLoadout returns the abilities a bot difficulty plays when given none
+func BotLoadout(difficulty string) ([]string, bool) {
+	level, ok := botLevelFor(difficulty)
+	if !ok {
+		return nil, false
+	}
+	return level.Loadout, true
+}
+
+// botLevelForRating returns the difficulty whose target rating is nearest a rating
+func botLevelForRating(rating int) *botLevel {
+	nearest := botLevels[0]
+	for _, level := range botLevels[1:] {
+		if abs(level.TargetRating-rating) < abs(nearest.TargetRating-rating) {
+			nearest = level
+		}
+	}
+	return nearest
+}
+
+// abs returns the absolute value of n
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// progression is what the bot's loadout is checked against. Bots have every
+// ability unlocked, so only the star budget of their level limits them.
+func (l *botLevel) progression(abilities []string) *models.UserProgression {
+	return &models.UserProgression{
+		Level:             l.Level,
+		UnlockedAbilities: abilities,
+	}
+}
+
+// seatBot marks a match seat as played by a bot of the given difficulty,
+// rated at the difficulty's target
+func seatBot(player *models.MatchPlayer, difficulty string) {
+	player.IsBot = true
+	player.BotDifficulty = difficulty
+	if level, ok := botLevelFor(difficulty); ok {
+		player.EloRating = level.TargetRating
+	}
+}
+
+// matchHumans returns the players of a new match who are not bots
+func matchHumans(match *models.Match) []string {
+	humans := make([]string, 0, len(match.Players))
+	for _, playerID := range match.Players {
+		if _, bot := match.Bots[playerID]; !bot {
+			humans = append(humans, playerID)
+		}
+	}
+	return humans
+}
+
+// humanPlayers returns the players of a match who are not bots
+func humanPlayers(state *models.MatchState) []string {
+	humans := make([]string, 0, len(state.Players))
+	for _, playerID := range state.Players {
+		if !state.PlayerData[playerID].IsBot {
+			humans = append(humans, playerID)
+		}
+	}
+	return humans
+}
+
+// resolveBots checks a new match's bot seats and settles the difficulty of
+// each. Bots on auto play at the difficulty rated nearest the humans' average
+// rating in the mode.
+func resolveBots(match *models.Match, users map[string]*models.User) (map[string]string, error) {
+	if len(match.Bots) == 0 {
+		return nil, nil
+	}
+
+	rating := defaultEloRating
+	if len(users) > 0 {
+		total := 0
+		for _, user := range users {
+			total += eloRating(&user.Stats, match.GameMode)
+		}
+		rating = total / len(users)
+	}
+
+	bots := make(map[string]string, len(match.Bots))
+	for playerID, difficulty := range match.Bots {
+		if !containsString(match.Players, playerID) {
+			return nil, fmt.Errorf("%w: %s is not in the match", errInvalidBots, playerID)
+		}
+		if difficulty == botAuto {
+			difficulty = botLevelForRating(rating).ID
+		}
+		if _, ok := botLevelFor(difficulty); !ok {
+			return nil, fmt.Errorf("%w: unknown difficulty %q for %s", errInvalidBots, difficulty, playerID)
+		}
+		bots[playerID] = difficulty
+	}
+	return bots, nil
+}
+
+// BotStrategy decides between rolling on and banking for a game mode
+type BotStrategy interface {
+	// ShouldBank reports whether the bot banks its turn score rather than
+	// rolling again, and how clear cut the choice is, from 0 for a coin flip
+	// to 1 for obvious
+	ShouldBank(view *botView) (bool, float64)
+}
+
+// botStrategies holds the strategy for each game mode
+var botStrategies = map[string]BotStrategy{
+	models.GameModeClassic:    bankingStrategy{},
+	models.GameModeQuickfire:  bankingStrategy{},
+	models.GameModeBlitz:      bankingStrategy{},
+	models.GameModeTournament: bankingStrategy{},
+	models.GameModeCustom:     bankingStrategy{},
+	models.GameModeZeroHour:   zeroHourStrategy{},
+	models.GameModeLastLine:   rollingStrategy{},
+	models.GameModeTrueGrit:   rollingStrategy{},
+}
+
+// botStrategyFor returns the strategy for a game mode. Modes without one
+// play as the classic family does.
+func botStrategyFor(modeID string) BotStrategy {
+	if strategy, ok := botStrategies[modeID]; ok {
+		return strategy
+	}
+	return bankingStrategy{}
+}
+
+// botView is the match as a bot sees it when choosing a move
+type botView struct {
+	state    *models.MatchState
+	rules    GameModeRules
+	playerID string
+	level    *botLevel
+}
+
+// outcomes lists the rolls the bot could make next, with the Luck Turner
+// reweighting when it is active
+func (v *botView) outcomes() []rollOutcome {
+	weights := fairDiceWeights
+	if v.state.Fairness != nil {
+		weights = v.state.Fairness.DiceWeights
+	}
+	if findEffect(v.state, abilityLuckTurner, v.playerID) >= 0 {
+		weights = scaleSingleOne(weights, luckTurnerSingleOneFactor)
+	}
+	return rollOutcomes(weights)
+}
+
+// countsDown reports whether scores in a mode count down to the target
+func countsDown(config ModeConfig) bool {
+	return config.StartingScore > config.TargetScore
+}
+
+// rollOutcome is one unordered roll of two dice and its chance
+type rollOutcome struct {
+	dice1  int
+	dice2  int
+	chance float64
+}
+
+// rollOutcomes lists every roll of two dice with the given face weights
+func rollOutcomes(weights [6]float64) []rollOutcome {
+	total := 0.0
+	for _, weight := range weights {
+		total += weight
+	}
+	if total <= 0 {
+		weights, total = fairDiceWeights, 6
+	}
+
+	outcomes := make([]rollOutcome, 0, 21)
+	for dice1 := 1; dice1 <= 6; dice1++ {
+		for dice2 := dice1; dice2 <= 6; dice2++ {
+			chance := weights[dice1-1] * weights[dice2-1] / (total * total)
+			if dice1 != dice2 {
+				chance *= 2
+			}
+			outcomes = append(outcomes, rollOutcome{dice1: dice1, dice2: dice2, chance: chance})
+		}
+	}
+	return outcomes
+}
+
+// simulateRoll applies a roll to next, reset to a copy of the state, through
+// the mode's own rules. Searches reuse next across rolls to save allocating.
+func simulateRoll(rules GameModeRules, next, state *models.MatchState, playerID string, outcome rollOutcome) *models.GameActionResult {
+	resetTurnState(next, state)
+	return rules.ProcessRoll(next, &models.DiceRoll{
+		PlayerID: playerID,
+		Dice1:    outcome.dice1,
+		Dice2:    outcome.dice2,
+		Total:    outcome.dice1 + outcome.dice2,
+		IsDouble: outcome.dice1 == outcome.dice2,
+	})
+}
+
+// copyTurnState copies the parts of a state that rolls and banks change
+func copyTurnState(state *models.MatchState) *models.MatchState {
+	next := &models.MatchState{}
+	resetTurnState(next, state)
+	return next
+}
+
+// resetTurnState makes next a copy of the state, reusing next's maps
+func resetTurnState(next, state *models.MatchState) {
+	scores, multipliers, modeData := next.Scores, next.Multipliers, next.GameModeData
+	*next = *state
+
+	if scores == nil {
+		scores = make(map[string]int, len(state.Scores))
+	}
+	clear(scores)
+	for playerID, score := range state.Scores {
+		scores[playerID] = score
+	}
+	if multipliers == nil {
+		multipliers = make(map[string]int, len(state.Multipliers))
+	}
+	clear(multipliers)
+	for playerID, multiplier := range state.Multipliers {
+		multipliers[playerID] = multiplier
+	}
+	if modeData == nil {
+		modeData = make(map[string]interface{}, len(state.GameModeData))
+	}
+	clear(modeData)
+	for key, value := range state.GameModeData {
+		modeData[key] = value
+	}
+	next.Scores, next.Multipliers, next.GameModeData = scores, multipliers, modeData
+}
+
+// bankValue is the turn score as banking it would count, with Vital Rush applied
+func bankValue(state *models.MatchState, playerID string) int {
+	if findEffect(state, abilityVitalRush, playerID) >= 0 {
+		return int(float64(state.TurnScore) * vitalRushMultiplier)
+	}
+	return state.TurnScore
+}
+
+// clarity maps how much better one choice is onto 0 for a coin flip to 1 for obvious
+func clarity(margin, clear float64) float64 {
+	return math.Min(1, math.Abs(margin)/clear)
+}
+
+// bankingStrategy plays the modes that count up to a target and bank at will.
+// Weaker bots hold at a fixed turn score; stronger ones roll while the roll
+// is worth more than the bank.
+type bankingStrategy struct{}
+
+// ShouldBank banks the win whenever it is there, then follows the bot's level
+func (bankingStrategy) ShouldBank(view *botView) (bool, float64) {
+	state, playerID := view.state, view.playerID
+	target := view.rules.Config().TargetScore
+	if state.TurnScore == 0 {
+		return false, 1
+	}
+	if state.Scores[playerID]+bankValue(state, playerID) >= target {
+		return true, 1
+	}
+
+	// An opponent about to finish leaves nothing but the win worth playing for
+	if view.level.Aggressive {
+		for _, opponentID := range state.Players {
+			if opponentID != playerID && target-state.Scores[opponentID] <= botThreatMargin {
+				return false, 0.5
+			}
+		}
+	}
+
+	if hold := view.level.HoldAt; hold > 0 {
+		return state.TurnScore >= hold, clarity(float64(state.TurnScore-hold), botClearGain)
+	}
+	gain := expectedRollGain(view)
+	return gain <= 0, clarity(gain, botClearGain)
+}
+
+// expectedRollGain is how many points one more roll is expected to add to
+// banking now
+func expectedRollGain(view *botView) float64 {
+	state, playerID := view.state, view.playerID
+	current := float64(state.Scores[playerID] + bankValue(state, playerID))
+
+	rolled := 0.0
+	next := &models.MatchState{}
+	for _, outcome := range view.outcomes() {
+		result := simulateRoll(view.rules, next, state, playerID, outcome)
+		value := next.Scores[playerID]
+		if !result.TurnOver {
+			value += bankValue(next, playerID)
+		}
+		rolled += outcome.chance * float64(value)
+	}
+	return rolled - current
+}
+
+// rollingStrategy plays the modes where turns end on their own
+type rollingStrategy struct{}
+
+// ShouldBank never banks; there is nothing to bank
+func (rollingStrategy) ShouldBank(view *botView) (bool, float64) {
+	return false, 1
+}
+
+// Zero Hour search tuning
+const (
+	// zeroHourTurnPoints is roughly what a turn takes off the countdown
+	zeroHourTurnPoints = 15.0
+	// zeroHourLanding weighs how hard a remainder is to land exactly
+	zeroHourLanding = 0.1
+	// zeroHourMinLanding stops remainders that cannot be rolled exactly from
+	// counting as hopeless; doubles from opponents move them in time
+	zeroHourMinLanding = 0.01
+	// zeroHourPenaltyWeight is what pushing an opponent back is worth against
+	// moving forward
+	zeroHourPenaltyWeight = 0.5
+	// zeroHourClearTurns is the difference, in turns, that makes a choice obvious
+	zeroHourClearTurns = 0.5
+)
+
+// zeroHourStrategy plays Zero Hour's exact landing with an expectimax search
+// over the rolls ahead. Each remainder is valued by roughly how many turns it
+// takes to finish from, so awkward remainders are steered away from.
+type zeroHourStrategy struct{}
+
+// ShouldBank compares banking, or resetting an overshooting turn, with rolling on
+func (zeroHourStrategy) ShouldBank(view *botView) (bool, float64) {
+	if view.state.TurnScore == 0 {
+		return false, 1
+	}
+	search := newZeroHourSearch(view)
+	turnScore := view.state.TurnScore
+	multiplier := turnMultiplier(view.state, view.playerID)
+	bank := search.bank(turnScore, multiplier, view.level.Lookahead)
+	roll := search.roll(turnScore, multiplier, view.level.Lookahead)
+	return bank >= roll, clarity(bank-roll, zeroHourClearTurns)
+}
+
+// zeroHourNode is a point in the turn the search has valued
+type zeroHourNode struct {
+	turnScore  int
+	multiplier int
+	depth      int
+}
+
+// zeroHourStep is where one roll takes the turn, and how far it pushes the
+// opponents back
+type zeroHourStep struct {
+	chance     float64
+	turnScore  int
+	multiplier int
+	turnOver   bool
+	pushed     int
+}
+
+// zeroHourSearch values the bot's options for the rest of its turn
+type zeroHourSearch struct {
+	view      *botView
+	remaining int
+	outcomes  []rollOutcome
+	// landing holds the chance of rolling each remainder exactly before busting
+	landing []float64
+	memo    map[zeroHourNode]float64
+	// steps holds the rolls from each point in the turn, which do not depend on depth
+	steps map[zeroHourNode][]zeroHourStep
+	// States the rolls are simulated in, reused between points in the turn
+	base    *models.MatchState
+	scratch *models.MatchState
+}
+
+func newZeroHourSearch(view *botView) *zeroHourSearch {
+	s := &zeroHourSearch{
+		view:      view,
+		remaining: view.state.Scores[view.playerID] - view.rules.Config().TargetScore,
+		outcomes:  view.outcomes(),
+		memo:      make(map[zeroHourNode]float64),
+		steps:     make(map[zeroHourNode][]zeroHourStep),
+		base:      &models.MatchState{},
+		scratch:   &models.MatchState{},
+	}
+	if s.remaining < 0 {
+		s.remaining = 0
+	}
+
+	// What each roll adds from a fresh turn, or -1 for a bust
+	fresh := copyTurnState(view.state)
+	fresh.TurnScore = 0
+	delete(fresh.Multipliers, view.playerID)
+	gains := make([]int, len(s.outcomes))
+	next := &models.MatchState{}
+	for i, outcome := range s.outcomes {
+		result := simulateRoll(view.rules, next, fresh, view.playerID, outcome)
+		gains[i] = next.TurnScore
+		if result.TurnOver {
+			gains[i] = -1
+		}
+	}
+
+	s.landing = make([]float64, s.remaining+1)
+	s.landing[0] = 1
+	for points := 1; points <= s.remaining; points++ {
+		for i, outcome := range s.outcomes {
+			if gain := gains[i]; gain > 0 && gain <= points {
+				s.landing[points] += outcome.chance * s.landing[points-gain]
+			}
+		}
+	}
+	return s
+}
+
+// utility values ending the turn with the given remainder, in turns left to finish
+func (s *zeroHourSearch) utility(remaining int) float64 {
+	if remaining == 0 {
+		return 0
+	}
+	landing := zeroHourMinLanding
+	if remaining < len(s.landing) && s.landing[remaining] > landing {
+		landing = s.landing[remaining]
+	}
+	return -(float64(remaining)/zeroHourTurnPoints + zeroHourLanding/landing)
+}
+
+// value is the best of banking and rolling on
+func (s *zeroHourSearch) value(turnScore, multiplier, depth int) float64 {
+	node := zeroHourNode{turnScore: turnScore, multiplier: multiplier, depth: depth}
+	if value, ok := s.memo[node]; ok {
+		return value
+	}
+	value := math.Max(s.bank(turnScore, multiplier, depth), s.roll(turnScore, multiplier, depth))
+	s.memo[node] = value
+	return value
+}
+
+// bank values banking the turn score. An overshoot only resets the turn, which
+// then carries on.
+func (s *zeroHourSearch) bank(turnScore, multiplier, depth int) float64 {
+	switch {
+	case turnScore == 0 && depth > 0:
+		return math.Inf(-1)
+	case turnScore <= s.remaining:
+		return s.utility(s.remaining - turnScore)
+	case depth == 0:
+		return s.utility(s.remaining)
+	default:
+		return s.value(0, 1, depth-1)
+	}
+}
+
+// roll values rolling again, with every push back on the opponents counted in
+func (s *zeroHourSearch) roll(turnScore, multiplier, depth int) float64 {
+	if depth == 0 {
+		return math.Inf(-1)
+	}
+
+	expected := 0.0
+	for _, step := range s.rollSteps(turnScore, multiplier) {
+		value := s.utility(s.remaining)
+		if !step.turnOver {
+			value = s.value(step.turnScore, step.multiplier, depth-1)
+		}
+		value += zeroHourPenaltyWeight * float64(step.pushed) / zeroHourTurnPoints
+		expected += step.chance * value
+	}
+	return expected
+}
+
+// rollSteps plays every roll from a point in the turn through the mode's rules
+func (s *zeroHourSearch) rollSteps(turnScore, multiplier int) []zeroHourStep {
+	node := zeroHourNode{turnScore: turnScore, multiplier: multiplier}
+	if steps, ok := s.steps[node]; ok {
+		return steps
+	}
+
+	state := s.base
+	resetTurnState(state, s.view.state)
+	state.TurnScore = turnScore
+	delete(state.Multipliers, s.view.playerID)
+	if multiplier > 1 {
+		state.Multipliers[s.view.playerID] = multiplier
+	}
+
+	steps := make([]zeroHourStep, len(s.outcomes))
+	next := s.scratch
+	for i, outcome := range s.outcomes {
+		result := simulateRoll(s.view.rules, next, state, s.view.playerID, outcome)
+		steps[i] = zeroHourStep{
+			chance:     outcome.chance,
+			turnScore:  next.TurnScore,
+			multiplier: turnMultiplier(next, s.view.playerID),
+			turnOver:   result.TurnOver,
+		}
+		for _, opponentID := range state.Players {
+			if opponentID != s.view.playerID {
+				steps[i].pushed += next.Scores[opponentID] - state.Scores[opponentID]
+			}
+		}
+	}
+	s.steps[node] = steps
+	return steps
+}
+
+// matchBot plays a bot seat through the same action path as a human player
+type matchBot struct {
+	ge       *GameEngine
+	match    *ActiveMatch
+	playerID string
+	level    *botLevel
+	strategy BotStrategy
+	random   *rand.Rand
+
+	// wake is signalled whenever the match state changes; stop ends the bot
+	wake chan struct{}
+	stop chan struct{}
+
+	// Sequence at which an ability was refused, so the bot plays on without it
+	skipAbilities int64
+}
+
+// startBots starts a player for every bot seat of a match
+func (ge *GameEngine) startBots(activeMatch *ActiveMatch) {
+	state := activeMatch.State
+	for _, playerID := range state.Players {
+		player := state.PlayerData[playerID]
+		if !player.IsBot {
+			continue
+		}
+		level, ok := botLevelFor(player.BotDifficulty)
+		if !ok {
+			ge.logger.Warn("Bot has an unknown difficulty, seat will time out",
+				zap.String("match_id", activeMatch.Match.ID),
+				zap.String("player_id", playerID),
+				zap.String("difficulty", player.BotDifficulty))
+			continue
+		}
+
+		bot := &matchBot{
+			ge:            ge,
+			match:         activeMatch,
+			playerID:      playerID,
+			level:         level,
+			strategy:      botStrategyFor(activeMatch.Rules.Config().ID),
+			random:        rand.New(rand.NewSource(time.Now().UnixNano())),
+			wake:          make(chan struct{}, 1),
+			stop:          make(chan struct{}),
+			skipAbilities: -1,
+		}
+		activeMatch.bots = append(activeMatch.bots, bot)
+		bot.wake <- struct{}{}
+		go bot.run()
+	}
+}
+
+// wakeBots tells the match's bots the state has changed
+func (am *ActiveMatch) wakeBots() {
+	for _, bot := range am.bots {
+		select {
+		case bot.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// stopBots stops the match's bots
+func (am *ActiveMatch) stopBots() {
+	for _, bot := range am.bots {
+		close(bot.stop)
+	}
+}
+
+// run plays whenever the match state changes, until the bot is stopped
+func (b *matchBot) run() {
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-b.wake:
+			b.play()
+		}
+	}
+}
+
+// play makes moves until the bot has nothing left to do for now
+func (b *matchBot) play() {
+	for {
+		action, wait := b.nextMove()
+		if action == nil {
+			return
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-b.stop:
+			return
+		}
+
+		// The match may have moved on while the bot was thinking
+		if b.sequence() != action.ExpectedVersion {
+			continue
+		}
+
+		if _, err := b.ge.ProcessGameAction(b.match.Match.ID, action); err != nil {
+			b.ge.logger.Debug("Bot action rejected",
+				zap.String("match_id", b.match.Match.ID),
+				zap.String("player_id", b.playerID),
+				zap.String("action_type", action.Type),
+				zap.Error(err))
+			if action.Type != "use_ability" {
+				return
+			}
+			b.skipAbilities = action.ExpectedVersion
+		}
+	}
+}
+
+// sequence returns the sequence of the match's last event
+func (b *matchBot) sequence() int64 {
+	b.match.mutex.RLock()
+	defer b.match.mutex.RUnlock()
+
+	return b.match.State.Sequence
+}
+
+// nextMove picks the bot's next action, if it has one, and how long to think over it
+func (b *matchBot) nextMove() (*models.GameAction, time.Duration) {
+	am := b.match
+	am.mutex.RLock()
+	defer am.mutex.RUnlock()
+
+	state := am.State
+	if state.Status != "active" || state.CompletedAt != nil || state.Pause != nil {
+		return nil, 0
+	}
+
+	actionType, data, certainty := b.decide(&botView{
+		state:    state,
+		rules:    am.Rules,
+		playerID: b.playerID,
+		level:    b.level,
+	})
+	if actionType == "" {
+		return nil, 0
+	}
+
+	id := fmt.Sprintf("bot_%s_%d_%s", b.playerID, state.Sequence, actionType)
+	if abilityID, ok := data["ability_id"].(string); ok {
+		id += "_" + abilityID
+	}
+	return &models.GameAction{
+		ID:              id,
+		MatchID:         am.Match.ID,
+		PlayerID:        b.playerID,
+		Type:            actionType,
+		Data:            data,
+		Timestamp:       time.Now(),
+		ExpectedVersion: state.Sequence,
+	}, b.thinkTime(certainty, am.TurnDeadline)
+}
+
+// decide chooses the bot's move: the turn decider call, an ability worth
+// using, then rolling or banking on its own turn
+func (b *matchBot) decide(view *botView) (string, map[string]interface{}, float64) {
+	state := view.state
+	switch state.Phase {
+	case models.MatchPhaseTurnDecider:
+		decider := state.TurnDecider
+		if decider == nil || decider.ChooserID != b.playerID || decider.Choice != "" {
+			return "", nil, 0
+		}
+		choice := parityOdd
+		if b.random.Intn(2) == 0 {
+			choice = parityEven
+		}
+		return "choose_parity", map[string]interface{}{"parity": choice}, 0
+	case models.MatchPhaseActive:
+	default:
+		return "", nil, 0
+	}
+
+	if state.Sequence != b.skipAbilities {
+		if abilityID := b.chooseAbility(view); abilityID != "" {
+			return "use_ability", map[string]interface{}{"ability_id": abilityID}, 1
+		}
+	}
+	if state.CurrentTurn != b.playerID {
+		return "", nil, 0
+	}
+
+	if state.TurnScore == 0 || !canBank(view.rules, state) {
+		return "roll_dice", nil, 1
+	}
+	bank, certainty := b.strategy.ShouldBank(view)
+	if b.random.Float64() < b.level.Blunder {
+		bank = !bank
+	}
+	if bank {
+		return "bank", nil, certainty
+	}
+	return "roll_dice", nil, certainty
+}
+
+// chooseAbility picks an ability from the bot's loadout worth using now, or "" for none
+func (b *matchBot) chooseAbility(view *botView) string {
+	if b.level.AbilityRate == 0 {
+		return ""
+	}
+
+	state := view.state
+	for _, abilityID := range state.PlayerData[b.playerID].Loadout.Abilities {
+		ability, ok := b.ge.abilities.Get(abilityID)
+		if !ok || !canUseAbility(state, ability, b.playerID) || !worthUsing(view, ability) {
+			continue
+		}
+		if b.random.Float64() < b.level.AbilityRate {
+			return abilityID
+		}
+	}
+	return ""
+}
+
+// canUseAbility reports whether the engine would accept a player using an ability now
+func canUseAbility(state *models.MatchState, ability *Ability, playerID string) bool {
+	if !inTimingWindow(state, playerID, ability.Timing) {
+		return false
+	}
+	uses := state.AbilityUses[playerID][ability.ID]
+	if ability.MaxUses > 0 && uses >= ability.MaxUses {
+		return false
+	}
+	if findEffect(state, ability.ID, playerID) >= 0 || auraBalance(state, playerID) < ability.Cost(uses) {
+		return false
+	}
+	targetID, err := ability.Target(state, playerID)
+	if err != nil {
+		return false
+	}
+
+	// Spending an ability on a Hard Hat is a waste
+	return targetID == playerID || findEffect(state, abilityHardHat, targetID) < 0
+}
+
+// worthUsing reports whether an ability helps the bot at this point of the match
+func worthUsing(view *botView, ability *Ability) bool {
+	state, playerID := view.state, view.playerID
+	config := view.rules.Config()
+
+	switch ability.ID {
+	case abilityLuckTurner, abilityAuraForge:
+		return true
+	case abilityVitalRush:
+		return !countsDown(config) && canBank(view.rules, state)
+	case abilityPanSlap:
+		// Ending a turn only hurts when the turn score would be lost, or
+		// overshoots the countdown
+		opponentID := state.CurrentTurn
+		if countsDown(config) {
+			return state.TurnScore > state.Scores[opponentID]-config.TargetScore
+		}
+		return !canBank(view.rules, state) && state.TurnScore >= botSlapTurnScore
+	case abilitySiphon:
+		// Taking points back from a countdown only sets the bot back
+		bank, _ := lastBank(state)
+		return !countsDown(config) && intSetting(bank.StateChanges, "scoreChange", 0) >= botSiphonBank
+	case abilityHardHat:
+		for _, opponentID := range state.Players {
+			if opponentID == playerID {
+				continue
+			}
+			opponent := state.PlayerData[opponentID]
+			if hasEquipped(opponent, abilityPanSlap) && state.AbilityUses[opponentID][abilityPanSlap] == 0 {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+// thinkTime is how long the bot takes over a move: a random time in its
+// level's range, longer for close calls, jittered so the rhythm is not
+// mechanical, and never long enough to run out the clock
+func (b *matchBot) thinkTime(certainty float64, deadline time.Time) time.Duration {
+	level := b.level
+	think := float64(level.ThinkMin) + b.random.Float64()*float64(level.ThinkMax-level.ThinkMin)
+	think *= 1 + botHesitation*(1-certainty)
+	think *= math.Exp(b.random.NormFloat64() * botThinkJitter)
+
+	if limit := float64(time.Until(deadline)) * botThinkShare; think > limit {
+		think = limit
+	}
+	if think < 0 {
+		return 0
+	}
+	return time.Duration(think)
+}
@@ -0,0 +1,50 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+func TestShouldBank(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       string
+		difficulty string
+		score      int
+		opponent   int
+		turnScore  int
+		bank       bool
+		// certainty is left unchecked at 0, for close calls that follow the search tuning
+		certainty float64
+	}{
+		{name: "nothing to bank", mode: models.GameModeClassic, difficulty: botMedium, score: 90, turnScore: 0, certainty: 1},
+		{name: "win available below the hold", mode: models.GameModeClassic, difficulty: botMedium, score: 90, turnScore: 10, bank: true, certainty: 1},
+		{name: "win available with the opponent close", mode: models.GameModeClassic, difficulty: botExpert, score: 90, opponent: 95, turnScore: 10, bank: true, certainty: 1},
+		{name: "opponent close rolls for the win", mode: models.GameModeClassic, difficulty: botExpert, score: 40, opponent: 90, turnScore: 30, certainty: 0.5},
+		{name: "hold reached", mode: models.GameModeClassic, difficulty: botMedium, score: 20, turnScore: 24, bank: true, certainty: 1},
+		{name: "short of the hold", mode: models.GameModeClassic, difficulty: botMedium, score: 20, turnScore: 18, certainty: 0.5},
+		{name: "exact landing banks", mode: models.GameModeZeroHour, difficulty: botExpert, score: 57, opponent: 200, turnScore: 57, bank: true, certainty: 1},
+		{name: "overshoot resets", mode: models.GameModeZeroHour, difficulty: botExpert, score: 10, opponent: 200, turnScore: 30, bank: true},
+		{name: "nothing to bank in zero hour", mode: models.GameModeZeroHour, difficulty: botExpert, score: 57, opponent: 200, turnScore: 0, certainty: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, state := newModeMatch(t, tt.mode, nil, "a", "b")
+			state.Scores["a"] = tt.score
+			state.Scores["b"] = tt.opponent
+			state.TurnScore = tt.turnScore
+			level, _ := botLevelFor(tt.difficulty)
+			view := &botView{state: state, rules: rules, playerID: "a", level: level}
+
+			bank, certainty := botStrategyFor(tt.mode).ShouldBank(view)
+			if bank != tt.bank {
+				t.Errorf("ShouldBank() banks = %v, want %v", bank, tt.bank)
+			}
+			if tt.certainty != 0 && certainty != tt.certainty {
+				t.Errorf("ShouldBank() certainty = %v, want %v", certainty, tt.certainty)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package engine
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+// Decisions a turn clock can be running for
+const (
+	decisionChooseParity = "choose_parity"
+	decisionRoll         = "roll"
+	decisionBank         = "bank"
+)
+
+// BankingRules is implemented by game modes that restrict when the current player may bank
+type BankingRules interface {
+	CanBank(state *models.MatchState) bool
+}
+
+// canBank reports whether the current player may bank, deferring to the mode
+// when it restricts banking. Otherwise any turn score can be banked.
+func canBank(rules GameModeRules, state *models.MatchState) bool {
+	if banking, ok := rules.(BankingRules); ok {
+		return banking.CanBank(state)
+	}
+	return state.TurnScore > 0
+}
+
+// TimeoutRules is implemented by game modes that decide for themselves what is
+// done for a player whose clock runs out. turnOver is set once the whole turn
+// is up, when the action must end the turn.
+type TimeoutRules interface {
+	TimeoutAction(state *models.MatchState, turnOver bool) string
+}
+
+// seconds converts a whole-seconds setting to a duration
+func seconds(value int) time.Duration {
+	return time.Duration(value) * time.Second
+}
+
+// applyClockSettings copies the mode's turn clocks into the match settings,
+// keeping the match defaults for any the mode leaves unset
+func applyClockSettings(settings *models.MatchSettings, config ModeConfig) {
+	if config.TurnTime > 0 {
+		settings.TimeLimit = int(config.TurnTime / time.Second)
+	}
+	if config.RollTime > 0 {
+		settings.RollTimeLimit = int(config.RollTime / time.Second)
+	}
+	if config.BankTime > 0 {
+		settings.BankTimeLimit = int(config.BankTime / time.Second)
+	}
+}
+
+// startDeciderClock runs the clock for the turn decider call
+func startDeciderClock(activeMatch *ActiveMatch, deadline time.Time) {
+	activeMatch.State.TurnClock = &models.TurnClock{
+		Decision:   decisionChooseParity,
+		Deadline:   deadline,
+		TurnEndsAt: deadline,
+	}
+	activeMatch.TurnDeadline = deadline
+}
+
+// startTurnClock starts the clock for a turn beginning at the given time
+func startTurnClock(activeMatch *ActiveMatch, at time.Time) {
+	// A player on a time bank has no limit on the turn beyond their clock
+	clock := &models.TurnClock{}
+	_, banked := flagTime(activeMatch.State)
+	if limit := activeMatch.State.Settings.TimeLimit; limit > 0 && !banked {
+		clock.TurnEndsAt = at.Add(seconds(limit))
+	}
+	activeMatch.State.TurnClock = clock
+	setDecisionClock(activeMatch, at)
+}
+
+// setDecisionClock times the decision the current player faces as of the
+// given time: rolling when they must, banking when they may. No decision may
+// run past the end of the turn, and a player on a time bank has until their
+// flag falls.
+func setDecisionClock(activeMatch *ActiveMatch, at time.Time) {
+	state := activeMatch.State
+	clock := state.TurnClock
+	if clock == nil {
+		startTurnClock(activeMatch, at)
+		return
+	}
+
+	decision, limit := decisionRoll, state.Settings.RollTimeLimit
+	if canBank(activeMatch.Rules, state) {
+		decision, limit = decisionBank, state.Settings.BankTimeLimit
+	}
+
+	deadline := clock.TurnEndsAt
+	if flag, banked := flagTime(state); banked {
+		deadline = flag
+	} else if limit > 0 {
+		deadline = at.Add(seconds(limit))
+		if !clock.TurnEndsAt.IsZero() && deadline.After(clock.TurnEndsAt) {
+			deadline = clock.TurnEndsAt
+		}
+	}
+	if deadline.IsZero() {
+		deadline = at.Add(activeMatch.Rules.Config().TurnTime)
+	}
+
+	clock.Decision = decision
+	clock.Deadline = deadline
+	activeMatch.TurnDeadline = deadline
+}
+
+// timeoutAction is the action taken for a player whose clock ran out,
+// deferring to the mode when it has its own policy. Otherwise the pending
+// decision is made for them, and once the whole turn is up it ends.
+func timeoutAction(activeMatch *ActiveMatch, now time.Time) string {
+	clock := activeMatch.State.TurnClock
+	turnOver := clock != nil && !clock.TurnEndsAt.IsZero() && !now.Before(clock.TurnEndsAt)
+	if policy, ok := activeMatch.Rules.(TimeoutRules); ok {
+		return policy.TimeoutAction(activeMatch.State, turnOver)
+	}
+	bank := canBank(activeMatch.Rules, activeMatch.State)
+
+	switch {
+	case turnOver:
+		if bank {
+			return "bank"
+		}
+		return "end_turn"
+	case bank:
+		return "bank"
+	default:
+		return "roll_dice"
+	}
+}
+
+// turnTimeoutAction is the move the engine makes for whoever's clock ran out
+func turnTimeoutAction(activeMatch *ActiveMatch, now time.Time) *models.GameAction {
+	if activeMatch.GamePhase == models.MatchPhaseTurnDecider {
+		return parityTimeoutAction(activeMatch, now)
+	}
+
+	return &models.GameAction{
+		ID:        fmt.Sprintf("timeout_%d", now.UnixNano()),
+		MatchID:   activeMatch.Match.ID,
+		PlayerID:  activeMatch.State.CurrentTurn,
+		Type:      timeoutAction(activeMatch, now),
+		Timestamp: now,
+		Data:      map[string]interface{}{"reason": "timeout"},
+	}
+}
+
+// isTimeout reports whether the engine took an action for a player whose clock ran out
+func isTimeout(action *models.GameAction) bool {
+	reason, _ := action.Data["reason"].(string)
+	return reason == "timeout"
+}
@@ -0,0 +1,220 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+// defaultReconnectGrace is how long each player may spend disconnected over a whole match
+const defaultReconnectGrace = 60 * time.Second
+
+// errPlayerNotInMatch is returned for connection changes of players outside the match
+var errPlayerNotInMatch = errors.New("player not in match")
+
+// pauseData is the turn clock carried by disconnect and resuming reconnect events
+type pauseData struct {
+	TurnTimeLeftMs int64 `json:"turn_time_left_ms"`
+}
+
+// PlayerDisconnected records that a player's connection to a match dropped
+func (ge *GameEngine) PlayerDisconnected(matchID, playerID string) error {
+	return ge.queueConnectionEvent(matchID, playerID, eventDisconnect)
+}
+
+// PlayerReconnected records that a disconnected player is back
+func (ge *GameEngine) PlayerReconnected(matchID, playerID string) error {
+	return ge.queueConnectionEvent(matchID, playerID, eventReconnect)
+}
+
+// queueConnectionEvent hands a connection change to the match's processing loop
+func (ge *GameEngine) queueConnectionEvent(matchID, playerID, eventType string) error {
+	activeMatch, exists := ge.GetMatch(matchID)
+	if !exists {
+		return fmt.Errorf("%w: %s", errMatchNotFound, matchID)
+	}
+	activeMatch.mutex.RLock()
+	_, inMatch := activeMatch.State.PlayerData[playerID]
+	activeMatch.mutex.RUnlock()
+	if !inMatch {
+		return fmt.Errorf("%w: %s", errPlayerNotInMatch, playerID)
+	}
+
+	now := time.Now()
+	action := &models.GameAction{
+		ID:        fmt.Sprintf("%s_%s_%d", eventType, playerID, now.UnixNano()),
+		MatchID:   matchID,
+		PlayerID:  playerID,
+		Type:      eventType,
+		Timestamp: now,
+		Data:      make(map[string]interface{}),
+	}
+
+	select {
+	case activeMatch.UpdateChan <- action:
+		return nil
+	default:
+		return errActionQueueFull
+	}
+}
+
+// matchInPlay reports whether the match has started and not yet ended
+func matchInPlay(activeMatch *ActiveMatch) bool {
+	return activeMatch.GamePhase == models.MatchPhaseTurnDecider || activeMatch.GamePhase == models.MatchPhaseActive
+}
+
+// handleDisconnect starts a player's reconnect clock and pauses play if the match allows it
+func (ge *GameEngine) handleDisconnect(activeMatch *ActiveMatch, action *models.GameAction) error {
+	state := activeMatch.State
+	player, ok := state.PlayerData[action.PlayerID]
+	if !ok {
+		return fmt.Errorf("player not in match: %s", action.PlayerID)
+	}
+	if !player.IsConnected {
+		return fmt.Errorf("player is already disconnected: %s", action.PlayerID)
+	}
+
+	// Without reconnects, the grace period is over as soon as it starts
+	at := action.Timestamp
+	deadline := at
+	if state.Settings.AllowReconnect {
+		deadline = at.Add(time.Duration(player.ReconnectGraceMs) * time.Millisecond)
+	}
+	player.IsConnected = false
+	player.LastSeen = at
+	player.DisconnectedAt = &at
+	player.ReconnectDeadline = &deadline
+	state.PlayerData[action.PlayerID] = player
+
+	result := &models.GameActionResult{
+		Success: true,
+		Message: fmt.Sprintf("%s disconnected", action.PlayerID),
+		Data:    map[string]interface{}{"reconnect_deadline": deadline},
+	}
+
+	if state.Settings.PauseOnDisconnect && state.Pause == nil && matchInPlay(activeMatch) {
+		// The turn clock stops where it is and restarts from there on resume
+		if !activeMatch.replaying {
+			left := activeMatch.TurnDeadline.Sub(at)
+			if left < 0 {
+				left = 0
+			}
+			action.Data["turn_time_left_ms"] = left.Milliseconds()
+		}
+		var paused pauseData
+		if err := decodeSettings(action.Data, &paused); err != nil {
+			return fmt.Errorf("invalid %s event: %w", eventDisconnect, err)
+		}
+
+		state.Pause = &models.MatchPause{
+			PausedAt:       at,
+			TurnTimeLeftMs: paused.TurnTimeLeftMs,
+		}
+		state.Status = "paused"
+		stopTimeBank(state, at)
+		result.Data["paused"] = true
+	}
+
+	appendEvent(state, action, result)
+	return nil
+}
+
+// handleReconnect charges a returning player's time away to their grace and
+// resumes play once every disconnected player is back
+func (ge *GameEngine) handleReconnect(activeMatch *ActiveMatch, action *models.GameAction) error {
+	state := activeMatch.State
+	player, ok := state.PlayerData[action.PlayerID]
+	if !ok {
+		return fmt.Errorf("player not in match: %s", action.PlayerID)
+	}
+	if player.IsConnected {
+		return fmt.Errorf("player is already connected: %s", action.PlayerID)
+	}
+
+	at := action.Timestamp
+	if at.After(*player.ReconnectDeadline) {
+		return fmt.Errorf("reconnect grace period has expired for %s", action.PlayerID)
+	}
+
+	player.ReconnectGraceMs -= at.Sub(*player.DisconnectedAt).Milliseconds()
+	if player.ReconnectGraceMs < 0 {
+		player.ReconnectGraceMs = 0
+	}
+	player.IsConnected = true
+	player.LastSeen = at
+	player.DisconnectedAt = nil
+	player.ReconnectDeadline = nil
+	state.PlayerData[action.PlayerID] = player
+
+	result := &models.GameActionResult{
+		Success: true,
+		Message: fmt.Sprintf("%s reconnected", action.PlayerID),
+		Data:    map[string]interface{}{"reconnect_grace_ms": player.ReconnectGraceMs},
+	}
+
+	if state.Pause != nil && len(disconnectedPlayers(state)) == 0 {
+		// Clocks carry on from where they stopped
+		left := time.Duration(state.Pause.TurnTimeLeftMs) * time.Millisecond
+		deadline := at.Add(left)
+		activeMatch.TurnDeadline = deadline
+		if clock := state.TurnClock; clock != nil {
+			clock.Deadline = deadline
+			// Wall clock times only, so a replay extends the turn by the same amount
+			if !clock.TurnEndsAt.IsZero() {
+				clock.TurnEndsAt = clock.TurnEndsAt.Add(at.Round(0).Sub(state.Pause.PausedAt.Round(0)))
+			}
+		}
+		if activeMatch.GamePhase == models.MatchPhaseTurnDecider && state.TurnDecider != nil {
+			state.TurnDecider.Deadline = deadline
+		}
+
+		state.Pause = nil
+		state.Status = "active"
+		runTimeBank(activeMatch, at)
+		result.Data["resumed"] = true
+		result.Data["turn_time_left_ms"] = left.Milliseconds()
+	}
+
+	appendEvent(state, action, result)
+	return nil
+}
+
+// disconnectedPlayers lists the players still away, in seating order
+func disconnectedPlayers(state *models.MatchState) []string {
+	away := make([]string, 0)
+	for _, playerID := range state.Players {
+		if !state.PlayerData[playerID].IsConnected {
+			away = append(away, playerID)
+		}
+	}
+	return away
+}
+
+// expiredReconnect returns the first player whose reconnect grace ran out before now
+func expiredReconnect(state *models.MatchState, now time.Time) string {
+	for _, playerID := range disconnectedPlayers(state) {
+		if deadline := state.PlayerData[playerID].ReconnectDeadline; deadline != nil && now.After(*deadline) {
+			return playerID
+		}
+	}
+	return ""
+}
+
+// checkReconnectGrace forfeits the match for a player who stayed away too long,
+// reporting whether the match ended
+func (ge *GameEngine) checkReconnectGrace(activeMatch *ActiveMatch) bool {
+	playerID := expiredReconnect(activeMatch.State, time.Now())
+	if playerID == "" {
+		return false
+	}
+
+	ge.logger.Info("Reconnect grace period expired",
+		zap.String("match_id", activeMatch.Match.ID),
+		zap.String("player_id", playerID))
+	ge.finishMatch(activeMatch, concededMatch(models.WinReasonForfeit, playerID))
+	return true
+}
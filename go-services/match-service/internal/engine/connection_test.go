@@ -0,0 +1,118 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+// connectionEvent builds a connection change made by a player at the given time
+func connectionEvent(eventType, playerID string, at time.Time) *models.GameAction {
+	return &models.GameAction{
+		ID:        eventType + "_" + playerID,
+		MatchID:   "match",
+		PlayerID:  playerID,
+		Type:      eventType,
+		Timestamp: at,
+		Data:      make(map[string]interface{}),
+	}
+}
+
+func TestDisconnectPauseAndResume(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	grace := defaultReconnectGrace.Milliseconds()
+	state := &models.MatchState{
+		ID:          "match",
+		Status:      "active",
+		Players:     []string{"a", "b"},
+		CurrentTurn: "a",
+		TurnNumber:  1,
+		Settings:    models.MatchSettings{AllowReconnect: true, PauseOnDisconnect: true},
+		PlayerData: map[string]models.MatchPlayer{
+			"a": {UserID: "a", IsConnected: true, ReconnectGraceMs: grace},
+			"b": {UserID: "b", IsConnected: true, ReconnectGraceMs: grace},
+		},
+		TurnClock: &models.TurnClock{Decision: decisionRoll, Deadline: start.Add(20 * time.Second)},
+		TimeBanks: newTimeBanks([]string{"a", "b"}, time.Minute, 0),
+	}
+	state.TimeBanks.Running, state.TimeBanks.RunningSince = "a", start
+	activeMatch := &ActiveMatch{
+		Match:        &models.Match{ID: "match", Players: state.Players},
+		State:        state,
+		GamePhase:    models.MatchPhaseActive,
+		TurnDeadline: start.Add(20 * time.Second),
+	}
+	ge := &GameEngine{logger: zap.NewNop()}
+
+	// Play stops with 15s left on the turn and the time bank charged to the drop
+	if err := ge.handleDisconnect(activeMatch, connectionEvent(eventDisconnect, "a", start.Add(5*time.Second))); err != nil {
+		t.Fatalf("handleDisconnect() failed: %v", err)
+	}
+	if state.Pause == nil || state.Pause.TurnTimeLeftMs != 15000 || state.Status != "paused" {
+		t.Fatalf("pause = %+v with status %q, want 15000 ms left and paused", state.Pause, state.Status)
+	}
+	if state.TimeBanks.Running != "" || state.TimeBanks.RemainingMs["a"] != 55000 {
+		t.Errorf("time bank running for %q with %d ms left, want stopped at 55000", state.TimeBanks.Running, state.TimeBanks.RemainingMs["a"])
+	}
+	if want := start.Add(65 * time.Second); !state.PlayerData["a"].ReconnectDeadline.Equal(want) {
+		t.Errorf("reconnect deadline = %v, want %v", state.PlayerData["a"].ReconnectDeadline, want)
+	}
+
+	// 20s away are taken from the grace, and the turn resumes with its 15s
+	back := start.Add(25 * time.Second)
+	if err := ge.handleReconnect(activeMatch, connectionEvent(eventReconnect, "a", back)); err != nil {
+		t.Fatalf("handleReconnect() failed: %v", err)
+	}
+	if state.Pause != nil || state.Status != "active" {
+		t.Errorf("pause = %+v with status %q after reconnect, want resumed", state.Pause, state.Status)
+	}
+	if want := back.Add(15 * time.Second); !activeMatch.TurnDeadline.Equal(want) || !state.TurnClock.Deadline.Equal(want) {
+		t.Errorf("turn deadline = %v, want %v", activeMatch.TurnDeadline, want)
+	}
+	if state.TimeBanks.Running != "a" || !state.TimeBanks.RunningSince.Equal(back) || state.TimeBanks.RemainingMs["a"] != 55000 {
+		t.Errorf("time bank running for %q since %v with %d ms, want a since %v with 55000",
+			state.TimeBanks.Running, state.TimeBanks.RunningSince, state.TimeBanks.RemainingMs["a"], back)
+	}
+	if left := state.PlayerData["a"].ReconnectGraceMs; left != grace-20000 {
+		t.Errorf("reconnect grace = %d ms, want %d", left, grace-20000)
+	}
+
+	// The next drop only gets the grace that is left
+	dropped := start.Add(30 * time.Second)
+	if err := ge.handleDisconnect(activeMatch, connectionEvent(eventDisconnect, "a", dropped)); err != nil {
+		t.Fatalf("handleDisconnect() failed: %v", err)
+	}
+	expires := dropped.Add(time.Duration(grace-20000) * time.Millisecond)
+	if player := expiredReconnect(state, expires); player != "" {
+		t.Errorf("grace of %s expired at the deadline", player)
+	}
+	if player := expiredReconnect(state, expires.Add(time.Millisecond)); player != "a" {
+		t.Errorf("expired grace = %q, want a", player)
+	}
+	if err := ge.handleReconnect(activeMatch, connectionEvent(eventReconnect, "a", expires.Add(time.Second))); err == nil {
+		t.Error("handleReconnect() accepted a return after the grace ran out")
+	}
+}
+
+func TestQueueConnectionEventUnknownPlayer(t *testing.T) {
+	activeMatch := &ActiveMatch{
+		Match:      &models.Match{ID: "match"},
+		State:      &models.MatchState{PlayerData: map[string]models.MatchPlayer{"a": {UserID: "a"}}},
+		UpdateChan: make(chan *models.GameAction, 1),
+	}
+	ge := &GameEngine{logger: zap.NewNop(), activeMatches: map[string]*ActiveMatch{"match": activeMatch}}
+
+	if err := ge.PlayerDisconnected("match", "c"); !errors.Is(err, errPlayerNotInMatch) {
+		t.Errorf("PlayerDisconnected() = %v, want %v", err, errPlayerNotInMatch)
+	}
+	if err := ge.PlayerDisconnected("match", "a"); err != nil {
+		t.Fatalf("PlayerDisconnected() failed: %v", err)
+	}
+	if queued := <-activeMatch.UpdateChan; queued.Type != eventDisconnect || queued.PlayerID != "a" {
+		t.Errorf("queued %s by %q, want a disconnect by a", queued.Type, queued.PlayerID)
+	}
+}
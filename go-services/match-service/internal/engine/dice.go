@@ -0,0 +1,120 @@
+package engine
+
+import (
+	"math"
+)
+
+// DiceSource produces individual die faces for the rules engine
+type DiceSource interface {
+	RollDie() int
+}
+
+// RandomSource supplies uniformly distributed values in [0, 1)
+type RandomSource interface {
+	Float64() float64
+}
+
+// fairDiceWeights gives every face the same probability
+var fairDiceWeights = [6]float64{1, 1, 1, 1, 1, 1}
+
+// WeightedDice rolls a six-sided die with per-face probability weights
+type WeightedDice struct {
+	random  RandomSource
+	weights [6]float64
+	total   float64
+}
+
+// NewWeightedDice creates a die that picks face i+1 with probability weights[i]/sum(weights)
+func NewWeightedDice(random RandomSource, weights [6]float64) *WeightedDice {
+	total := 0.0
+	for i, weight := range weights {
+		if weight < 0 || math.IsNaN(weight) || math.IsInf(weight, 0) {
+			weights[i] = 0
+			continue
+		}
+		total += weight
+	}
+	if total == 0 {
+		weights = fairDiceWeights
+		total = 6
+	}
+
+	return &WeightedDice{
+		random:  random,
+		weights: weights,
+		total:   total,
+	}
+}
+
+// RollDie returns a face between 1 and 6 according to the weights
+func (wd *WeightedDice) RollDie() int {
+	target := wd.random.Float64() * wd.total
+	cumulative := 0.0
+	for i, weight := range wd.weights {
+		cumulative += weight
+		if target < cumulative {
+			return i + 1
+		}
+	}
+
+	// Floating point rounding can leave target just past the last boundary
+	for i := len(wd.weights) - 1; i >= 0; i-- {
+		if wd.weights[i] > 0 {
+			return i + 1
+		}
+	}
+	return 6
+}
+
+// Weights returns the per-face weights of the die
+func (wd *WeightedDice) Weights() [6]float64 {
+	return wd.weights
+}
+
+// singleOneWeights returns face weights that scale the chance of rolling exactly
+// one 1 on two dice by factor, leaving the other faces equally likely
+func singleOneWeights(factor float64) [6]float64 {
+	if factor <= 0 {
+		return fairDiceWeights
+	}
+	return scaleSingleOne(fairDiceWeights, factor)
+}
+
+// scaleSingleOne reweights the 1 face so the chance of rolling exactly one 1 on
+// two dice is scaled by factor, keeping the other faces in proportion.
+// With p the chance of a 1 on one die, P(single 1) = 2p(1-p), so the new p'
+// solves p'(1-p') = factor*p(1-p). Fair dice give p(1-p) = 5/36.
+func scaleSingleOne(weights [6]float64, factor float64) [6]float64 {
+	total := 0.0
+	for _, weight := range weights {
+		total += weight
+	}
+	others := total - weights[0]
+	if total <= 0 || others <= 0 {
+		return weights
+	}
+
+	p := weights[0] / total
+	discriminant := 1 - 4*factor*p*(1-p)
+	if factor < 0 || discriminant <= 0 {
+		return weights
+	}
+
+	scaled := (1 - math.Sqrt(discriminant)) / 2
+	weights[0] = others * scaled / (1 - scaled)
+	return weights
+}
+
+// DiceWeightedRules is implemented by game modes that roll biased dice
+type DiceWeightedRules interface {
+	DiceWeights() [6]float64
+}
+
+// newMatchDice builds the dice for a match, honouring any mode specific weights
+func newMatchDice(random RandomSource, rules GameModeRules) *WeightedDice {
+	weights := fairDiceWeights
+	if weighted, ok := rules.(DiceWeightedRules); ok {
+		weights = weighted.DiceWeights()
+	}
+	return NewWeightedDice(random, weights)
+}
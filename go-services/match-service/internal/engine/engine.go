@@ -0,0 +1,1048 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	
+	"go.uber.org/zap"
+	
+	"github.com/LukeAtkinz/dashdice/go-services/shared/database"
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+// errInvalidMatchConfig is returned for matches that cannot be created as requested
+var errInvalidMatchConfig = errors.New("invalid match configuration")
+
+// GameEngine manages all active matches and game logic
+type GameEngine struct {
+	logger    *zap.Logger
+	dbManager database.DatabaseManager
+	modes     *ModeRegistry
+	abilities *AbilityRegistry
+	
+	// Identity of this replica in match leases
+	instanceID   string
+	instanceAddr string
+	
+	// Active matches
+	activeMatches   map[string]*ActiveMatch
+	matchesMutex    sync.RWMutex
+	
+	// Control channels
+	stopChan        chan bool
+	acceptingMatches bool
+}
+
+// ActiveMatch represents a match currently being processed
+type ActiveMatch struct {
+	Match     *models.Match
+	State     *models.MatchState
+	Players   map[string]*models.User
+	
+	// Game state
+	CurrentTurn   int
+	TurnDeadline  time.Time
+	GamePhase     string
+	Rules         GameModeRules
+	Dice          DiceSource
+	Fairness      *SeededRandom
+	
+	// Communication
+	UpdateChan    chan *models.GameAction
+	StateChan     chan *models.MatchState
+	hub           *MatchHub
+	
+	// Sequence of the last event written to the stored state
+	persistedSequence int64
+	
+	// Outcomes of player actions by ID, and the callers waiting on them
+	outcomes      map[string]*actionOutcome
+	waiters       map[string][]chan *actionOutcome
+	outcomesMutex sync.Mutex
+	
+	// Synchronization
+	mutex         sync.RWMutex
+	lastActivity  time.Time
+	
+	// replaying applies logged events instead of live actions
+	replaying     bool
+	
+	// Players for the match's bot seats
+	bots          []*matchBot
+	
+	// Ownership lease; released is closed when another instance takes the match over
+	leaseRenewedAt time.Time
+	released       chan struct{}
+	releaseOnce    sync.Once
+}
+
+// release stops this instance from running the match without ending it
+func (am *ActiveMatch) release() {
+	am.releaseOnce.Do(func() {
+		close(am.released)
+	})
+}
+
+// NewGameEngine creates a new game engine instance
+func NewGameEngine(logger *zap.Logger, dbManager database.DatabaseManager, instanceID, instanceAddr string) *GameEngine {
+	engine := &GameEngine{
+		logger:          logger,
+		dbManager:       dbManager,
+		instanceID:      instanceID,
+		instanceAddr:    instanceAddr,
+		modes:           defaultModeRegistry(),
+		abilities:       defaultAbilityRegistry(),
+		activeMatches:   make(map[string]*ActiveMatch),
+		stopChan:        make(chan bool),
+		acceptingMatches: true,
+	}
+	
+	// Start background processes
+	go engine.matchProcessingLoop()
+	go engine.leaseLoop()
+	
+	return engine
+}
+
+// CreateMatch creates and starts a new match
+func (ge *GameEngine) CreateMatch(ctx context.Context, matchConfig *models.Match) (*models.Match, error) {
+	if !ge.acceptingMatches {
+		return nil, fmt.Errorf("game engine is shutting down")
+	}
+	
+	// Validate match configuration
+	if err := ge.validateMatchConfig(matchConfig); err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidMatchConfig, err)
+	}
+	
+	// Resolve the rules for the requested game mode
+	rules, err := ge.modes.Rules(matchConfig.GameMode, matchConfig.Settings)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidMatchConfig, err)
+	}
+	modeConfig := rules.Config()
+	if len(matchConfig.Players) < modeConfig.MinPlayers || len(matchConfig.Players) > modeConfig.MaxPlayers {
+		return nil, fmt.Errorf("%w: %s requires %d-%d players",
+			errInvalidMatchConfig, matchConfig.GameMode, modeConfig.MinPlayers, modeConfig.MaxPlayers)
+	}
+	
+	// Bots have no user records; their difficulty is settled against the humans' rating
+	players := ge.loadPlayers(ctx, matchHumans(matchConfig))
+	bots, err := resolveBots(matchConfig, players)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidMatchConfig, err)
+	}
+	matchConfig.Bots = bots
+	
+	// Loadouts are checked against each player's unlocks and star budget, then fixed for the match
+	loadouts, err := ge.validateLoadouts(ctx, matchConfig)
+	if errors.Is(err, errInvalidLoadout) {
+		return nil, fmt.Errorf("%w: %w", errInvalidMatchConfig, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	
+	// Spectating is settled once, from the match type, the host's choice and every player's privacy setting
+	spectating, err := resolveSpectating(matchConfig, players)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidMatchConfig, err)
+	}
+	
+	// Commit to the server seed before any dice are rolled
+	serverSeed, err := newServerSeed()
+	if err != nil {
+		return nil, err
+	}
+	clientSeeds := make(map[string]string, len(matchConfig.Players))
+	for _, playerID := range matchConfig.Players {
+		clientSeeds[playerID] = matchConfig.ClientSeeds[playerID]
+	}
+	fairness := NewSeededRandom(serverSeed, combineClientSeeds(matchConfig.Players, clientSeeds))
+	dice := newMatchDice(fairness, rules)
+	
+	// The create_match event opens the match log with everything needed to replay it
+	created := &matchCreatedEvent{
+		GameMode:       matchConfig.GameMode,
+		GameType:       matchConfig.GameType,
+		Region:         matchConfig.Region,
+		Players:        matchConfig.Players,
+		Settings:       matchConfig.Settings,
+		Mode:           &modeConfig,
+		Loadouts:       loadouts,
+		ClientSeeds:    clientSeeds,
+		ServerSeedHash: hashServerSeed(serverSeed),
+		DiceWeights:    dice.Weights(),
+		Spectating:     spectating,
+		Bots:           bots,
+	}
+	data, err := eventData(created)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	initialState := newMatchState(matchConfig.ID, created, now)
+	appendEvent(initialState, &models.GameAction{
+		ID:        fmt.Sprintf("%s_%s", eventCreateMatch, matchConfig.ID),
+		MatchID:   matchConfig.ID,
+		Type:      eventCreateMatch,
+		Data:      data,
+		Timestamp: now,
+	}, &models.GameActionResult{Success: true, Message: "Match created"})
+	
+	// Own the match before advertising it, so no other instance claims it. A
+	// match this instance cannot own is never stored, as nothing would run it.
+	acquired, err := ge.acquireLease(ctx, matchConfig.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !acquired {
+		return nil, fmt.Errorf("match lease for %s is held by another instance", matchConfig.ID)
+	}
+	
+	// Store match in database
+	if err := ge.dbManager.StoreMatch(ctx, matchConfig); err != nil {
+		ge.releaseLease(ctx, matchConfig.ID)
+		return nil, fmt.Errorf("failed to store match: %w", err)
+	}
+	
+	// Update match state in real-time database
+	var persisted int64
+	if err := ge.storeState(ctx, matchConfig.ID, initialState, 0); err != nil {
+		ge.logger.Error("Failed to update match state", zap.Error(err))
+	} else {
+		persisted = initialState.Sequence
+	}
+	
+	// Keep what a restarted service needs to pick the match back up
+	if err := ge.trackMatch(ctx, matchConfig.ID, serverSeed); err != nil {
+		ge.logger.Error("Match will not survive a restart", 
+			zap.String("match_id", matchConfig.ID),
+			zap.Error(err))
+	}
+	
+	// Create active match
+	activeMatch := &ActiveMatch{
+		Match:        matchConfig,
+		State:        initialState,
+		Players:      players,
+		CurrentTurn:  0,
+		TurnDeadline: time.Now().Add(30 * time.Second), // Default turn time
+		GamePhase:    models.MatchPhaseSetup,
+		Rules:        rules,
+		Dice:         dice,
+		Fairness:     fairness,
+		UpdateChan:   make(chan *models.GameAction, 100),
+		StateChan:    make(chan *models.MatchState, 10),
+		hub:          newMatchHub(matchConfig.ID, ge.logger),
+		outcomes:     make(map[string]*actionOutcome),
+		lastActivity: time.Now(),
+		
+		persistedSequence: persisted,
+		leaseRenewedAt:    time.Now(),
+		released:       make(chan struct{}),
+	}
+	
+	// Register active match
+	ge.matchesMutex.Lock()
+	ge.activeMatches[matchConfig.ID] = activeMatch
+	ge.matchesMutex.Unlock()
+	
+	// Start match processing goroutine
+	go ge.processMatch(activeMatch)
+	
+	ge.logger.Info("Match created and started",
+		zap.String("match_id", matchConfig.ID),
+		zap.String("game_mode", string(matchConfig.GameMode)),
+		zap.Int("player_count", len(matchConfig.Players)))
+	
+	return matchConfig, nil
+}
+
+// loadPlayers loads the user records of a match's players, skipping any that fail to load
+func (ge *GameEngine) loadPlayers(ctx context.Context, playerIDs []string) map[string]*models.User {
+	players := make(map[string]*models.User, len(playerIDs))
+	for _, playerID := range playerIDs {
+		user, err := ge.dbManager.GetUser(ctx, playerID)
+		if err != nil {
+			ge.logger.Warn("Failed to load player data", 
+				zap.String("user_id", playerID), 
+				zap.Error(err))
+			continue
+		}
+		players[playerID] = user
+	}
+	return players
+}
+
+// GetMatch retrieves a match by ID
+func (ge *GameEngine) GetMatch(matchID string) (*ActiveMatch, bool) {
+	ge.matchesMutex.RLock()
+	defer ge.matchesMutex.RUnlock()
+	
+	match, exists := ge.activeMatches[matchID]
+	return match, exists
+}
+
+// VerifyMatch recomputes every dice roll of a match from its revealed seeds
+func (ge *GameEngine) VerifyMatch(ctx context.Context, matchID string) (*FairnessReport, error) {
+	if activeMatch, exists := ge.GetMatch(matchID); exists {
+		activeMatch.mutex.RLock()
+		defer activeMatch.mutex.RUnlock()
+		return verifyDiceRolls(activeMatch.State)
+	}
+	
+	// Completed matches are no longer active; use the final stored state
+	state, err := ge.loadStoredState(ctx, matchID)
+	if err != nil {
+		return nil, err
+	}
+	return verifyDiceRolls(state)
+}
+
+// MatchEvents returns a copy of a match's event log
+func (ge *GameEngine) MatchEvents(ctx context.Context, matchID string) ([]models.GameAction, error) {
+	if activeMatch, exists := ge.GetMatch(matchID); exists {
+		activeMatch.mutex.RLock()
+		defer activeMatch.mutex.RUnlock()
+		return append([]models.GameAction(nil), activeMatch.State.ActionHistory...), nil
+	}
+	
+	state, err := ge.loadStoredState(ctx, matchID)
+	if err != nil {
+		return nil, err
+	}
+	return state.ActionHistory, nil
+}
+
+// ReconstructMatch rebuilds a match's state from its event log as it stood
+// after the given sequence number, or as it stands now when sequence is 0
+func (ge *GameEngine) ReconstructMatch(ctx context.Context, matchID string, sequence int64) (*models.MatchState, error) {
+	events, err := ge.MatchEvents(ctx, matchID)
+	if err != nil {
+		return nil, err
+	}
+	return ge.replayMatch(events, sequence)
+}
+
+// loadStoredState reads the last match state written to Redis
+func (ge *GameEngine) loadStoredState(ctx context.Context, matchID string) (*models.MatchState, error) {
+	key := matchStateKey(matchID)
+	count, err := ge.dbManager.Redis().Exists(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check match state: %w", err)
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("%w: %s", errMatchNotFound, matchID)
+	}
+	
+	var state models.MatchState
+	if err := ge.dbManager.Redis().GetObject(ctx, key, &state); err != nil {
+		return nil, fmt.Errorf("failed to load match state: %w", err)
+	}
+	
+	// The event log is stored on its own, except in states written before it was
+	if len(state.ActionHistory) == 0 {
+		events, err := ge.loadStoredEvents(ctx, matchID)
+		if err != nil {
+			return nil, err
+		}
+		state.ActionHistory = events
+	}
+	return &state, nil
+}
+
+// loadStoredEvents reads the event log written to Redis alongside the match state
+func (ge *GameEngine) loadStoredEvents(ctx context.Context, matchID string) ([]models.GameAction, error) {
+	raw, err := ge.dbManager.Redis().LRange(ctx, matchEventsKey(matchID), 0, -1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load match events: %w", err)
+	}
+	events := make([]models.GameAction, len(raw))
+	for i, event := range raw {
+		if err := json.Unmarshal([]byte(event), &events[i]); err != nil {
+			return nil, fmt.Errorf("failed to decode match event: %w", err)
+		}
+	}
+	return events, nil
+}
+
+// GetActiveMatchCount returns the number of active matches
+func (ge *GameEngine) GetActiveMatchCount() int {
+	ge.matchesMutex.RLock()
+	defer ge.matchesMutex.RUnlock()
+	return len(ge.activeMatches)
+}
+
+// StopAcceptingMatches stops accepting new matches
+func (ge *GameEngine) StopAcceptingMatches() {
+	ge.acceptingMatches = false
+}
+
+// WaitForMatches waits for all matches to finish or timeout
+func (ge *GameEngine) WaitForMatches(ctx context.Context) {
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+	
+	for {
+		select {
+		case <-ctx.Done():
+			ge.logger.Warn("Forced shutdown of remaining matches")
+			return
+		case <-ticker.C:
+			count := ge.GetActiveMatchCount()
+			if count == 0 {
+				ge.logger.Info("All matches completed")
+				return
+			}
+			ge.logger.Info("Waiting for matches to complete", zap.Int("remaining", count))
+		}
+	}
+}
+
+// Private methods
+
+// processMatch handles a single match's lifecycle
+func (ge *GameEngine) processMatch(activeMatch *ActiveMatch) {
+	defer func() {
+		// Clean up when match ends
+		ge.matchesMutex.Lock()
+		delete(ge.activeMatches, activeMatch.Match.ID)
+		ge.matchesMutex.Unlock()
+		
+		activeMatch.stopBots()
+		
+		// Close channels
+		close(activeMatch.UpdateChan)
+		close(activeMatch.StateChan)
+	}()
+	
+	ge.logger.Info("Starting match processing",
+		zap.String("match_id", activeMatch.Match.ID))
+	
+	// Stream state updates to the match's sockets until the channels close
+	go activeMatch.hub.run(activeMatch)
+	
+	// Bots play their seats through the same actions as everyone else
+	ge.startBots(activeMatch)
+	
+	// Initialize match based on game mode, unless it was recovered after it started
+	if activeMatch.GamePhase == models.MatchPhaseSetup {
+		if err := ge.initializeMatch(activeMatch); err != nil {
+			ge.logger.Error("Failed to initialize match", 
+				zap.String("match_id", activeMatch.Match.ID),
+				zap.Error(err))
+			return
+		}
+	}
+	
+	// Main game loop
+	turnTimer := time.NewTicker(1 * time.Second)
+	defer turnTimer.Stop()
+	
+	for {
+		select {
+		case action := <-activeMatch.UpdateChan:
+			// Matches ended by other services are settled like any other ending
+			if action.Type == eventEndMatch {
+				ge.endMatchOnRequest(activeMatch, action)
+				return
+			}
+			
+			// Process game action
+			if err := ge.applyQueuedAction(activeMatch, action); err != nil {
+				ge.logger.Error("Failed to execute game action",
+					zap.String("match_id", activeMatch.Match.ID),
+					zap.String("action_type", action.Type),
+					zap.Error(err))
+			} else if !isSpectatorEvent(action.Type) {
+				// Spectators coming and going do not keep an idle match alive
+				activeMatch.lastActivity = time.Now()
+			}
+			
+			// Check for match end conditions, even after a failure, since an
+			// action can be applied and still fail to be stored
+			if outcome := ge.checkMatchEnd(activeMatch); outcome != nil {
+				ge.finishMatch(activeMatch, outcome)
+				return
+			}
+			
+		case <-turnTimer.C:
+			// Players who stay away past their grace period forfeit
+			if ge.checkReconnectGrace(activeMatch) {
+				return
+			}
+			
+			// Players whose time bank runs out lose
+			if ge.tickTimeBanks(activeMatch, time.Now()) {
+				return
+			}
+			
+			// Check turn timeout, unless the clock is stopped for a disconnect
+			if activeMatch.State.Pause == nil && time.Now().After(activeMatch.TurnDeadline) {
+				ge.handleTurnTimeout(activeMatch)
+				
+				// Timeouts can abandon the match or run out its turns
+				if outcome := ge.checkMatchEnd(activeMatch); outcome != nil {
+					ge.finishMatch(activeMatch, outcome)
+					return
+				}
+			}
+			
+			// Idle matches are voided here, by the only goroutine that runs them
+			if time.Since(activeMatch.lastActivity) > 5*time.Minute {
+				ge.logger.Warn("Match inactive, ending",
+					zap.String("match_id", activeMatch.Match.ID))
+				ge.voidMatch(activeMatch, voidCauseInactive)
+				return
+			}
+			
+		case <-activeMatch.released:
+			// Another instance owns the match now and carries on from the stored state
+			ge.logger.Info("Match released",
+				zap.String("match_id", activeMatch.Match.ID))
+			return
+			
+		case <-ge.stopChan:
+			ge.logger.Info("Stopping match processing",
+				zap.String("match_id", activeMatch.Match.ID))
+			ge.voidMatch(activeMatch, voidCauseShutdown)
+			return
+		}
+	}
+}
+
+// initializeMatch sets up the match based on game mode and opens the turn decider
+func (ge *GameEngine) initializeMatch(activeMatch *ActiveMatch) error {
+	activeMatch.mutex.Lock()
+	defer activeMatch.mutex.Unlock()
+	
+	players := activeMatch.State.Players
+	if len(players) == 0 {
+		return fmt.Errorf("match has no players")
+	}
+	index, err := randomIndex(len(players))
+	if err != nil {
+		return err
+	}
+	
+	action := &models.GameAction{
+		ID:        fmt.Sprintf("%s_%s", eventStartMatch, activeMatch.Match.ID),
+		MatchID:   activeMatch.Match.ID,
+		PlayerID:  "", // System action
+		Type:      eventStartMatch,
+		Timestamp: time.Now(),
+		Data:      map[string]interface{}{"chooser_id": players[index]},
+	}
+	if err := ge.applyAction(activeMatch, action); err != nil {
+		return err
+	}
+	
+	return ge.broadcastStateUpdate(activeMatch)
+}
+
+// handleStartMatch initializes the game mode and opens the turn decider
+func (ge *GameEngine) handleStartMatch(activeMatch *ActiveMatch, action *models.GameAction) error {
+	startedAt := action.Timestamp
+	activeMatch.State.StartedAt = &startedAt
+	
+	if err := activeMatch.Rules.Initialize(activeMatch); err != nil {
+		return fmt.Errorf("failed to initialize %s match: %w", activeMatch.Match.GameMode, err)
+	}
+	applyClockSettings(&activeMatch.State.Settings, activeMatch.Rules.Config())
+	
+	chooserID, _ := action.Data["chooser_id"].(string)
+	if err := ge.startTurnDecider(activeMatch, chooserID, action.Timestamp); err != nil {
+		return fmt.Errorf("failed to start turn decider: %w", err)
+	}
+	
+	appendEvent(activeMatch.State, action, &models.GameActionResult{
+		Success:    true,
+		Message:    fmt.Sprintf("%s calls the turn decider", chooserID),
+		Data:       map[string]interface{}{"chooser_id": chooserID},
+		NextPlayer: chooserID,
+	})
+	return nil
+}
+
+// LoadGameModes refreshes game mode settings from Firestore
+func (ge *GameEngine) LoadGameModes(ctx context.Context) error {
+	loaded, err := ge.modes.LoadGameModes(ctx, ge.dbManager.Firestore())
+	if err != nil {
+		return err
+	}
+	
+	ge.logger.Info("Game modes loaded",
+		zap.Int("from_firestore", loaded),
+		zap.Strings("modes", ge.modes.Modes()))
+	return nil
+}
+
+// executeGameAction applies a live game action and broadcasts the new state
+func (ge *GameEngine) executeGameAction(activeMatch *ActiveMatch, action *models.GameAction) error {
+	activeMatch.mutex.Lock()
+	defer activeMatch.mutex.Unlock()
+	
+	// The server clock orders events, whatever the client sent
+	action.Timestamp = time.Now()
+	sequence := activeMatch.State.Sequence
+	if err := ge.applyAction(activeMatch, action); err != nil {
+		return err
+	}
+	
+	// Actions that add no event leave the state untouched
+	if activeMatch.State.Sequence == sequence {
+		return nil
+	}
+	return ge.broadcastStateUpdate(activeMatch)
+}
+
+// applyAction validates an action against the current state and applies it.
+// It is the reducer shared by live play and replays, so it performs no I/O.
+func (ge *GameEngine) applyAction(activeMatch *ActiveMatch, action *models.GameAction) error {
+	if err := requirePhase(activeMatch, action); err != nil {
+		return err
+	}
+	
+	switch action.Type {
+	case eventStartMatch:
+		return ge.handleStartMatch(activeMatch, action)
+	case eventEndMatch:
+		return ge.handleFinishMatch(activeMatch, action)
+	case eventDisconnect:
+		return ge.handleDisconnect(activeMatch, action)
+	case eventReconnect:
+		return ge.handleReconnect(activeMatch, action)
+	case eventUpdateMatch:
+		return ge.handleUpdateMatch(activeMatch, action)
+	case eventSpectatorJoin:
+		return ge.handleSpectatorJoin(activeMatch, action)
+	case eventSpectatorLeave:
+		return ge.handleSpectatorLeave(activeMatch, action)
+	case "choose_parity":
+		return ge.handleChooseParity(activeMatch, action)
+	case "roll_dice":
+		return ge.handleRollDice(activeMatch, action)
+	case "hold_dice", "bank":
+		return ge.handleHoldDice(activeMatch, action)
+	case "end_turn":
+		return ge.handleEndTurn(activeMatch, action)
+	case "use_ability":
+		return ge.handleUseAbility(activeMatch, action)
+	case "set_client_seed":
+		return ge.handleSetClientSeed(activeMatch, action)
+	case "surrender":
+		return ge.handleSurrender(activeMatch, action)
+	case "chat":
+		return ge.handleChatMessage(activeMatch, action)
+	default:
+		return fmt.Errorf("unknown action type: %s", action.Type)
+	}
+}
+
+// Game action handlers
+func (ge *GameEngine) handleRollDice(activeMatch *ActiveMatch, action *models.GameAction) error {
+	if err := ge.requireCurrentPlayer(activeMatch, action); err != nil {
+		return err
+	}
+	
+	// Luck Turner reweights the dice for this roll only
+	var weights []float64
+	if consumeEffect(activeMatch.State, abilityLuckTurner, action.PlayerID) {
+		luckyWeights := scaleSingleOne(activeMatch.State.Fairness.DiceWeights, luckTurnerSingleOneFactor)
+		weights = luckyWeights[:]
+	}
+	
+	// Replays reuse the logged dice rather than drawing new ones
+	roll := action.Roll
+	if !activeMatch.replaying {
+		roll = drawRoll(activeMatch, action.PlayerID, weights)
+	}
+	if roll == nil {
+		return fmt.Errorf("roll event has no recorded dice")
+	}
+	
+	result := activeMatch.Rules.ProcessRoll(activeMatch.State, roll)
+	if !result.Success {
+		return fmt.Errorf("roll rejected: %s", result.Message)
+	}
+	activeMatch.State.LastRoll = roll
+	action.Roll = roll
+	
+	// Every roll earns AURA for the roller
+	aura := creditRollAura(activeMatch.State, action, roll)
+	result.Data["aura"] = aura.Balance
+	tickRollEffects(activeMatch.State)
+	
+	ge.logger.Debug("Processing dice roll",
+		zap.String("match_id", activeMatch.Match.ID),
+		zap.String("player_id", action.PlayerID),
+		zap.Int("dice1", roll.Dice1),
+		zap.Int("dice2", roll.Dice2),
+		zap.Bool("turn_over", result.TurnOver))
+	
+	ge.recordActionResult(activeMatch, action, result)
+	return nil
+}
+
+// drawRoll rolls the match dice, or dice with the given face weights, from the provably fair stream
+func drawRoll(activeMatch *ActiveMatch, playerID string, weights []float64) *models.DiceRoll {
+	dice := activeMatch.Dice
+	if weights != nil {
+		var faceWeights [6]float64
+		copy(faceWeights[:], weights)
+		dice = NewWeightedDice(activeMatch.Fairness, faceWeights)
+	}
+	
+	rollIndex := activeMatch.Fairness.NextRoll(activeMatch.State.TurnNumber)
+	roll := rollDice(dice, playerID)
+	roll.TurnNumber = activeMatch.State.TurnNumber
+	roll.RollIndex = rollIndex
+	roll.Weights = weights
+	return roll
+}
+
+func (ge *GameEngine) handleHoldDice(activeMatch *ActiveMatch, action *models.GameAction) error {
+	if err := ge.requireCurrentPlayer(activeMatch, action); err != nil {
+		return err
+	}
+	
+	// Vital Rush boosts the turn score as it is banked
+	state := activeMatch.State
+	turnScore := state.TurnScore
+	vitalRush := findEffect(state, abilityVitalRush, action.PlayerID) >= 0
+	if vitalRush {
+		state.TurnScore = int(float64(turnScore) * vitalRushMultiplier)
+	}
+	
+	// Holding both dice banks the turn score
+	result := activeMatch.Rules.ProcessBank(state, action.PlayerID)
+	if !result.Success {
+		state.TurnScore = turnScore
+		return fmt.Errorf("bank rejected: %s", result.Message)
+	}
+	if vitalRush {
+		consumeEffect(state, abilityVitalRush, action.PlayerID)
+		result.SpecialEffect = abilityVitalRush
+	}
+	action.StateChanges = map[string]interface{}{"scoreChange": result.ScoreChange}
+	ge.recordActionResult(activeMatch, action, result)
+	return nil
+}
+
+func (ge *GameEngine) handleEndTurn(activeMatch *ActiveMatch, action *models.GameAction) error {
+	if action.PlayerID != "" {
+		if err := ge.requireCurrentPlayer(activeMatch, action); err != nil {
+			return err
+		}
+	}
+	
+	// Passing without banking forfeits the turn score
+	result := &models.GameActionResult{
+		Success:     true,
+		Message:     "Turn ended",
+		Data:        map[string]interface{}{"forfeited": activeMatch.State.TurnScore},
+		ScoreChange: -activeMatch.State.TurnScore,
+		NewScore:    activeMatch.State.Scores[activeMatch.State.CurrentTurn],
+		TurnOver:    true,
+	}
+	ge.recordActionResult(activeMatch, action, result)
+	return nil
+}
+
+// handleSetClientSeed replaces a player's client seed before the first roll
+func (ge *GameEngine) handleSetClientSeed(activeMatch *ActiveMatch, action *models.GameAction) error {
+	state := activeMatch.State
+	if _, ok := state.PlayerData[action.PlayerID]; !ok {
+		return fmt.Errorf("player not in match: %s", action.PlayerID)
+	}
+	for _, event := range state.ActionHistory {
+		if event.Roll != nil {
+			return fmt.Errorf("client seed cannot change after the first roll")
+		}
+	}
+	
+	clientSeed, _ := action.Data["client_seed"].(string)
+	state.Fairness.ClientSeeds[action.PlayerID] = clientSeed
+	if !activeMatch.replaying {
+		activeMatch.Fairness.SetClientSeed(combineClientSeeds(state.Players, state.Fairness.ClientSeeds))
+	}
+	
+	result := &models.GameActionResult{
+		Success: true,
+		Message: "Client seed updated",
+		Data:    map[string]interface{}{"client_seed": clientSeed},
+	}
+	// Like connection events, a seed change is no move: it leaves the clocks
+	// and the timeout count alone
+	appendEvent(state, action, result)
+	return nil
+}
+
+// requireCurrentPlayer rejects actions from players whose turn it is not
+func (ge *GameEngine) requireCurrentPlayer(activeMatch *ActiveMatch, action *models.GameAction) error {
+	if activeMatch.State.CurrentTurn != action.PlayerID {
+		return fmt.Errorf("not player's turn: %s", action.PlayerID)
+	}
+	return nil
+}
+
+// recordActionResult settles an action's outcome and appends it to the match log
+func (ge *GameEngine) recordActionResult(activeMatch *ActiveMatch, action *models.GameAction, result *models.GameActionResult) {
+	state := activeMatch.State
+	
+	// Rules read the event time from the state, which keeps replays deterministic
+	state.UpdatedAt = action.Timestamp
+	
+	// The player's clock ran until now; each roll earns the increment back
+	chargeTimeBank(state, action.Timestamp)
+	if action.Type == "roll_dice" && action.PlayerID == state.CurrentTurn {
+		addTimeIncrement(state, action.PlayerID)
+	}
+	
+	// Turns that time out count towards abandoning the match; acting clears the count
+	if isTimeout(action) {
+		if result.TurnOver {
+			noteTimeout(state, state.CurrentTurn)
+		}
+	} else if action.PlayerID != "" {
+		resetTimeouts(state, action.PlayerID)
+	}
+	
+	if result.TurnOver {
+		activeMatch.Rules.OnTurnEnd(state, state.CurrentTurn)
+	}
+	
+	if winner, finished := activeMatch.Rules.CheckWin(state); finished {
+		result.GameOver = true
+		result.Winner = winner
+		state.Winner = winner
+	}
+	
+	if result.TurnOver && !result.GameOver {
+		advanceTurn(state, nextTurnPlayer(activeMatch.Rules, state), result)
+		expireTurnEffects(state)
+		activeMatch.CurrentTurn++
+		runTimeBank(activeMatch, action.Timestamp)
+		startTurnClock(activeMatch, action.Timestamp)
+	} else if activeMatch.GamePhase == models.MatchPhaseActive && action.PlayerID == state.CurrentTurn {
+		// Each move the current player makes brings a new decision
+		setDecisionClock(activeMatch, action.Timestamp)
+	}
+	
+	appendEvent(state, action, result)
+}
+
+func (ge *GameEngine) handleChatMessage(activeMatch *ActiveMatch, action *models.GameAction) error {
+	// Handle in-game chat
+	// This would typically broadcast to all players in the match
+	return nil
+}
+
+// handleTurnTimeout handles when a player's turn times out
+func (ge *GameEngine) handleTurnTimeout(activeMatch *ActiveMatch) {
+	// Make the pending decision for the player
+	action := turnTimeoutAction(activeMatch, time.Now())
+	ge.logger.Info("Turn timeout",
+		zap.String("match_id", activeMatch.Match.ID),
+		zap.Int("turn", activeMatch.CurrentTurn),
+		zap.String("action_type", action.Type))
+	
+	if err := ge.executeGameAction(activeMatch, action); err != nil {
+		ge.logger.Error("Failed to apply turn timeout",
+			zap.String("match_id", activeMatch.Match.ID),
+			zap.String("action_type", action.Type),
+			zap.Error(err))
+	}
+}
+
+// voidMatch ends a match as a no contest, with no winner and no effect on player records
+func (ge *GameEngine) voidMatch(activeMatch *ActiveMatch, cause string) {
+	ge.finishMatch(activeMatch, map[string]interface{}{
+		"reason": models.WinReasonVoid,
+		"cause":  cause,
+	})
+}
+
+// finishMatch records the end_match event, then stores and releases the match
+func (ge *GameEngine) finishMatch(activeMatch *ActiveMatch, data map[string]interface{}) {
+	activeMatch.mutex.Lock()
+	defer activeMatch.mutex.Unlock()
+	
+	// Reveal the server seed so every roll can be verified
+	if activeMatch.Fairness != nil {
+		data["server_seed"] = activeMatch.Fairness.ServerSeed()
+	}
+	
+	action := &models.GameAction{
+		ID:        fmt.Sprintf("%s_%s", eventEndMatch, activeMatch.Match.ID),
+		MatchID:   activeMatch.Match.ID,
+		PlayerID:  "", // System action
+		Type:      eventEndMatch,
+		Timestamp: time.Now(),
+		Data:      data,
+	}
+	if err := ge.applyAction(activeMatch, action); err != nil {
+		ge.logger.Error("Failed to end match",
+			zap.String("match_id", activeMatch.Match.ID),
+			zap.Error(err))
+		return
+	}
+	
+	ge.logger.Info("Match ended",
+		zap.String("match_id", activeMatch.Match.ID),
+		zap.String("winner", activeMatch.State.Winner),
+		zap.String("reason", activeMatch.State.WinReason))
+	
+	// Final state broadcast
+	ge.broadcastStateUpdate(activeMatch)
+	
+	// Store final state
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	
+	if err := ge.persistMatchState(ctx, activeMatch); err != nil {
+		ge.logger.Error("Failed to store final match state",
+			zap.String("match_id", activeMatch.Match.ID),
+			zap.Error(err))
+	}
+	ge.storeMatchResult(ctx, activeMatch.State)
+	ge.storeReplay(ctx, activeMatch)
+	ge.untrackMatch(ctx, activeMatch.Match.ID)
+	ge.releaseLease(ctx, activeMatch.Match.ID)
+	ge.recordMatchStats(ctx, activeMatch.State, activeMatch.Rules.Config())
+}
+
+// handleFinishMatch ends the match with its outcome and settles the winner
+func (ge *GameEngine) handleFinishMatch(activeMatch *ActiveMatch, action *models.GameAction) error {
+	state := activeMatch.State
+	if state.CompletedAt != nil {
+		return fmt.Errorf("match has already ended")
+	}
+	
+	reason, _ := action.Data["reason"].(string)
+	forfeitedBy, _ := action.Data["forfeited_by"].(string)
+	
+	state.Status = matchStatus(reason)
+	setPhase(activeMatch, models.MatchPhaseCompleted)
+	state.Pause = nil
+	stopTimeBank(state, action.Timestamp)
+	completedAt := action.Timestamp
+	state.CompletedAt = &completedAt
+	state.WinReason = reason
+	state.Winner = matchWinner(state, reason, forfeitedBy)
+	if state.Winner != "" {
+		state.GameModeData["final_score"] = state.Scores[state.Winner]
+	}
+	
+	if seed, ok := action.Data["server_seed"].(string); ok && state.Fairness != nil {
+		state.Fairness.ServerSeed = seed
+	}
+	
+	appendEvent(state, action, &models.GameActionResult{
+		Success:  true,
+		Message:  "Match ended",
+		Data:     map[string]interface{}{"reason": reason},
+		GameOver: true,
+		Winner:   state.Winner,
+	})
+	return nil
+}
+
+// broadcastStateUpdate sends state updates to all connected clients
+func (ge *GameEngine) broadcastStateUpdate(activeMatch *ActiveMatch) error {
+	// The stored state only needs writing when the event log grew; clock
+	// ticks are rebuilt from the events on recovery. An event that could not
+	// be stored fails the action that added it.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := ge.persistMatchState(ctx, activeMatch); err != nil {
+		ge.logger.Error("Failed to update match state in database",
+			zap.String("match_id", activeMatch.Match.ID),
+			zap.Error(err))
+		return fmt.Errorf("failed to store match state: %w", err)
+	}
+	
+	// Bots decide their next move from every new state
+	activeMatch.wakeBots()
+	
+	// Wake the hub to send the new state. It always publishes the match's
+	// latest state, so when updates are already queued this one is covered
+	// by them; the action stands either way.
+	select {
+	case activeMatch.StateChan <- activeMatch.State:
+	default:
+	}
+	return nil
+}
+
+// Validation methods
+func (ge *GameEngine) validateMatchConfig(match *models.Match) error {
+	if match.ID == "" {
+		return fmt.Errorf("match ID is required")
+	}
+	
+	if len(match.Players) < 2 {
+		return fmt.Errorf("at least 2 players required")
+	}
+	
+	if len(match.Players) > 6 {
+		return fmt.Errorf("maximum 6 players allowed")
+	}
+	
+	return nil
+}
+
+func (ge *GameEngine) validateGameAction(activeMatch *ActiveMatch, action *models.GameAction) error {
+	if action.MatchID != activeMatch.Match.ID {
+		return fmt.Errorf("action match ID mismatch")
+	}
+	
+	if activeMatch.State.Status != "active" {
+		return fmt.Errorf("match is not active")
+	}
+	
+	if systemEvents[action.Type] {
+		return fmt.Errorf("%s is recorded by the engine only", action.Type)
+	}
+	
+	// Validate player is in the match
+	playerExists := false
+	for _, playerID := range activeMatch.State.Players {
+		if playerID == action.PlayerID {
+			playerExists = true
+			break
+		}
+	}
+	if !playerExists && action.PlayerID != "" { // Allow system actions with empty player ID
+		return fmt.Errorf("player not in match")
+	}
+	
+	return nil
+}
+
+// Background loops
+func (ge *GameEngine) matchProcessingLoop() {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	
+	for {
+		select {
+		case <-ticker.C:
+			// Periodic maintenance tasks
+			ge.performMaintenanceTasks()
+		case <-ge.stopChan:
+			return
+		}
+	}
+}
+
+func (ge *GameEngine) performMaintenanceTasks() {
+	// Perform periodic maintenance
+	ge.logger.Debug("Performing maintenance tasks",
+		zap.Int("active_matches", ge.GetActiveMatchCount()))
+}
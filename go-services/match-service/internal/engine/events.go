@@ -0,0 +1,253 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+// System events recorded by the engine alongside player actions
+const (
+	eventCreateMatch = "create_match"
+	eventStartMatch  = "start_match"
+	eventEndMatch    = "end_match"
+	eventDisconnect  = "disconnect"
+	eventReconnect   = "reconnect"
+	eventUpdateMatch = "update_match"
+
+	eventSpectatorJoin  = "spectator_join"
+	eventSpectatorLeave = "spectator_leave"
+)
+
+// Causes of a void match
+const (
+	voidCauseInactive = "inactive"
+	voidCauseShutdown = "shutdown"
+	voidCauseEnded    = "ended"
+)
+
+// systemEvents are the event types players can never submit
+var systemEvents = map[string]bool{
+	eventCreateMatch: true,
+	eventStartMatch:  true,
+	eventEndMatch:    true,
+	eventDisconnect:  true,
+	eventReconnect:   true,
+	eventUpdateMatch: true,
+
+	eventSpectatorJoin:  true,
+	eventSpectatorLeave: true,
+}
+
+// passiveEvents are the system events that do not move play on: an action
+// made before one of them still stands
+var passiveEvents = map[string]bool{
+	eventDisconnect:  true,
+	eventReconnect:   true,
+	eventUpdateMatch: true,
+
+	eventSpectatorJoin:  true,
+	eventSpectatorLeave: true,
+}
+
+// matchCreatedEvent is the payload of the create_match event that opens every match log
+type matchCreatedEvent struct {
+	GameMode       string                    `json:"game_mode"`
+	GameType       string                    `json:"game_type,omitempty"`
+	Region         string                    `json:"region,omitempty"`
+	Players        []string                  `json:"players"`
+	Settings       map[string]interface{}    `json:"settings,omitempty"`
+	Mode           *ModeConfig               `json:"mode,omitempty"` // Mode configuration resolved at creation
+	Loadouts       map[string]models.Loadout `json:"loadouts"`
+	ClientSeeds    map[string]string         `json:"client_seeds"`
+	ServerSeedHash string                    `json:"server_seed_hash"`
+	DiceWeights    [6]float64                `json:"dice_weights"`
+	Spectating     spectatorPolicy           `json:"spectating"`
+	Bots           map[string]string         `json:"bots,omitempty"`
+}
+
+// eventData converts an event payload into the generic action data map
+func eventData(payload interface{}) (map[string]interface{}, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode event data: %w", err)
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf("failed to encode event data: %w", err)
+	}
+	return data, nil
+}
+
+// newMatchState builds the state a match starts from, before any event is applied
+func newMatchState(matchID string, created *matchCreatedEvent, at time.Time) *models.MatchState {
+	state := &models.MatchState{
+		ID:           matchID,
+		Status:       "waiting",
+		Phase:        models.MatchPhaseSetup,
+		CurrentTurn:  "", // Set by the turn decider
+		GameMode:     created.GameMode,
+		GameType:     created.GameType,
+		Region:       created.Region,
+		CreatedAt:    at,
+		UpdatedAt:    at,
+		PlayerData:   make(map[string]models.MatchPlayer),
+		Scores:       make(map[string]int),
+		Aura:         make(map[string]int),
+		GameModeData: make(map[string]interface{}),
+		Settings: models.MatchSettings{
+			TimeLimit:            30, // 30 seconds per turn
+			MaxTurns:             50, // Maximum turns before draw
+			AllowReconnect:       true,
+			SpectatorMode:        created.Spectating.Allowed,
+			SpectatorDelay:       created.Spectating.Delay,
+			PauseOnDisconnect:    true,
+			ReconnectGracePeriod: int(defaultReconnectGrace / time.Second),
+			WinCondition:         100, // Default win condition
+			RollTimeLimit:        15,  // 15 seconds for rolling
+			BankTimeLimit:        10,  // 10 seconds for banking
+		},
+		Players:          append([]string(nil), created.Players...),
+		ConnectedPlayers: make([]string, 0),
+		ActionHistory:    make([]models.GameAction, 0),
+	}
+
+	for _, playerID := range created.Players {
+		player := models.MatchPlayer{
+			UserID:      playerID,
+			DisplayName: playerID, // Default to playerID, can be enhanced later
+			IsConnected: true,
+			IsReady:     false,
+			JoinedAt:    at,
+			LastSeen:    at,
+			Loadout:     created.Loadouts[playerID],
+
+			ReconnectGraceMs: int64(state.Settings.ReconnectGracePeriod) * 1000,
+
+			SpectatingDisabled: containsString(created.Spectating.OptedOut, playerID),
+		}
+		if difficulty, ok := created.Bots[playerID]; ok {
+			seatBot(&player, difficulty)
+		}
+		state.PlayerData[playerID] = player
+		state.Scores[playerID] = 0
+		state.Aura[playerID] = 0
+	}
+
+	clientSeeds := make(map[string]string, len(created.ClientSeeds))
+	for playerID, seed := range created.ClientSeeds {
+		clientSeeds[playerID] = seed
+	}
+	state.Fairness = &models.FairnessProof{
+		Algorithm:      models.FairnessAlgorithmHMACSHA256,
+		ServerSeedHash: created.ServerSeedHash,
+		ClientSeeds:    clientSeeds,
+		DiceWeights:    created.DiceWeights,
+	}
+
+	return state
+}
+
+// appendEvent stamps an applied action with the next sequence number and adds it to the log
+func appendEvent(state *models.MatchState, action *models.GameAction, result *models.GameActionResult) {
+	state.Sequence++
+	action.Sequence = state.Sequence
+	action.Success = result.Success
+	action.Result = result
+
+	state.ActionHistory = append(state.ActionHistory, *action)
+	state.LastAction = action
+	state.LastResult = result
+	state.UpdatedAt = action.Timestamp
+}
+
+// replayEvent copies a logged event, dropping everything the engine derives when applying it
+func replayEvent(event models.GameAction) *models.GameAction {
+	action := event
+	action.Sequence = 0
+	action.Success = false
+	action.Result = nil
+	action.AuraTransactions = nil
+	action.StateChanges = nil
+	if event.Roll != nil {
+		roll := *event.Roll
+		action.Roll = &roll
+	}
+	return &action
+}
+
+// replayMatch rebuilds a match state by applying its event log in order,
+// stopping after the event numbered upTo, or at the end of the log when upTo
+// is 0. Replays draw no dice and read no clock: rolls come from the log and
+// time from the event timestamps, so the same log always yields the same state.
+func (ge *GameEngine) replayMatch(events []models.GameAction, upTo int64) (*models.MatchState, error) {
+	activeMatch, err := ge.replayEvents(events, upTo)
+	if err != nil {
+		return nil, err
+	}
+	return activeMatch.State, nil
+}
+
+// createdRules builds a match's rules from the mode configuration recorded when
+// it was created. Logs written before the configuration was recorded fall back
+// to the mode's current configuration.
+func (ge *GameEngine) createdRules(created *matchCreatedEvent) (GameModeRules, error) {
+	if created.Mode != nil {
+		return ge.modes.RecordedRules(*created.Mode)
+	}
+	return ge.modes.Rules(created.GameMode, created.Settings)
+}
+
+// replayEvents applies an event log to a fresh match and returns the match it rebuilt
+func (ge *GameEngine) replayEvents(events []models.GameAction, upTo int64) (*ActiveMatch, error) {
+	if len(events) == 0 || events[0].Type != eventCreateMatch {
+		return nil, fmt.Errorf("event log must start with %s", eventCreateMatch)
+	}
+
+	var created matchCreatedEvent
+	if err := decodeSettings(events[0].Data, &created); err != nil {
+		return nil, fmt.Errorf("invalid %s event: %w", eventCreateMatch, err)
+	}
+	rules, err := ge.createdRules(&created)
+	if err != nil {
+		return nil, fmt.Errorf("failed to replay match: %w", err)
+	}
+
+	state := newMatchState(events[0].MatchID, &created, events[0].Timestamp)
+	activeMatch := &ActiveMatch{
+		Match: &models.Match{
+			ID:          events[0].MatchID,
+			Status:      "waiting",
+			GameMode:    created.GameMode,
+			GameType:    created.GameType,
+			Region:      created.Region,
+			Players:     created.Players,
+			CreatedAt:   events[0].Timestamp,
+			Settings:    created.Settings,
+			ClientSeeds: created.ClientSeeds,
+			Bots:        created.Bots,
+		},
+		State:     state,
+		Rules:     rules,
+		GamePhase: models.MatchPhaseSetup,
+		replaying: true,
+	}
+	appendEvent(state, replayEvent(events[0]), &models.GameActionResult{Success: true, Message: "Match created"})
+
+	for _, event := range events[1:] {
+		if upTo > 0 && event.Sequence > upTo {
+			break
+		}
+		if err := ge.applyAction(activeMatch, replayEvent(event)); err != nil {
+			return nil, fmt.Errorf("failed to replay event %d (%s): %w", event.Sequence, event.Type, err)
+		}
+		if state.Sequence != event.Sequence {
+			return nil, fmt.Errorf("event log is out of sequence at event %d", event.Sequence)
+		}
+	}
+
+	return activeMatch, nil
+}
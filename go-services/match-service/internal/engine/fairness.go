@@ -0,0 +1,279 @@
+package engine
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+// serverSeedSize is the number of random bytes in a server seed
+const serverSeedSize = 32
+
+// Errors returned when a match cannot be verified
+var (
+	errMatchNotFound       = errors.New("match not found")
+	errSeedNotRevealed     = errors.New("server seed has not been revealed")
+	errFairnessUnsupported = errors.New("match was not played with provably fair dice")
+)
+
+// SeededRandom derives uniform values from HMAC-SHA256 of a committed server
+// seed, so every roll can be recomputed once the seed is revealed.
+// Each roll reads from its own stream keyed by turn number and roll index.
+type SeededRandom struct {
+	serverSeed []byte
+	clientSeed string
+
+	turn      int
+	rollIndex int
+	rolls     int
+	block     int
+	buffer    []byte
+}
+
+// NewSeededRandom creates a random source for a server seed and combined client seed
+func NewSeededRandom(serverSeed []byte, clientSeed string) *SeededRandom {
+	return &SeededRandom{
+		serverSeed: serverSeed,
+		clientSeed: clientSeed,
+		turn:       -1,
+	}
+}
+
+// newServerSeed generates a fresh secret server seed
+func newServerSeed() ([]byte, error) {
+	seed := make([]byte, serverSeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, fmt.Errorf("failed to generate server seed: %w", err)
+	}
+	return seed, nil
+}
+
+// hashServerSeed returns the commitment published before the first roll
+func hashServerSeed(seed []byte) string {
+	sum := sha256.Sum256(seed)
+	return hex.EncodeToString(sum[:])
+}
+
+// combineClientSeeds joins the players' client seeds in seating order
+func combineClientSeeds(players []string, seeds map[string]string) string {
+	parts := make([]string, 0, len(players))
+	for _, playerID := range players {
+		parts = append(parts, seeds[playerID])
+	}
+	return strings.Join(parts, ",")
+}
+
+// SetClientSeed replaces the combined client seed
+func (sr *SeededRandom) SetClientSeed(clientSeed string) {
+	sr.clientSeed = clientSeed
+}
+
+// ServerSeed returns the hex encoded server seed for the end of match reveal
+func (sr *SeededRandom) ServerSeed() string {
+	return hex.EncodeToString(sr.serverSeed)
+}
+
+// Rolls returns how many rolls have been drawn from the source
+func (sr *SeededRandom) Rolls() int {
+	return sr.rolls
+}
+
+// NextRoll positions the source at the next roll of a turn and returns its index
+func (sr *SeededRandom) NextRoll(turn int) int {
+	if turn != sr.turn {
+		sr.turn = turn
+		sr.rollIndex = 0
+	} else {
+		sr.rollIndex++
+	}
+	sr.seek(turn, sr.rollIndex)
+	sr.rolls++
+	return sr.rollIndex
+}
+
+// seek restarts the stream for a given turn and roll index
+func (sr *SeededRandom) seek(turn, rollIndex int) {
+	sr.turn = turn
+	sr.rollIndex = rollIndex
+	sr.block = 0
+	sr.buffer = nil
+}
+
+// Float64 returns the next uniform value in [0, 1) from the current roll's stream
+func (sr *SeededRandom) Float64() float64 {
+	if len(sr.buffer) < 8 {
+		mac := hmac.New(sha256.New, sr.serverSeed)
+		fmt.Fprintf(mac, "%s:%d:%d:%d", sr.clientSeed, sr.turn, sr.rollIndex, sr.block)
+		sr.buffer = mac.Sum(nil)
+		sr.block++
+	}
+
+	value := binary.BigEndian.Uint64(sr.buffer[:8])
+	sr.buffer = sr.buffer[8:]
+	return float64(value>>11) / (1 << 53)
+}
+
+// RollVerification compares a recorded roll with the roll derived from the seeds
+type RollVerification struct {
+	ActionID   string `json:"actionId"`
+	PlayerID   string `json:"playerId"`
+	TurnNumber int    `json:"turnNumber"`
+	RollIndex  int    `json:"rollIndex"`
+	Recorded   [2]int `json:"recorded"`
+	Expected   [2]int `json:"expected"`
+	// LuckTurner is set when a logged Luck Turner use reweighted the roll
+	LuckTurner bool `json:"luckTurner,omitempty"`
+	// WeightsValid is false when the recorded face weights are not the ones
+	// the committed dice and the logged abilities give
+	WeightsValid bool `json:"weightsValid"`
+	Valid        bool `json:"valid"`
+}
+
+// FairnessReport is the outcome of verifying every roll of a match
+type FairnessReport struct {
+	MatchID        string             `json:"matchId"`
+	Algorithm      string             `json:"algorithm"`
+	ServerSeedHash string             `json:"serverSeedHash"`
+	ServerSeed     string             `json:"serverSeed"`
+	ClientSeeds    map[string]string  `json:"clientSeeds"`
+	SeedValid      bool               `json:"seedValid"`
+	SequenceValid  bool               `json:"sequenceValid"`
+	Rolls          []RollVerification `json:"rolls"`
+	Verified       bool               `json:"verified"`
+}
+
+// verifyDiceRolls recomputes every roll in the action history from the revealed
+// seeds. Rolls must also be numbered without gaps, so a roll cannot have been
+// silently discarded and redrawn. Each roll's face weights are derived from the
+// committed dice weights and the Luck Turner uses in the log, never taken from
+// the roll itself, so the server cannot pick weights to suit a roll.
+func verifyDiceRolls(state *models.MatchState) (*FairnessReport, error) {
+	proof := state.Fairness
+	if proof == nil {
+		return nil, errFairnessUnsupported
+	}
+	if proof.ServerSeed == "" {
+		return nil, errSeedNotRevealed
+	}
+
+	report := &FairnessReport{
+		MatchID:        state.ID,
+		Algorithm:      proof.Algorithm,
+		ServerSeedHash: proof.ServerSeedHash,
+		ServerSeed:     proof.ServerSeed,
+		ClientSeeds:    proof.ClientSeeds,
+		SequenceValid:  true,
+		Rolls:          make([]RollVerification, 0),
+	}
+
+	serverSeed, err := hex.DecodeString(proof.ServerSeed)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server seed: %w", err)
+	}
+	report.SeedValid = hashServerSeed(serverSeed) == proof.ServerSeedHash
+
+	random := NewSeededRandom(serverSeed, combineClientSeeds(state.Players, proof.ClientSeeds))
+	dice := NewWeightedDice(random, proof.DiceWeights)
+	deciderDie := NewWeightedDice(random, fairDiceWeights)
+
+	luckyWeights := scaleSingleOne(proof.DiceWeights, luckTurnerSingleOneFactor)
+	lucky := make(map[string]int)
+
+	lastTurn, nextIndex := -1, 0
+	for _, action := range state.ActionHistory {
+		if luckTurnerUse(&action) {
+			lucky[action.PlayerID] = intSetting(action.Result.Data, "turn", -1)
+			continue
+		}
+		roll := action.Roll
+		if roll == nil {
+			continue
+		}
+
+		if roll.TurnNumber != lastTurn {
+			lastTurn, nextIndex = roll.TurnNumber, 0
+		}
+		if roll.RollIndex != nextIndex {
+			report.SequenceValid = false
+		}
+		nextIndex = roll.RollIndex + 1
+
+		// Luck Turner reweights the user's next roll, if they make it in the
+		// turn they used it; otherwise it lapses with the turn
+		turn, luckTurner := lucky[roll.PlayerID]
+		if luckTurner {
+			delete(lucky, roll.PlayerID)
+			luckTurner = turn == roll.TurnNumber
+		}
+
+		// The turn decider rolls a single fair die ahead of turn 1
+		random.seek(roll.TurnNumber, roll.RollIndex)
+		var expected [2]int
+		var weights []float64
+		switch {
+		case roll.TurnNumber == turnDeciderTurn:
+			expected = [2]int{deciderDie.RollDie(), 0}
+		case luckTurner:
+			weights = luckyWeights[:]
+			modified := NewWeightedDice(random, luckyWeights)
+			expected = [2]int{modified.RollDie(), modified.RollDie()}
+		default:
+			expected = [2]int{dice.RollDie(), dice.RollDie()}
+		}
+		recorded := [2]int{roll.Dice1, roll.Dice2}
+		weightsValid := sameWeights(roll.Weights, weights)
+
+		report.Rolls = append(report.Rolls, RollVerification{
+			ActionID:     action.ID,
+			PlayerID:     roll.PlayerID,
+			TurnNumber:   roll.TurnNumber,
+			RollIndex:    roll.RollIndex,
+			Recorded:     recorded,
+			Expected:     expected,
+			LuckTurner:   luckTurner,
+			WeightsValid: weightsValid,
+			Valid:        weightsValid && expected == recorded,
+		})
+	}
+
+	report.Verified = report.SeedValid && report.SequenceValid
+	for _, roll := range report.Rolls {
+		if !roll.Valid {
+			report.Verified = false
+			break
+		}
+	}
+
+	return report, nil
+}
+
+// luckTurnerUse reports whether a logged action is an applied Luck Turner use
+func luckTurnerUse(action *models.GameAction) bool {
+	if action.Type != "use_ability" || !action.Success || action.Result == nil {
+		return false
+	}
+	abilityID, _ := action.Data["ability_id"].(string)
+	blocked, _ := action.Result.Data["blocked"].(bool)
+	return abilityID == abilityLuckTurner && !blocked
+}
+
+// sameWeights reports whether recorded face weights match the derived ones,
+// where nil stands for the unmodified match dice
+func sameWeights(recorded, derived []float64) bool {
+	if len(recorded) != len(derived) {
+		return false
+	}
+	for i := range recorded {
+		if recorded[i] != derived[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,180 @@
+package engine
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+// fairRoll is a roll to log, drawn with Luck Turner's weights when lucky
+type fairRoll struct {
+	player string
+	turn   int
+	index  int
+	lucky  bool
+}
+
+// newFairState logs the rolls as the engine would, with a Luck Turner use
+// ahead of every lucky roll, and reveals the server seed
+func newFairState(t *testing.T, rolls []fairRoll) *models.MatchState {
+	t.Helper()
+	serverSeed := []byte("0123456789abcdef0123456789abcdef")
+	players := []string{"a", "b"}
+	proof := &models.FairnessProof{
+		Algorithm:      "hmac-sha256",
+		ServerSeedHash: hashServerSeed(serverSeed),
+		ServerSeed:     hex.EncodeToString(serverSeed),
+		ClientSeeds:    map[string]string{"a": "seed-a", "b": "seed-b"},
+		DiceWeights:    singleOneWeights(0.8),
+	}
+	state := &models.MatchState{ID: "match", Players: players, Fairness: proof}
+
+	random := NewSeededRandom(serverSeed, combineClientSeeds(players, proof.ClientSeeds))
+	luckyWeights := scaleSingleOne(proof.DiceWeights, luckTurnerSingleOneFactor)
+	for _, r := range rolls {
+		weights := proof.DiceWeights
+		var recorded []float64
+		if r.lucky {
+			weights, recorded = luckyWeights, luckyWeights[:]
+			state.ActionHistory = append(state.ActionHistory, models.GameAction{
+				PlayerID: r.player,
+				Type:     "use_ability",
+				Data:     map[string]interface{}{"ability_id": abilityLuckTurner},
+				Success:  true,
+				Result:   &models.GameActionResult{Success: true, Data: map[string]interface{}{"turn": r.turn}},
+			})
+		}
+		random.seek(r.turn, r.index)
+		dice := NewWeightedDice(random, weights)
+		roll := &models.DiceRoll{PlayerID: r.player, TurnNumber: r.turn, RollIndex: r.index, Weights: recorded}
+		roll.Dice1, roll.Dice2 = dice.RollDie(), dice.RollDie()
+		state.ActionHistory = append(state.ActionHistory, models.GameAction{
+			PlayerID: r.player,
+			Type:     "roll_dice",
+			Success:  true,
+			Roll:     roll,
+		})
+	}
+	return state
+}
+
+func TestVerifyDiceRollWeights(t *testing.T) {
+	rolls := []fairRoll{
+		{player: "a", turn: 1, index: 0},
+		{player: "a", turn: 1, index: 1, lucky: true},
+		{player: "b", turn: 2, index: 0},
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(state *models.MatchState)
+		valid  []bool
+	}{
+		{
+			name:  "weights derived from the log",
+			valid: []bool{true, true, true},
+		},
+		{
+			name: "weights recorded without a Luck Turner use",
+			tamper: func(state *models.MatchState) {
+				state.ActionHistory[0].Roll.Weights = []float64{0, 1, 1, 1, 1, 1}
+			},
+			valid: []bool{false, true, true},
+		},
+		{
+			name: "Luck Turner roll recorded with the match dice",
+			tamper: func(state *models.MatchState) {
+				state.ActionHistory[2].Roll.Weights = nil
+			},
+			valid: []bool{true, false, true},
+		},
+		{
+			name: "Luck Turner roll recorded with other weights",
+			tamper: func(state *models.MatchState) {
+				state.ActionHistory[2].Roll.Weights = []float64{0.1, 1, 1, 1, 1, 1}
+			},
+			valid: []bool{true, false, true},
+		},
+		{
+			name: "Luck Turner lapses with the turn",
+			tamper: func(state *models.MatchState) {
+				state.ActionHistory[1].Result.Data["turn"] = 0
+			},
+			valid: []bool{true, false, true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := newFairState(t, rolls)
+			if tt.tamper != nil {
+				tt.tamper(state)
+			}
+
+			report, err := verifyDiceRolls(state)
+			if err != nil {
+				t.Fatalf("verifyDiceRolls() failed: %v", err)
+			}
+			if len(report.Rolls) != len(tt.valid) {
+				t.Fatalf("verified %d rolls, want %d", len(report.Rolls), len(tt.valid))
+			}
+			verified := true
+			for i, roll := range report.Rolls {
+				if roll.Valid != tt.valid[i] {
+					t.Errorf("roll %d valid = %v, want %v", i, roll.Valid, tt.valid[i])
+				}
+				verified = verified && tt.valid[i]
+			}
+			if report.Verified != verified {
+				t.Errorf("Verified = %v, want %v", report.Verified, verified)
+			}
+		})
+	}
+}
+
+func TestSetClientSeedLeavesClocks(t *testing.T) {
+	started := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	state := newFairState(t, nil)
+	state.CurrentTurn = "a"
+	state.PlayerData = map[string]models.MatchPlayer{
+		"a": {UserID: "a", ConsecutiveTimeouts: 2},
+		"b": {UserID: "b"},
+	}
+	state.TimeBanks = newTimeBanks(state.Players, time.Minute, 0)
+	state.TimeBanks.Running, state.TimeBanks.RunningSince = "a", started
+	activeMatch := &ActiveMatch{
+		Match:     &models.Match{ID: state.ID, Players: state.Players},
+		State:     state,
+		Fairness:  NewSeededRandom([]byte("server-seed"), combineClientSeeds(state.Players, state.Fairness.ClientSeeds)),
+		GamePhase: models.MatchPhaseActive,
+	}
+
+	ge := &GameEngine{logger: zap.NewNop()}
+	err := ge.handleSetClientSeed(activeMatch, &models.GameAction{
+		ID:        "seed",
+		PlayerID:  "a",
+		Type:      "set_client_seed",
+		Data:      map[string]interface{}{"client_seed": "fresh"},
+		Timestamp: started.Add(30 * time.Second),
+	})
+	if err != nil {
+		t.Fatalf("handleSetClientSeed() failed: %v", err)
+	}
+
+	if state.Fairness.ClientSeeds["a"] != "fresh" || state.Sequence != 1 {
+		t.Errorf("client seed = %q at sequence %d, want fresh at 1", state.Fairness.ClientSeeds["a"], state.Sequence)
+	}
+	if banks := state.TimeBanks; banks.RemainingMs["a"] != time.Minute.Milliseconds() || !banks.RunningSince.Equal(started) {
+		t.Errorf("time bank = %d ms since %v, want it untouched", banks.RemainingMs["a"], banks.RunningSince)
+	}
+	if state.TurnClock != nil {
+		t.Errorf("turn clock = %+v, want no decision clock started", state.TurnClock)
+	}
+	if timeouts := state.PlayerData["a"].ConsecutiveTimeouts; timeouts != 2 {
+		t.Errorf("consecutive timeouts = %d, want 2", timeouts)
+	}
+}
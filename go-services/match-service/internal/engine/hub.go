@@ -0,0 +1,620 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+
+	apperrors "github.com/LukeAtkinz/dashdice/go-services/shared/errors"
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+// Socket timings
+const (
+	socketWriteWait   = 10 * time.Second
+	socketPongWait    = 60 * time.Second
+	socketPingPeriod  = 54 * time.Second
+	socketReadLimit   = 4096
+	socketSendBacklog = 32
+)
+
+// errSocketUnauthorized is returned for match sockets opened without a valid token
+var errSocketUnauthorized = errors.New("missing or invalid token")
+
+// newSocketUpgrader upgrades match socket requests. Browsers must connect from
+// one of the allowed origins, so another site cannot open a socket with a
+// token it got hold of; clients that send no origin are not browsers and are
+// left to their token.
+func newSocketUpgrader(allowedOrigins []string) *websocket.Upgrader {
+	return &websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				return true
+			}
+			for _, allowed := range allowedOrigins {
+				if allowed == "*" || strings.EqualFold(allowed, origin) {
+					return true
+				}
+			}
+			return false
+		},
+	}
+}
+
+// clientMessage is a message a client sends over its match socket
+type clientMessage struct {
+	Type       string                 `json:"type"` // "game_action", "resync" or "ping"; replays also take "seek", "speed", "pause" and "resume"
+	ActionID   string                 `json:"action_id,omitempty"`
+	ActionType string                 `json:"action_type,omitempty"`
+	Data       map[string]interface{} `json:"data,omitempty"`
+
+	// Sequence of the snapshot or patch the action was made against; 0
+	// skips the check. This is the event sequence, not the stream version.
+	ExpectedVersion int64 `json:"expected_version,omitempty"`
+
+	// Replay position in milliseconds to seek to, and playback speed
+	Position int64   `json:"position,omitempty"`
+	Speed    float64 `json:"speed,omitempty"`
+}
+
+// serverMessage is a message sent to the clients of a match socket. A client
+// starts from a snapshot and applies each patch whose base version is the
+// version it holds; on a gap it asks for a resync. The version orders the
+// stream and moves with clock ticks too, while the sequence is the match
+// event the state has reached, and is what actions are checked against.
+// Every game action is answered with its result or an error carrying its ID.
+// Replays use the same messages, placed in the match by position, and end
+// with "replay_end".
+type serverMessage struct {
+	Type        string                   `json:"type"` // "snapshot", "patch", "action_result", "error", "pong" or "replay_end"
+	Version     int64                    `json:"version,omitempty"`
+	BaseVersion int64                    `json:"base_version,omitempty"`
+	State       map[string]interface{}   `json:"state,omitempty"`
+	Ops         []patchOp                `json:"ops,omitempty"`
+	ActionID    string                   `json:"action_id,omitempty"`
+	Sequence    int64                    `json:"sequence,omitempty"`
+	Result      *models.GameActionResult `json:"result,omitempty"`
+	Error       string                   `json:"error,omitempty"`
+	Code        string                   `json:"code,omitempty"`
+	Position    int64                    `json:"position,omitempty"` // Replay milliseconds into the match
+	Duration    int64                    `json:"duration,omitempty"` // Replay length in milliseconds
+	Timestamp   int64                    `json:"timestamp"`
+}
+
+// MatchHub fans a match's state updates out to every socket watching it as
+// versioned patches. Players follow the live state; spectators follow their
+// own redacted and delayed stream.
+type MatchHub struct {
+	matchID string
+	logger  *zap.Logger
+
+	clients map[*matchClient]bool
+	closed  bool
+	mutex   sync.RWMutex
+
+	// The state clients were last sent, and its version
+	version int64
+	doc     syncDocument
+	history []models.GameAction
+
+	// What spectators were last sent and what is still held back from them
+	spectators spectatorFeed
+}
+
+// matchClient is one socket connected to a match
+type matchClient struct {
+	hub       *MatchHub
+	conn      *websocket.Conn
+	userID    string
+	spectator bool
+	send      chan []byte
+	closeOnce sync.Once
+}
+
+// newMatchHub creates the hub for a match
+func newMatchHub(matchID string, logger *zap.Logger) *MatchHub {
+	return &MatchHub{
+		matchID: matchID,
+		logger:  logger,
+		clients: make(map[*matchClient]bool),
+	}
+}
+
+// run sends every state update to the match's clients until the match stops
+// running here, then detaches them
+func (h *MatchHub) run(activeMatch *ActiveMatch) {
+	for range activeMatch.StateChan {
+		// Updates queued while the hub was busy are covered by the latest state
+		h.publish(activeMatch)
+	}
+
+	// An ended match is over for its clients; one moved to another instance
+	// is picked up again there when they reconnect
+	activeMatch.mutex.RLock()
+	ended := activeMatch.State.CompletedAt != nil
+	activeMatch.mutex.RUnlock()
+	if ended {
+		h.flushSpectatorUpdates()
+		h.close(websocket.CloseNormalClosure, "match ended")
+	} else {
+		h.close(websocket.CloseServiceRestart, "match moved")
+	}
+}
+
+// publish sends clients the patch from the state they last saw to the
+// match's current state
+func (h *MatchHub) publish(activeMatch *ActiveMatch) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	base := h.version
+	ops, err := h.advance(activeMatch)
+	if err != nil {
+		h.logger.Error("Failed to sync match state",
+			zap.String("match_id", h.matchID),
+			zap.Error(err))
+		return
+	}
+	if h.version == base {
+		return
+	}
+
+	payload, err := json.Marshal(serverMessage{
+		Type:        "patch",
+		Version:     h.version,
+		BaseVersion: base,
+		Sequence:    historySequence(h.history),
+		Ops:         ops,
+		Timestamp:   time.Now().Unix(),
+	})
+	if err != nil {
+		h.logger.Error("Failed to encode match patch",
+			zap.String("match_id", h.matchID),
+			zap.Error(err))
+		return
+	}
+	h.broadcast(payload, false)
+}
+
+// advance moves the hub to the match's current state, returning the patch
+// from the previous version. The version only moves when the state changed,
+// and each new version is queued for spectators. Callers hold the hub mutex.
+func (h *MatchHub) advance(activeMatch *ActiveMatch) ([]patchOp, error) {
+	var spectatorDoc syncDocument
+	activeMatch.mutex.RLock()
+	spectatable := activeMatch.State.Settings.SpectatorMode
+	delay := time.Duration(activeMatch.State.Settings.SpectatorDelay) * time.Second
+	doc, history, err := newSyncDocument(activeMatch.State)
+	if err == nil && spectatable {
+		spectatorDoc, err = spectatorDocument(doc, activeMatch.State)
+	}
+	activeMatch.mutex.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var ops []patchOp
+	if h.doc != nil {
+		ops = syncPatch(h.doc, doc, h.history, history)
+		if len(ops) == 0 {
+			return nil, nil
+		}
+	}
+	h.doc, h.history = doc, history
+	h.version++
+
+	if spectatable {
+		h.queueSpectatorUpdate(spectatorDoc, history, delay)
+	} else {
+		h.dropSpectators()
+	}
+	return ops, nil
+}
+
+// snapshotMessage encodes the state at the current version of the players'
+// or the spectators' stream. It is nil while spectators have nothing to see
+// yet; they get a snapshot as soon as they do. Callers hold the hub mutex.
+func (h *MatchHub) snapshotMessage(spectator bool) ([]byte, error) {
+	version, doc, history := h.version, h.doc, h.history
+	if spectator {
+		version, doc, history = h.spectators.version, h.spectators.doc, h.spectators.history
+	}
+	if doc == nil {
+		return nil, nil
+	}
+	return json.Marshal(serverMessage{
+		Type:      "snapshot",
+		Version:   version,
+		Sequence:  historySequence(history),
+		State:     syncSnapshot(doc, history),
+		Timestamp: time.Now().Unix(),
+	})
+}
+
+// register adds a client and queues the snapshot it starts from, returning
+// false once the hub has closed
+func (h *MatchHub) register(client *matchClient, activeMatch *ActiveMatch) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.closed {
+		return false
+	}
+	if h.doc == nil {
+		if _, err := h.advance(activeMatch); err != nil {
+			h.logger.Error("Failed to sync match state",
+				zap.String("match_id", h.matchID),
+				zap.Error(err))
+			return false
+		}
+	}
+
+	payload, err := h.snapshotMessage(client.spectator)
+	if err != nil {
+		h.logger.Error("Failed to encode match snapshot",
+			zap.String("match_id", h.matchID),
+			zap.Error(err))
+		return false
+	}
+	h.clients[client] = true
+	if payload != nil {
+		client.send <- payload
+	}
+	return true
+}
+
+// resync sends a client that missed a patch the snapshot of the current version
+func (h *MatchHub) resync(client *matchClient) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if _, ok := h.clients[client]; !ok {
+		return
+	}
+	payload, err := h.snapshotMessage(client.spectator)
+	if err != nil || payload == nil {
+		if err != nil {
+			h.logger.Error("Failed to encode match snapshot",
+				zap.String("match_id", h.matchID),
+				zap.Error(err))
+		}
+		return
+	}
+	select {
+	case client.send <- payload:
+	default:
+	}
+}
+
+// unregister removes a client, reporting whether it was the user's last
+// socket on a hub that is still open
+func (h *MatchHub) unregister(client *matchClient) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	delete(h.clients, client)
+	client.closeSend()
+
+	for other := range h.clients {
+		if other.userID == client.userID {
+			return false
+		}
+	}
+	return !h.closed
+}
+
+// broadcast queues a message for every player, or every spectator. Clients
+// too slow to keep up are dropped and must reconnect for a fresh state.
+// Callers hold the hub mutex.
+func (h *MatchHub) broadcast(payload []byte, spectators bool) {
+	for client := range h.clients {
+		if client.spectator != spectators {
+			continue
+		}
+		select {
+		case client.send <- payload:
+		default:
+			h.logger.Warn("Dropping slow match socket",
+				zap.String("match_id", h.matchID),
+				zap.String("user_id", client.userID))
+			delete(h.clients, client)
+			client.closeSend()
+		}
+	}
+}
+
+// close detaches every client with the given close frame and refuses new ones
+func (h *MatchHub) close(code int, reason string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.closed = true
+	message := websocket.FormatCloseMessage(code, reason)
+	for client := range h.clients {
+		delete(h.clients, client)
+		client.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(socketWriteWait))
+		client.closeSend()
+	}
+}
+
+// closeSend stops the client's write pump
+func (c *matchClient) closeSend() {
+	c.closeOnce.Do(func() {
+		close(c.send)
+	})
+}
+
+// sendMessage queues a message for this client only
+func (c *matchClient) sendMessage(message serverMessage) {
+	message.Timestamp = time.Now().Unix()
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return
+	}
+
+	c.hub.mutex.RLock()
+	defer c.hub.mutex.RUnlock()
+	if _, ok := c.hub.clients[c]; !ok {
+		return
+	}
+	select {
+	case c.send <- payload:
+	default:
+	}
+}
+
+// writePump writes queued messages and keepalive pings to the socket
+func (c *matchClient) writePump() {
+	ticker := time.NewTicker(socketPingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case payload, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+			if !ok {
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, payload); err != nil {
+				return
+			}
+
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// readPump reads client messages until the socket closes
+func (c *matchClient) readPump(ge *GameEngine) {
+	c.conn.SetReadLimit(socketReadLimit)
+	c.conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		c.conn.SetReadDeadline(time.Now().Add(socketPongWait))
+		return nil
+	})
+
+	for {
+		_, raw, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure, websocket.CloseAbnormalClosure) {
+				ge.logger.Warn("Match socket read error",
+					zap.String("match_id", c.hub.matchID),
+					zap.String("user_id", c.userID),
+					zap.Error(err))
+			}
+			return
+		}
+
+		var message clientMessage
+		if err := json.Unmarshal(raw, &message); err != nil {
+			c.sendMessage(serverMessage{
+				Type:  "error",
+				Error: "invalid message",
+				Code:  "INVALID_MESSAGE",
+			})
+			continue
+		}
+
+		switch message.Type {
+		case "ping":
+			c.sendMessage(serverMessage{Type: "pong"})
+		case "resync":
+			c.hub.resync(c)
+		case "game_action":
+			c.submitAction(ge, message)
+		default:
+			c.sendMessage(serverMessage{
+				Type:  "error",
+				Error: fmt.Sprintf("unknown message type: %s", message.Type),
+				Code:  "UNKNOWN_MESSAGE",
+			})
+		}
+	}
+}
+
+// submitAction applies a game action for the player behind the socket and
+// answers with its result. Clients retry with the same action ID, so a
+// retried action gets the original result instead of running twice.
+func (c *matchClient) submitAction(ge *GameEngine, message clientMessage) {
+	if c.spectator {
+		c.sendMessage(serverMessage{
+			Type:     "error",
+			ActionID: message.ActionID,
+			Error:    "spectators cannot take actions",
+			Code:     "SPECTATOR_ACTION",
+		})
+		return
+	}
+
+	if message.ActionID == "" {
+		c.sendMessage(serverMessage{
+			Type:  "error",
+			Error: "action_id is required",
+			Code:  "MISSING_ACTION_ID",
+		})
+		return
+	}
+	data := message.Data
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+
+	action := &models.GameAction{
+		ID:              message.ActionID,
+		MatchID:         c.hub.matchID,
+		PlayerID:        c.userID,
+		Type:            message.ActionType,
+		Data:            data,
+		Timestamp:       time.Now(),
+		ExpectedVersion: message.ExpectedVersion,
+	}
+	event, err := ge.ProcessGameAction(c.hub.matchID, action)
+	if err != nil {
+		c.sendMessage(serverMessage{
+			Type:     "error",
+			ActionID: message.ActionID,
+			Error:    err.Error(),
+			Code:     actionErrorCode(err),
+		})
+		return
+	}
+
+	reply := serverMessage{Type: "action_result", ActionID: message.ActionID}
+	if event != nil {
+		reply.Sequence = event.Sequence
+		reply.Result = event.Result
+	}
+	c.sendMessage(reply)
+}
+
+// actionErrorCode names why an action failed, e.g. INVALID_MOVE
+func actionErrorCode(err error) string {
+	var appErr *apperrors.AppError
+	if errors.As(err, &appErr) {
+		return strings.ToUpper(appErr.Type)
+	}
+	return "INVALID_ACTION"
+}
+
+// authenticateSocket returns the user a match socket belongs to. Browsers
+// cannot set headers on sockets, so the token may also come as a query parameter.
+func (ms *MatchService) authenticateSocket(c *gin.Context) (string, error) {
+	tokenString := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if tokenString == "" {
+		tokenString = c.Query("token")
+	}
+	if tokenString == "" {
+		return "", errSocketUnauthorized
+	}
+
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(ms.config.JWTSecret), nil
+	})
+	if err != nil || !token.Valid {
+		return "", errSocketUnauthorized
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", errSocketUnauthorized
+	}
+	userID, _ := claims["user_id"].(string)
+	if userID == "" {
+		return "", errSocketUnauthorized
+	}
+	return userID, nil
+}
+
+// serveMatchSocket attaches an upgraded socket to a match: players are marked
+// connected while they have a socket open, and spectators only watch
+func (ge *GameEngine) serveMatchSocket(activeMatch *ActiveMatch, conn *websocket.Conn, userID string, spectator bool) {
+	client := &matchClient{
+		hub:       activeMatch.hub,
+		conn:      conn,
+		userID:    userID,
+		spectator: spectator,
+		send:      make(chan []byte, socketSendBacklog),
+	}
+	// Every client starts from a snapshot of the current state
+	if !client.hub.register(client, activeMatch) {
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, "match ended"),
+			time.Now().Add(socketWriteWait))
+		conn.Close()
+		return
+	}
+	go client.writePump()
+
+	matchID := activeMatch.Match.ID
+	if spectator {
+		if _, err := ge.JoinSpectator(matchID, userID); err != nil {
+			ge.logger.Warn("Failed to record spectator",
+				zap.String("match_id", matchID),
+				zap.String("user_id", userID),
+				zap.Error(err))
+		}
+	} else {
+		activeMatch.mutex.RLock()
+		connected := activeMatch.State.PlayerData[userID].IsConnected
+		activeMatch.mutex.RUnlock()
+		if !connected {
+			if err := ge.PlayerReconnected(matchID, userID); err != nil {
+				ge.logger.Warn("Failed to record reconnect",
+					zap.String("match_id", matchID),
+					zap.String("user_id", userID),
+					zap.Error(err))
+			}
+		}
+	}
+
+	ge.logger.Info("Match socket connected",
+		zap.String("match_id", matchID),
+		zap.String("user_id", userID),
+		zap.Bool("spectator", spectator))
+
+	client.readPump(ge)
+
+	// The user is only away once their last socket closes
+	if client.hub.unregister(client) {
+		if spectator {
+			if _, err := ge.LeaveSpectator(matchID, userID); err != nil {
+				ge.logger.Warn("Failed to record spectator leaving",
+					zap.String("match_id", matchID),
+					zap.String("user_id", userID),
+					zap.Error(err))
+			}
+		} else if err := ge.PlayerDisconnected(matchID, userID); err != nil {
+			ge.logger.Warn("Failed to record disconnect",
+				zap.String("match_id", matchID),
+				zap.String("user_id", userID),
+				zap.Error(err))
+		}
+	}
+
+	ge.logger.Info("Match socket disconnected",
+		zap.String("match_id", matchID),
+		zap.String("user_id", userID))
+}
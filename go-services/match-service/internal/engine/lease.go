@@ -0,0 +1,310 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+// Match ownership leases. The owner renews well inside the TTL, so a lease
+// only lapses when its instance has stopped or lost Redis.
+const (
+	matchLeaseTTL      = 15 * time.Second
+	leaseRenewInterval = 5 * time.Second
+)
+
+// matchStateTTL bounds how long a stored match state outlives its last write
+const matchStateTTL = time.Hour
+
+// errMatchOwnerUnavailable is returned when a forwarded request reaches an instance that does not own the match
+var errMatchOwnerUnavailable = errors.New("match owner is unavailable")
+
+// errLeaseLost is returned when this instance no longer owns a match it is running
+var errLeaseLost = errors.New("match lease lost")
+
+// acquireLeaseScript takes a free lease, or refreshes one the caller already holds
+const acquireLeaseScript = `
+local holder = redis.call('GET', KEYS[1])
+if holder == false or holder == ARGV[1] then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+	return 1
+end
+return 0`
+
+// renewLeaseScript extends a lease only while the caller still holds it
+const renewLeaseScript = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0`
+
+// releaseLeaseScript drops a lease only while the caller still holds it
+const releaseLeaseScript = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0`
+
+// storeStateScript writes the match state and appends the events logged since
+// the last write, only while the caller holds the lease, so an instance that
+// lost a match cannot overwrite its new owner's state. The stored event count
+// must match the caller's, so an event is never stored twice or skipped.
+const storeStateScript = `
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+if redis.call('LLEN', KEYS[3]) ~= tonumber(ARGV[4]) then
+	return -1
+end
+redis.call('SET', KEYS[2], ARGV[2], 'PX', ARGV[3])
+for i = 5, #ARGV do
+	redis.call('RPUSH', KEYS[3], ARGV[i])
+end
+redis.call('PEXPIRE', KEYS[3], ARGV[3])
+return 1`
+
+// errEventLogMismatch is returned when the stored event log is not the one a
+// state write continues from
+var errEventLogMismatch = errors.New("stored event log is out of step")
+
+// matchLeaseKey is the Redis key naming the instance that owns a match
+func matchLeaseKey(matchID string) string {
+	return fmt.Sprintf("match_lease:%s", matchID)
+}
+
+// leaseHolder identifies this instance in lease values as id@address
+func (ge *GameEngine) leaseHolder() string {
+	return ge.instanceID + "@" + ge.instanceAddr
+}
+
+// evalLease runs a lease script for a match and reports whether it succeeded
+func (ge *GameEngine) evalLease(ctx context.Context, script, matchID string) (bool, error) {
+	result, err := ge.dbManager.Redis().Eval(ctx, script, []string{matchLeaseKey(matchID)},
+		ge.leaseHolder(), matchLeaseTTL.Milliseconds())
+	if err != nil {
+		return false, err
+	}
+	ok, _ := result.(int64)
+	return ok == 1, nil
+}
+
+// matchStateKey is the Redis key holding the state shared with clients,
+// without its event log
+func matchStateKey(matchID string) string {
+	return fmt.Sprintf("match_state:%s", matchID)
+}
+
+// matchEventsKey is the Redis list holding a match's event log
+func matchEventsKey(matchID string) string {
+	return fmt.Sprintf("match_events:%s", matchID)
+}
+
+// encodeStoredState encodes what a state write stores: the state without its
+// event log, and the events logged after the first stored ones
+func encodeStoredState(state *models.MatchState, stored int64) ([]byte, []interface{}, error) {
+	if stored < 0 || stored > int64(len(state.ActionHistory)) {
+		return nil, nil, fmt.Errorf("%w: %d events stored of %d", errEventLogMismatch, stored, len(state.ActionHistory))
+	}
+
+	view := *state
+	view.ActionHistory = nil
+	data, err := json.Marshal(&view)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode match state: %w", err)
+	}
+
+	events := make([]interface{}, 0, int64(len(state.ActionHistory))-stored)
+	for _, event := range state.ActionHistory[stored:] {
+		raw, err := json.Marshal(event)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to encode match event: %w", err)
+		}
+		events = append(events, raw)
+	}
+	return data, events, nil
+}
+
+// storeState writes a match state whose first stored events are already in
+// Redis, fenced by this instance's lease on the match
+func (ge *GameEngine) storeState(ctx context.Context, matchID string, state *models.MatchState, stored int64) error {
+	data, events, err := encodeStoredState(state, stored)
+	if err != nil {
+		return err
+	}
+
+	args := append([]interface{}{ge.leaseHolder(), data, matchStateTTL.Milliseconds(), stored}, events...)
+	result, err := ge.dbManager.Redis().Eval(ctx, storeStateScript,
+		[]string{matchLeaseKey(matchID), matchStateKey(matchID), matchEventsKey(matchID)}, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update match state: %w", err)
+	}
+	switch written, _ := result.(int64); written {
+	case 1:
+		return nil
+	case 0:
+		return fmt.Errorf("%w: %s", errLeaseLost, matchID)
+	default:
+		return fmt.Errorf("%w: %s", errEventLogMismatch, matchID)
+	}
+}
+
+// persistMatchState stores a running match's state when its event log has
+// grown. A match whose state could not be stored is released, so it resumes
+// from the last stored state and the events that were not stored never happened.
+func (ge *GameEngine) persistMatchState(ctx context.Context, activeMatch *ActiveMatch) error {
+	select {
+	case <-activeMatch.released:
+		return fmt.Errorf("%w: %s", errLeaseLost, activeMatch.Match.ID)
+	default:
+	}
+	if activeMatch.State.Sequence == activeMatch.persistedSequence {
+		return nil
+	}
+
+	if err := ge.storeState(ctx, activeMatch.Match.ID, activeMatch.State, activeMatch.persistedSequence); err != nil {
+		activeMatch.release()
+		return err
+	}
+	activeMatch.persistedSequence = activeMatch.State.Sequence
+	return nil
+}
+
+// acquireLease claims a match for this instance
+func (ge *GameEngine) acquireLease(ctx context.Context, matchID string) (bool, error) {
+	acquired, err := ge.evalLease(ctx, acquireLeaseScript, matchID)
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire match lease: %w", err)
+	}
+	return acquired, nil
+}
+
+// releaseLease gives up this instance's claim on a match
+func (ge *GameEngine) releaseLease(ctx context.Context, matchID string) {
+	if _, err := ge.evalLease(ctx, releaseLeaseScript, matchID); err != nil {
+		ge.logger.Warn("Failed to release match lease",
+			zap.String("match_id", matchID),
+			zap.Error(err))
+	}
+}
+
+// MatchOwner returns the address of the instance that owns a match, and
+// whether that instance is this one. A match that is unfinished but has no
+// owner is taken over on the spot.
+func (ge *GameEngine) MatchOwner(ctx context.Context, matchID string) (string, bool, error) {
+	if _, exists := ge.GetMatch(matchID); exists {
+		return ge.instanceAddr, true, nil
+	}
+
+	holder, err := ge.dbManager.Redis().Get(ctx, matchLeaseKey(matchID))
+	if err == nil {
+		instanceID, addr, _ := strings.Cut(holder, "@")
+		return addr, instanceID == ge.instanceID, nil
+	}
+
+	tracked, err := ge.dbManager.Redis().SIsMember(ctx, activeMatchesKey, matchID)
+	if err != nil || !tracked {
+		return "", false, fmt.Errorf("%w: %s", errMatchNotFound, matchID)
+	}
+	if _, err := ge.claimMatch(ctx, matchID); err != nil {
+		return "", false, err
+	}
+	return ge.MatchOwner(ctx, matchID)
+}
+
+// claimMatch takes the lease on an unowned match and resumes it here,
+// reporting whether this instance now runs the match
+func (ge *GameEngine) claimMatch(ctx context.Context, matchID string) (bool, error) {
+	acquired, err := ge.acquireLease(ctx, matchID)
+	if err != nil || !acquired {
+		return false, err
+	}
+
+	activeMatch, err := ge.recoverMatch(ctx, matchID)
+	if err != nil {
+		ge.releaseLease(ctx, matchID)
+		return false, err
+	}
+	if activeMatch == nil {
+		// Expired or already finished
+		ge.untrackMatch(ctx, matchID)
+		ge.releaseLease(ctx, matchID)
+		return false, nil
+	}
+	activeMatch.leaseRenewedAt = time.Now()
+
+	ge.matchesMutex.Lock()
+	if _, exists := ge.activeMatches[matchID]; exists {
+		ge.matchesMutex.Unlock()
+		return true, nil
+	}
+	ge.activeMatches[matchID] = activeMatch
+	ge.matchesMutex.Unlock()
+
+	go ge.processMatch(activeMatch)
+
+	ge.logger.Info("Match claimed",
+		zap.String("match_id", matchID),
+		zap.String("phase", activeMatch.GamePhase),
+		zap.Int64("sequence", activeMatch.State.Sequence))
+	return true, nil
+}
+
+// renewLeases extends the lease on every local match and lets go of any
+// match whose lease was lost, so two instances never run it at once
+func (ge *GameEngine) renewLeases(ctx context.Context) {
+	ge.matchesMutex.RLock()
+	matches := make([]*ActiveMatch, 0, len(ge.activeMatches))
+	for _, activeMatch := range ge.activeMatches {
+		matches = append(matches, activeMatch)
+	}
+	ge.matchesMutex.RUnlock()
+
+	for _, activeMatch := range matches {
+		renewed, err := ge.evalLease(ctx, renewLeaseScript, activeMatch.Match.ID)
+		if err == nil && renewed {
+			activeMatch.leaseRenewedAt = time.Now()
+			continue
+		}
+
+		// Without Redis the lease may still be ours, until its TTL has passed
+		if err != nil && time.Since(activeMatch.leaseRenewedAt) < matchLeaseTTL {
+			ge.logger.Warn("Failed to renew match lease",
+				zap.String("match_id", activeMatch.Match.ID),
+				zap.Error(err))
+			continue
+		}
+
+		ge.logger.Warn("Match lease lost, handing match over",
+			zap.String("match_id", activeMatch.Match.ID))
+		activeMatch.release()
+	}
+}
+
+// leaseLoop keeps local leases alive and takes over matches whose owner has gone
+func (ge *GameEngine) leaseLoop() {
+	ticker := time.NewTicker(leaseRenewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), leaseRenewInterval)
+			ge.renewLeases(ctx)
+			if ge.acceptingMatches {
+				if _, err := ge.RecoverMatches(ctx); err != nil {
+					ge.logger.Warn("Failed to check for orphaned matches", zap.Error(err))
+				}
+			}
+			cancel()
+		case <-ge.stopChan:
+			return
+		}
+	}
+}
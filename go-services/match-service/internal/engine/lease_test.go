@@ -0,0 +1,81 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+func TestStoreStateFencing(t *testing.T) {
+	ctx := context.Background()
+	db := newMemoryDB()
+	ge := newMemoryEngine(db, "a")
+	state := newSyncState(4)
+
+	if acquired, err := ge.acquireLease(ctx, state.ID); err != nil || !acquired {
+		t.Fatalf("acquireLease() = %v, %v, want the free lease", acquired, err)
+	}
+	if err := ge.storeState(ctx, state.ID, state, 0); err != nil {
+		t.Fatalf("storeState() failed: %v", err)
+	}
+	if stored := len(db.redis.lists[matchEventsKey(state.ID)]); stored != 4 {
+		t.Fatalf("stored %d events, want 4", stored)
+	}
+
+	// A write that skips stored events, or repeats them, is refused
+	for _, stored := range []int64{2, 0} {
+		if err := ge.storeState(ctx, state.ID, state, stored); !errors.Is(err, errEventLogMismatch) {
+			t.Errorf("storeState() from %d events = %v, want %v", stored, err, errEventLogMismatch)
+		}
+	}
+
+	// Once the lease passes to another instance, this one can no longer write
+	ge.releaseLease(ctx, state.ID)
+	other := newMemoryEngine(db, "b")
+	if acquired, err := other.acquireLease(ctx, state.ID); err != nil || !acquired {
+		t.Fatalf("acquireLease() by b = %v, %v, want the released lease", acquired, err)
+	}
+	if acquired, err := ge.acquireLease(ctx, state.ID); err != nil || acquired {
+		t.Errorf("acquireLease() by a = %v, %v, want the lease held by b", acquired, err)
+	}
+	if err := ge.storeState(ctx, state.ID, state, 4); !errors.Is(err, errLeaseLost) {
+		t.Errorf("storeState() by a = %v, want %v", err, errLeaseLost)
+	}
+	if err := other.storeState(ctx, state.ID, state, 4); err != nil {
+		t.Errorf("storeState() by b failed: %v", err)
+	}
+}
+
+func TestCreateMatchLeaseHeld(t *testing.T) {
+	ctx := context.Background()
+	db := newMemoryDB()
+	other := newMemoryEngine(db, "b")
+	if acquired, err := other.acquireLease(ctx, "match"); err != nil || !acquired {
+		t.Fatalf("acquireLease() = %v, %v, want the free lease", acquired, err)
+	}
+
+	ge := newMemoryEngine(db, "a")
+	_, err := ge.CreateMatch(ctx, &models.Match{
+		ID:       "match",
+		GameMode: models.GameModeClassic,
+		Players:  []string{"p1", "p2"},
+	})
+	if err == nil {
+		t.Fatal("CreateMatch() succeeded without the lease")
+	}
+
+	if _, exists := ge.GetMatch("match"); exists {
+		t.Error("match without a lease was started")
+	}
+	if _, stored := db.firestore.docs[matchesCollection]["match"]; stored {
+		t.Error("match without a lease was stored")
+	}
+	if _, stored := db.redis.values[matchStateKey("match")]; stored {
+		t.Error("state of a match without a lease was stored")
+	}
+	if db.redis.sets[activeMatchesKey]["match"] {
+		t.Error("match without a lease was tracked for recovery")
+	}
+}
@@ -0,0 +1,152 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+// Loadout limits
+const (
+	maxLoadoutSize = 5
+	baseStarPoints = 5
+	maxStarPoints  = 15
+)
+
+// progressionCollection is the Firestore collection holding user levels and unlocks
+const progressionCollection = "userProgression"
+
+// errInvalidLoadout is returned when a submitted loadout breaks the loadout rules
+var errInvalidLoadout = errors.New("invalid loadout")
+
+// starterAbilities are unlocked for every player, including those without a progression record
+var starterAbilities = []string{abilityLuckTurner, abilityPanSlap, abilitySiphon, abilityHardHat}
+
+// starBudget returns the star points a player of the given level may spend on a loadout
+func starBudget(level int) int {
+	if level < 1 {
+		level = 1
+	}
+	if budget := baseStarPoints + level; budget < maxStarPoints {
+		return budget
+	}
+	return maxStarPoints
+}
+
+// loadProgression reads a player's progression, defaulting new players to level 1 with the starter abilities
+func (ge *GameEngine) loadProgression(ctx context.Context, playerID string) (*models.UserProgression, error) {
+	exists, err := ge.dbManager.Firestore().Exists(ctx, progressionCollection, playerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check progression for %s: %w", playerID, err)
+	}
+	if !exists {
+		return &models.UserProgression{
+			UserID:            playerID,
+			Level:             1,
+			UnlockedAbilities: starterAbilities,
+		}, nil
+	}
+
+	var progression models.UserProgression
+	if err := ge.dbManager.Firestore().Get(ctx, progressionCollection, playerID, &progression); err != nil {
+		return nil, fmt.Errorf("failed to load progression for %s: %w", playerID, err)
+	}
+	return &progression, nil
+}
+
+// validateLoadout checks a player's abilities against their unlocks and star budget
+func (ge *GameEngine) validateLoadout(abilityIDs []string, progression *models.UserProgression) (models.Loadout, error) {
+	loadout := models.Loadout{
+		Abilities:  make([]string, 0, len(abilityIDs)),
+		StarBudget: starBudget(progression.Level),
+	}
+	if len(abilityIDs) > maxLoadoutSize {
+		return loadout, fmt.Errorf("%w: at most %d abilities may be equipped", errInvalidLoadout, maxLoadoutSize)
+	}
+
+	unlocked := make(map[string]bool, len(progression.UnlockedAbilities)+len(starterAbilities))
+	for _, id := range starterAbilities {
+		unlocked[id] = true
+	}
+	for _, id := range progression.UnlockedAbilities {
+		unlocked[id] = true
+	}
+
+	categories := make(map[string]string)
+	for _, id := range abilityIDs {
+		ability, exists := ge.abilities.Get(id)
+		if !exists {
+			return loadout, fmt.Errorf("%w: unknown ability %s", errInvalidLoadout, id)
+		}
+		if !unlocked[id] {
+			return loadout, fmt.Errorf("%w: %s is not unlocked", errInvalidLoadout, ability.Name)
+		}
+		if other, taken := categories[ability.Category]; taken {
+			return loadout, fmt.Errorf("%w: %s and %s are both %s abilities", errInvalidLoadout, other, ability.Name, ability.Category)
+		}
+		categories[ability.Category] = ability.Name
+
+		loadout.Abilities = append(loadout.Abilities, id)
+		loadout.StarCost += ability.StarCost
+	}
+
+	if loadout.StarCost > loadout.StarBudget {
+		return loadout, fmt.Errorf("%w: costs %d stars, budget at level %d is %d",
+			errInvalidLoadout, loadout.StarCost, progression.Level, loadout.StarBudget)
+	}
+	return loadout, nil
+}
+
+// validateLoadouts validates every player's submitted loadout. Players who
+// submit none play without abilities, and bots who are given none play their
+// difficulty's.
+func (ge *GameEngine) validateLoadouts(ctx context.Context, match *models.Match) (map[string]models.Loadout, error) {
+	inMatch := make(map[string]bool, len(match.Players))
+	for _, playerID := range match.Players {
+		inMatch[playerID] = true
+	}
+	for playerID := range match.Loadouts {
+		if !inMatch[playerID] {
+			return nil, fmt.Errorf("%w: %s is not in the match", errInvalidLoadout, playerID)
+		}
+	}
+
+	loadouts := make(map[string]models.Loadout, len(match.Players))
+	for _, playerID := range match.Players {
+		abilityIDs := match.Loadouts[playerID]
+		level, bot := botLevelFor(match.Bots[playerID])
+		if bot && len(abilityIDs) == 0 {
+			abilityIDs = level.Loadout
+		}
+		if len(abilityIDs) == 0 {
+			loadouts[playerID] = models.Loadout{Abilities: make([]string, 0)}
+			continue
+		}
+
+		var progression *models.UserProgression
+		var err error
+		if bot {
+			progression = level.progression(ge.abilities.Abilities())
+		} else if progression, err = ge.loadProgression(ctx, playerID); err != nil {
+			return nil, err
+		}
+		loadout, err := ge.validateLoadout(abilityIDs, progression)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", playerID, err)
+		}
+		loadouts[playerID] = loadout
+	}
+	return loadouts, nil
+}
+
+// hasEquipped reports whether an ability is in a player's loadout
+func hasEquipped(player models.MatchPlayer, abilityID string) bool {
+	for _, id := range player.Loadout.Abilities {
+		if id == abilityID {
+			return true
+		}
+	}
+	return false
+}
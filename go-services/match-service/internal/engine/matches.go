@@ -0,0 +1,375 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/database"
+	apperrors "github.com/LukeAtkinz/dashdice/go-services/shared/errors"
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+// matchesCollection is the Firestore collection holding match records
+const matchesCollection = "matches"
+
+// errMatchInProgress is returned for changes that are only allowed once a match has ended
+var errMatchInProgress = errors.New("match is still in progress")
+
+// matchUpdate lists the settings that may change while a match is played.
+// Settings left nil keep their value.
+type matchUpdate struct {
+	SpectatorMode     *bool `json:"spectator_mode,omitempty"`
+	PauseOnDisconnect *bool `json:"pause_on_disconnect,omitempty"`
+}
+
+// empty reports whether the update changes nothing
+func (u matchUpdate) empty() bool {
+	return u.SpectatorMode == nil && u.PauseOnDisconnect == nil
+}
+
+// MatchRecord returns a match's record, brought up to date from the live
+// state when this instance is running the match
+func (ge *GameEngine) MatchRecord(ctx context.Context, matchID string) (*models.Match, error) {
+	if activeMatch, exists := ge.GetMatch(matchID); exists {
+		return liveMatchRecord(activeMatch), nil
+	}
+
+	firestore := ge.dbManager.Firestore()
+	exists, err := firestore.Exists(ctx, matchesCollection, matchID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check match record: %w", err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", errMatchNotFound, matchID)
+	}
+
+	var match models.Match
+	if err := firestore.Get(ctx, matchesCollection, matchID, &match); err != nil {
+		return nil, fmt.Errorf("failed to load match record: %w", err)
+	}
+	return &match, nil
+}
+
+// liveMatchRecord copies a running match's record with its current status and scores
+func liveMatchRecord(activeMatch *ActiveMatch) *models.Match {
+	activeMatch.mutex.RLock()
+	defer activeMatch.mutex.RUnlock()
+
+	state := activeMatch.State
+	match := *activeMatch.Match
+	match.Status = state.Status
+	match.Players = state.Players
+	match.PlayerIDs = state.Players
+	match.UpdatedAt = state.UpdatedAt
+	match.CompletedAt = state.CompletedAt
+	match.Winner = state.Winner
+	match.Scores = make(map[string]int, len(state.Scores))
+	for playerID, score := range state.Scores {
+		match.Scores[playerID] = score
+	}
+	return &match
+}
+
+// storeMatchResult brings the match record up to date with how the match ended
+func (ge *GameEngine) storeMatchResult(ctx context.Context, state *models.MatchState) {
+	err := ge.dbManager.Firestore().Update(ctx, matchesCollection, state.ID, map[string]interface{}{
+		"status":      state.Status,
+		"winner":      state.Winner,
+		"scores":      state.Scores,
+		"completedAt": state.CompletedAt,
+		"updatedAt":   state.UpdatedAt,
+	})
+	if err != nil {
+		ge.logger.Error("Failed to store match result",
+			zap.String("match_id", state.ID),
+			zap.Error(err))
+	}
+}
+
+// MatchState returns a copy of a match's state: the live state when this
+// instance is running the match, the last stored state otherwise
+func (ge *GameEngine) MatchState(ctx context.Context, matchID string) (*models.MatchState, error) {
+	activeMatch, exists := ge.GetMatch(matchID)
+	if !exists {
+		return ge.loadStoredState(ctx, matchID)
+	}
+
+	activeMatch.mutex.RLock()
+	raw, err := json.Marshal(activeMatch.State)
+	activeMatch.mutex.RUnlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode match state: %w", err)
+	}
+
+	var state models.MatchState
+	if err := json.Unmarshal(raw, &state); err != nil {
+		return nil, fmt.Errorf("failed to copy match state: %w", err)
+	}
+	return &state, nil
+}
+
+// RestoreMatchState rewrites an ended match's stored state from the server's
+// own record of its events, e.g. after the stored state was lost: the stored
+// event log, or the replay kept when the match ended. Only ended matches can
+// be restored: a running match is written by its owner alone.
+func (ge *GameEngine) RestoreMatchState(ctx context.Context, matchID string) (*models.MatchState, error) {
+	if _, exists := ge.GetMatch(matchID); exists {
+		return nil, fmt.Errorf("%w: %s", errMatchInProgress, matchID)
+	}
+
+	events, err := ge.loadStoredEvents(ctx, matchID)
+	if err != nil {
+		return nil, err
+	}
+	storedEvents := int64(len(events))
+	if len(events) == 0 {
+		replay, err := ge.recordedReplay(ctx, matchID)
+		if err != nil {
+			return nil, err
+		}
+		if replay == nil {
+			return nil, fmt.Errorf("%w: %s", errMatchNotFound, matchID)
+		}
+		events = replay.events
+	}
+
+	state, err := ge.replayMatch(events, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to replay match events: %w", err)
+	}
+	if state.CompletedAt == nil {
+		return nil, fmt.Errorf("%w: %s", errMatchInProgress, matchID)
+	}
+
+	// Never swap a longer log for a shorter one
+	stored, err := ge.loadStoredState(ctx, matchID)
+	if err != nil && !errors.Is(err, errMatchNotFound) {
+		return nil, err
+	}
+	if stored != nil && stored.Sequence > state.Sequence {
+		return nil, apperrors.Conflict("stored state has more events than the event log").
+			AddDetail("stored_sequence", stored.Sequence).
+			AddDetail("log_sequence", state.Sequence)
+	}
+
+	// Hold the lease while writing, so a match resumed elsewhere in the
+	// meantime is never overwritten
+	acquired, err := ge.acquireLease(ctx, matchID)
+	if err != nil {
+		return nil, err
+	}
+	if !acquired {
+		return nil, fmt.Errorf("%w: %s", errMatchInProgress, matchID)
+	}
+	defer ge.releaseLease(ctx, matchID)
+
+	if err := ge.storeState(ctx, matchID, state, storedEvents); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// UpdateMatch changes the settings of a running match, recording the change
+// in its event log
+func (ge *GameEngine) UpdateMatch(matchID string, update matchUpdate) (*models.GameAction, error) {
+	activeMatch, exists := ge.GetMatch(matchID)
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", errMatchNotFound, matchID)
+	}
+
+	data, err := eventData(update)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return ge.submitAction(activeMatch, &models.GameAction{
+		ID:        fmt.Sprintf("%s_%s_%d", eventUpdateMatch, matchID, now.UnixNano()),
+		MatchID:   matchID,
+		PlayerID:  "", // System action
+		Type:      eventUpdateMatch,
+		Timestamp: now,
+		Data:      data,
+	}, nil)
+}
+
+// handleUpdateMatch applies an update_match event
+func (ge *GameEngine) handleUpdateMatch(activeMatch *ActiveMatch, action *models.GameAction) error {
+	state := activeMatch.State
+	if state.CompletedAt != nil {
+		return fmt.Errorf("match has already ended")
+	}
+
+	var update matchUpdate
+	if err := decodeSettings(action.Data, &update); err != nil {
+		return fmt.Errorf("invalid %s event: %w", eventUpdateMatch, err)
+	}
+	if update.SpectatorMode != nil {
+		if *update.SpectatorMode {
+			for _, playerID := range state.Players {
+				if state.PlayerData[playerID].SpectatingDisabled {
+					return fmt.Errorf("%s has disabled spectating", playerID)
+				}
+			}
+		} else {
+			removeSpectators(state)
+		}
+		state.Settings.SpectatorMode = *update.SpectatorMode
+	}
+	if update.PauseOnDisconnect != nil {
+		state.Settings.PauseOnDisconnect = *update.PauseOnDisconnect
+	}
+
+	appendEvent(state, action, &models.GameActionResult{
+		Success: true,
+		Message: "Match settings updated",
+		Data:    action.Data,
+	})
+	return nil
+}
+
+// ProcessTurn makes the current player's pending decision for them, as if
+// their clock had run out, for services that keep turn time themselves. The
+// decision is taken against the given state version, or the current one when
+// it is 0, so a retried request never takes a second turn.
+func (ge *GameEngine) ProcessTurn(matchID string, expectedVersion int64) (*models.GameAction, error) {
+	activeMatch, exists := ge.GetMatch(matchID)
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", errMatchNotFound, matchID)
+	}
+
+	activeMatch.mutex.RLock()
+	paused := activeMatch.State.Pause != nil
+	if expectedVersion == 0 {
+		expectedVersion = activeMatch.State.Sequence
+	}
+	action := turnTimeoutAction(activeMatch, time.Now())
+	activeMatch.mutex.RUnlock()
+
+	// The move depends on the state, so a retry made after the turn was
+	// taken is answered before a new move is worked out
+	action.ID = fmt.Sprintf("turn_%s_%d", matchID, expectedVersion)
+	action.ExpectedVersion = expectedVersion
+	if outcome, done := activeMatch.findOutcome(action.ID); done {
+		return outcome.event, outcome.err
+	}
+	if paused {
+		return nil, apperrors.InvalidMove("match is paused")
+	}
+	return ge.submitAction(activeMatch, action, ge.validateGameAction)
+}
+
+// EndMatch ends a running match early: as a forfeit by the given player, or
+// as a no contest when none is given. A match ends only once, so repeated
+// requests get the original end_match event back.
+func (ge *GameEngine) EndMatch(matchID, forfeitedBy string) (*models.GameAction, error) {
+	activeMatch, exists := ge.GetMatch(matchID)
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", errMatchNotFound, matchID)
+	}
+
+	data := map[string]interface{}{
+		"reason": models.WinReasonVoid,
+		"cause":  voidCauseEnded,
+	}
+	if forfeitedBy != "" {
+		activeMatch.mutex.RLock()
+		_, inMatch := activeMatch.State.PlayerData[forfeitedBy]
+		activeMatch.mutex.RUnlock()
+		if !inMatch {
+			return nil, fmt.Errorf("%w: %s", errPlayerNotInMatch, forfeitedBy)
+		}
+		data = concededMatch(models.WinReasonForfeit, forfeitedBy)
+	}
+
+	return ge.submitAction(activeMatch, &models.GameAction{
+		ID:        fmt.Sprintf("%s_request_%s", eventEndMatch, matchID),
+		MatchID:   matchID,
+		PlayerID:  "", // System action
+		Type:      eventEndMatch,
+		Timestamp: time.Now(),
+		Data:      data,
+	}, nil)
+}
+
+// endMatchOnRequest ends a match another service asked to end, answering the
+// request with the end_match event
+func (ge *GameEngine) endMatchOnRequest(activeMatch *ActiveMatch, action *models.GameAction) {
+	ge.logger.Info("Ending match on request",
+		zap.String("match_id", activeMatch.Match.ID),
+		zap.Any("reason", action.Data["reason"]))
+	ge.finishMatch(activeMatch, action.Data)
+
+	outcome := &actionOutcome{playerID: action.PlayerID}
+	activeMatch.mutex.RLock()
+	if last := activeMatch.State.LastAction; last != nil && last.Type == eventEndMatch {
+		event := *last
+		outcome.event = &event
+	} else {
+		outcome.err = fmt.Errorf("failed to end match %s", activeMatch.Match.ID)
+	}
+	activeMatch.mutex.RUnlock()
+	activeMatch.recordOutcome(action.ID, outcome)
+}
+
+// DeleteMatch removes an ended match's record, stored state and replay
+func (ge *GameEngine) DeleteMatch(ctx context.Context, matchID string) error {
+	if _, exists := ge.GetMatch(matchID); exists {
+		return fmt.Errorf("%w: %s", errMatchInProgress, matchID)
+	}
+
+	// A stored state without an ending belongs to a match another instance runs
+	stored, err := ge.loadStoredState(ctx, matchID)
+	if err != nil && !errors.Is(err, errMatchNotFound) {
+		return err
+	}
+	if stored != nil && stored.CompletedAt == nil {
+		return fmt.Errorf("%w: %s", errMatchInProgress, matchID)
+	}
+
+	firestore := ge.dbManager.Firestore()
+	recorded, err := firestore.Exists(ctx, matchesCollection, matchID)
+	if err != nil {
+		return fmt.Errorf("failed to check match record: %w", err)
+	}
+	if !recorded && stored == nil {
+		return fmt.Errorf("%w: %s", errMatchNotFound, matchID)
+	}
+
+	if recorded {
+		if err := firestore.Delete(ctx, matchesCollection, matchID); err != nil {
+			return fmt.Errorf("failed to delete match record: %w", err)
+		}
+	}
+	if err := ge.dbManager.Redis().Delete(ctx, matchStateKey(matchID), matchEventsKey(matchID)); err != nil {
+		return fmt.Errorf("failed to delete match state: %w", err)
+	}
+
+	return ge.deleteReplay(ctx, matchID)
+}
+
+// UserMatches returns up to limit of a user's matches, newest first, created
+// before the given time when it is set. Matches running here are reported live.
+func (ge *GameEngine) UserMatches(ctx context.Context, userID string, limit int, before time.Time) ([]models.Match, error) {
+	firestore := ge.dbManager.Firestore()
+	opts := []database.QueryOption{firestore.Where("playerIds", "array-contains", userID)}
+	if !before.IsZero() {
+		opts = append(opts, firestore.Where("createdAt", "<", before))
+	}
+	opts = append(opts, firestore.OrderBy("createdAt", database.Desc), firestore.Limit(limit))
+
+	var matches []models.Match
+	if err := firestore.List(ctx, matchesCollection, &matches, opts...); err != nil {
+		return nil, fmt.Errorf("failed to list matches: %w", err)
+	}
+	for i := range matches {
+		if activeMatch, exists := ge.GetMatch(matches[i].ID); exists {
+			matches[i] = *liveMatchRecord(activeMatch)
+		}
+	}
+	return matches, nil
+}
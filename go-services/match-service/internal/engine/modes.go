@@ -0,0 +1,646 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/database"
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+// gameModesCollection is the Firestore collection holding game mode documents
+const gameModesCollection = "gameModes"
+
+// GameModeRules defines the rules a game mode plugs into the engine
+type GameModeRules interface {
+	// Config returns the configuration the rules were built with
+	Config() ModeConfig
+
+	// Initialize prepares mode specific state before the first turn
+	Initialize(activeMatch *ActiveMatch) error
+
+	// ProcessRoll applies a dice roll for the current player
+	ProcessRoll(state *models.MatchState, roll *models.DiceRoll) *models.GameActionResult
+
+	// ProcessBank banks the current player's turn score
+	ProcessBank(state *models.MatchState, playerID string) *models.GameActionResult
+
+	// CheckWin reports whether the match is decided and who won
+	CheckWin(state *models.MatchState) (winner string, finished bool)
+
+	// OnTurnEnd runs when playerID's turn is over, before the win check
+	OnTurnEnd(state *models.MatchState, playerID string)
+}
+
+// TurnOrderRules is implemented by game modes that do not simply rotate seats
+type TurnOrderRules interface {
+	NextPlayer(state *models.MatchState) string
+}
+
+// nextTurnPlayer picks who plays next, deferring to the mode when it controls turn order
+func nextTurnPlayer(rules GameModeRules, state *models.MatchState) string {
+	if ordered, ok := rules.(TurnOrderRules); ok {
+		return ordered.NextPlayer(state)
+	}
+	return nextPlayerID(state)
+}
+
+// ModeConfig holds the tunable parameters of a game mode
+type ModeConfig struct {
+	ID            string                 `json:"id"`
+	DisplayName   string                 `json:"display_name"`
+	Enabled       bool                   `json:"enabled"`
+	MinPlayers    int                    `json:"min_players"`
+	MaxPlayers    int                    `json:"max_players"`
+	StartingScore int                    `json:"starting_score"`
+	TargetScore   int                    `json:"target_score"`
+	TurnTime      time.Duration          `json:"turn_time"`
+	RollTime      time.Duration          `json:"roll_time,omitempty"` // Limit for a roll decision, 0 keeps the match default
+	BankTime      time.Duration          `json:"bank_time,omitempty"` // Limit for a bank decision, 0 keeps the match default
+	MaxTurns      int                    `json:"max_turns,omitempty"`
+	Settings      map[string]interface{} `json:"settings,omitempty"`
+}
+
+// ModeFactory builds the rules for a match from the mode configuration
+type ModeFactory func(config ModeConfig) (GameModeRules, error)
+
+// registeredMode pairs a mode factory with its current configuration
+type registeredMode struct {
+	factory ModeFactory
+	config  ModeConfig
+}
+
+// ModeRegistry holds all game modes the engine can run
+type ModeRegistry struct {
+	modes   map[string]*registeredMode
+	aliases map[string]string
+	mutex   sync.RWMutex
+}
+
+// NewModeRegistry creates an empty mode registry
+func NewModeRegistry() *ModeRegistry {
+	return &ModeRegistry{
+		modes:   make(map[string]*registeredMode),
+		aliases: make(map[string]string),
+	}
+}
+
+// Register adds a game mode with its default configuration
+func (mr *ModeRegistry) Register(id string, factory ModeFactory, defaults ModeConfig) {
+	mr.mutex.Lock()
+	defer mr.mutex.Unlock()
+
+	defaults.ID = id
+	mr.modes[id] = &registeredMode{
+		factory: factory,
+		config:  defaults,
+	}
+}
+
+// Alias lets a mode be requested under an alternative name
+func (mr *ModeRegistry) Alias(alias, id string) {
+	mr.mutex.Lock()
+	defer mr.mutex.Unlock()
+
+	mr.aliases[alias] = id
+}
+
+// resolveID maps an alias to its mode ID; callers must hold the mutex
+func (mr *ModeRegistry) resolveID(id string) string {
+	if target, ok := mr.aliases[strings.ToLower(id)]; ok {
+		return target
+	}
+	return id
+}
+
+// Configure replaces the configuration of a registered mode
+func (mr *ModeRegistry) Configure(id string, config ModeConfig) error {
+	mr.mutex.Lock()
+	defer mr.mutex.Unlock()
+
+	id = mr.resolveID(id)
+	mode, exists := mr.modes[id]
+	if !exists {
+		return fmt.Errorf("unsupported game mode: %s", id)
+	}
+
+	config.ID = id
+	if _, err := mode.factory(config); err != nil {
+		return fmt.Errorf("invalid game mode %s: %w", id, err)
+	}
+	mode.config = config
+	return nil
+}
+
+// ModeConfig returns the current configuration of a mode
+func (mr *ModeRegistry) ModeConfig(id string) (ModeConfig, bool) {
+	mr.mutex.RLock()
+	defer mr.mutex.RUnlock()
+
+	mode, exists := mr.modes[mr.resolveID(id)]
+	if !exists {
+		return ModeConfig{}, false
+	}
+	return mode.config, true
+}
+
+// Modes returns the IDs of all registered modes
+func (mr *ModeRegistry) Modes() []string {
+	mr.mutex.RLock()
+	defer mr.mutex.RUnlock()
+
+	ids := make([]string, 0, len(mr.modes))
+	for id := range mr.modes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Rules builds the rules for a new match, applying per-match setting overrides
+func (mr *ModeRegistry) Rules(id string, overrides map[string]interface{}) (GameModeRules, error) {
+	mr.mutex.RLock()
+	mode, exists := mr.modes[mr.resolveID(id)]
+	var config ModeConfig
+	if exists {
+		config = mode.config
+	}
+	mr.mutex.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("unsupported game mode: %s", id)
+	}
+	if !config.Enabled {
+		return nil, fmt.Errorf("game mode disabled: %s", id)
+	}
+
+	config, err := applyModeOverrides(config, overrides)
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := mode.factory(config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid settings for game mode %s: %w", id, err)
+	}
+	return rules, nil
+}
+
+// RecordedRules rebuilds the rules of an existing match from the configuration
+// it was created with, so later changes to the mode do not alter the match
+func (mr *ModeRegistry) RecordedRules(config ModeConfig) (GameModeRules, error) {
+	mr.mutex.RLock()
+	mode, exists := mr.modes[mr.resolveID(config.ID)]
+	mr.mutex.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("unsupported game mode: %s", config.ID)
+	}
+
+	rules, err := mode.factory(config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recorded configuration for game mode %s: %w", config.ID, err)
+	}
+	return rules, nil
+}
+
+// LoadGameModes refreshes registered modes from their Firestore documents.
+// Modes without a document keep their built-in defaults.
+func (mr *ModeRegistry) LoadGameModes(ctx context.Context, firestore database.FirestoreRepository) (int, error) {
+	loaded := 0
+	for _, id := range mr.Modes() {
+		exists, err := firestore.Exists(ctx, gameModesCollection, id)
+		if err != nil {
+			return loaded, fmt.Errorf("failed to check game mode %s: %w", id, err)
+		}
+		if !exists {
+			continue
+		}
+
+		var doc models.GameMode
+		if err := firestore.Get(ctx, gameModesCollection, id, &doc); err != nil {
+			return loaded, fmt.Errorf("failed to load game mode %s: %w", id, err)
+		}
+
+		base, _ := mr.ModeConfig(id)
+		config, err := modeConfigFromDocument(&doc, base)
+		if err != nil {
+			return loaded, fmt.Errorf("invalid game mode %s: %w", id, err)
+		}
+		if err := mr.Configure(id, config); err != nil {
+			return loaded, err
+		}
+		loaded++
+	}
+	return loaded, nil
+}
+
+// modeConfigFromDocument overlays a Firestore game mode document on a base configuration
+func modeConfigFromDocument(doc *models.GameMode, base ModeConfig) (ModeConfig, error) {
+	config := base
+	config.Enabled = doc.IsActive
+	if doc.DisplayName != "" {
+		config.DisplayName = doc.DisplayName
+	}
+	if doc.MinPlayers > 0 {
+		config.MinPlayers = doc.MinPlayers
+	}
+	if doc.MaxPlayers > 0 {
+		config.MaxPlayers = doc.MaxPlayers
+	}
+
+	// Typed settings shared by every mode
+	var settings models.GameModeSettings
+	raw, err := json.Marshal(doc.Settings)
+	if err != nil {
+		return config, err
+	}
+	if err := json.Unmarshal(raw, &settings); err != nil {
+		return config, err
+	}
+	if settings.ScoreToWin > 0 {
+		config.TargetScore = settings.ScoreToWin
+	}
+	if settings.TimePerTurn > 0 {
+		config.TurnTime = time.Duration(settings.TimePerTurn) * time.Second
+	}
+	if settings.RoundLimit > 0 {
+		config.MaxTurns = settings.RoundLimit
+	}
+
+	// Mode specific settings are passed through untouched
+	merged := make(map[string]interface{}, len(base.Settings)+len(doc.Settings))
+	for key, value := range base.Settings {
+		merged[key] = value
+	}
+	for key, value := range doc.Settings {
+		merged[key] = value
+	}
+	config.Settings = merged
+
+	return config, nil
+}
+
+// applyModeOverrides applies per-match settings on top of a mode configuration
+func applyModeOverrides(config ModeConfig, overrides map[string]interface{}) (ModeConfig, error) {
+	if len(overrides) == 0 {
+		return config, nil
+	}
+
+	var values matchOverrides
+	if err := decodeSettings(overrides, &values); err != nil {
+		return config, err
+	}
+	if values.TargetScore != nil {
+		config.TargetScore = *values.TargetScore
+	}
+	if values.MaxTurns != nil {
+		config.MaxTurns = *values.MaxTurns
+	}
+	if values.TurnTime > 0 {
+		config.TurnTime = time.Duration(values.TurnTime) * time.Second
+	}
+	if values.RollTime > 0 {
+		config.RollTime = time.Duration(values.RollTime) * time.Second
+	}
+	if values.BankTime > 0 {
+		config.BankTime = time.Duration(values.BankTime) * time.Second
+	}
+
+	merged := make(map[string]interface{}, len(config.Settings)+len(overrides))
+	for key, value := range config.Settings {
+		merged[key] = value
+	}
+	for key, value := range overrides {
+		merged[key] = value
+	}
+	config.Settings = merged
+
+	return config, nil
+}
+
+// intSetting reads a numeric setting regardless of how it was decoded
+func intSetting(settings map[string]interface{}, key string, fallback int) int {
+	switch value := settings[key].(type) {
+	case int:
+		return value
+	case int32:
+		return int(value)
+	case int64:
+		return int(value)
+	case float32:
+		return int(value)
+	case float64:
+		return int(value)
+	default:
+		return fallback
+	}
+}
+
+// stringListSetting reads a list of strings regardless of how it was decoded
+func stringListSetting(settings map[string]interface{}, key string) []string {
+	switch value := settings[key].(type) {
+	case []string:
+		return append([]string(nil), value...)
+	case []interface{}:
+		list := make([]string, 0, len(value))
+		for _, item := range value {
+			if str, ok := item.(string); ok {
+				list = append(list, str)
+			}
+		}
+		return list
+	default:
+		return nil
+	}
+}
+
+// intMapSetting reads a map of integers regardless of how it was decoded
+func intMapSetting(settings map[string]interface{}, key string) map[string]int {
+	result := make(map[string]int)
+	switch value := settings[key].(type) {
+	case map[string]int:
+		for k, v := range value {
+			result[k] = v
+		}
+	case map[string]interface{}:
+		for k := range value {
+			result[k] = intSetting(value, k, 0)
+		}
+	}
+	return result
+}
+
+// containsString reports whether list holds value
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultModeRegistry registers the built-in game modes
+func defaultModeRegistry() *ModeRegistry {
+	registry := NewModeRegistry()
+
+	registry.Register(models.GameModeQuickfire, newClassicRules, ModeConfig{
+		DisplayName: "Quickfire",
+		Enabled:     true,
+		MinPlayers:  2,
+		MaxPlayers:  4,
+		TargetScore: 50,
+		TurnTime:    30 * time.Second,
+		MaxTurns:    50,
+	})
+	registry.Alias("quick fire", models.GameModeQuickfire)
+	registry.Alias("quick_fire", models.GameModeQuickfire)
+
+	registry.Register(models.GameModeClassic, newClassicRules, ModeConfig{
+		DisplayName: "Classic",
+		Enabled:     true,
+		MinPlayers:  2,
+		MaxPlayers:  6,
+		TargetScore: 100,
+		TurnTime:    60 * time.Second,
+		MaxTurns:    50,
+	})
+
+	registry.Register(models.GameModeBlitz, newBlitzRules, ModeConfig{
+		DisplayName: "Blitz",
+		Enabled:     true,
+		MinPlayers:  2,
+		MaxPlayers:  6,
+		TargetScore: 50,
+		TurnTime:    15 * time.Second,
+		MaxTurns:    50,
+	})
+
+	registry.Register(models.GameModeTournament, newTournamentRules, ModeConfig{
+		DisplayName: "Tournament",
+		Enabled:     true,
+		MinPlayers:  2,
+		MaxPlayers:  6,
+		TargetScore: 100,
+		TurnTime:    45 * time.Second,
+		MaxTurns:    50,
+	})
+
+	registry.Register(models.GameModeCustom, newCustomRules, ModeConfig{
+		DisplayName: "Custom",
+		Enabled:     true,
+		MinPlayers:  2,
+		MaxPlayers:  6,
+		TargetScore: 100,
+		TurnTime:    60 * time.Second,
+		MaxTurns:    50,
+	})
+
+	registry.Register(models.GameModeZeroHour, newZeroHourRules, ModeConfig{
+		DisplayName:   "Zero Hour",
+		Enabled:       true,
+		MinPlayers:    2,
+		MaxPlayers:    4,
+		StartingScore: 100,
+		TargetScore:   0,
+		TurnTime:      45 * time.Second,
+		MaxTurns:      50,
+	})
+	registry.Alias("zerohour", models.GameModeZeroHour)
+	registry.Alias("zero hour", models.GameModeZeroHour)
+	registry.Alias("zero_hour", models.GameModeZeroHour)
+
+	registry.Register(models.GameModeLastLine, newLastLineRules, ModeConfig{
+		DisplayName: "Last Line",
+		Enabled:     true,
+		MinPlayers:  2,
+		MaxPlayers:  6,
+		TurnTime:    15 * time.Second,
+		MaxTurns:    50,
+	})
+	registry.Alias("lastline", models.GameModeLastLine)
+	registry.Alias("last line", models.GameModeLastLine)
+	registry.Alias("last_line", models.GameModeLastLine)
+
+	registry.Register(models.GameModeTrueGrit, newTrueGritRules, ModeConfig{
+		DisplayName: "True Grit",
+		Enabled:     true,
+		MinPlayers:  2,
+		MaxPlayers:  4,
+		TurnTime:    60 * time.Second,
+		MaxTurns:    50,
+	})
+	registry.Alias("truegrit", models.GameModeTrueGrit)
+	registry.Alias("true grit", models.GameModeTrueGrit)
+	registry.Alias("true_grit", models.GameModeTrueGrit)
+
+	return registry
+}
+
+// classicRules plays first-to-target with the standard two-dice scoring.
+// Quickfire uses the same rules with a lower target.
+type classicRules struct {
+	config ModeConfig
+}
+
+func newClassicRules(config ModeConfig) (GameModeRules, error) {
+	return &classicRules{config: config}, nil
+}
+
+// Config returns the mode configuration
+func (cr *classicRules) Config() ModeConfig {
+	return cr.config
+}
+
+// Initialize sets the target and turn clock for the match
+func (cr *classicRules) Initialize(activeMatch *ActiveMatch) error {
+	activeMatch.State.Status = "active"
+	activeMatch.State.Settings.WinCondition = cr.config.TargetScore
+	activeMatch.State.Settings.MaxTurns = cr.config.MaxTurns
+
+	activeMatch.State.GameModeData = map[string]interface{}{
+		"target_score": cr.config.TargetScore,
+	}
+
+	for _, playerID := range activeMatch.State.Players {
+		activeMatch.State.Scores[playerID] = cr.config.StartingScore
+	}
+
+	return nil
+}
+
+// ProcessRoll applies the classic scoring rules
+func (cr *classicRules) ProcessRoll(state *models.MatchState, roll *models.DiceRoll) *models.GameActionResult {
+	return applyRoll(state, roll)
+}
+
+// ProcessBank adds the turn score to the player's total
+func (cr *classicRules) ProcessBank(state *models.MatchState, playerID string) *models.GameActionResult {
+	return bankTurnScore(state, playerID)
+}
+
+// CheckWin finishes the match once a player reaches the target score
+func (cr *classicRules) CheckWin(state *models.MatchState) (string, bool) {
+	winner := ""
+	best := 0
+	for _, playerID := range state.Players {
+		if score := state.Scores[playerID]; score >= cr.config.TargetScore && score > best {
+			winner = playerID
+			best = score
+		}
+	}
+	return winner, winner != ""
+}
+
+// OnTurnEnd has no classic specific behaviour
+func (cr *classicRules) OnTurnEnd(state *models.MatchState, playerID string) {}
+
+// blitzRules plays classic scoring against a chess clock for each player
+type blitzRules struct {
+	classicRules
+	settings blitzSettings
+}
+
+func newBlitzRules(config ModeConfig) (GameModeRules, error) {
+	settings := blitzSettings{TimeBank: 120, Increment: 2}
+	if err := decodeSettings(config.Settings, &settings); err != nil {
+		return nil, err
+	}
+	return &blitzRules{classicRules: classicRules{config: config}, settings: settings}, nil
+}
+
+// Initialize gives every player their time bank on top of the classic setup.
+// A player whose flag falls loses.
+func (br *blitzRules) Initialize(activeMatch *ActiveMatch) error {
+	if err := br.classicRules.Initialize(activeMatch); err != nil {
+		return err
+	}
+
+	state := activeMatch.State
+	state.TimeBanks = newTimeBanks(state.Players, seconds(br.settings.TimeBank), seconds(br.settings.Increment))
+	state.GameModeData["time_bank"] = br.settings.TimeBank
+	state.GameModeData["increment"] = br.settings.Increment
+	return nil
+}
+
+// tournamentRules plays classic scoring with bracket metadata
+type tournamentRules struct {
+	classicRules
+	settings tournamentSettings
+}
+
+func newTournamentRules(config ModeConfig) (GameModeRules, error) {
+	settings := tournamentSettings{Elimination: true}
+	if err := decodeSettings(config.Settings, &settings); err != nil {
+		return nil, err
+	}
+	return &tournamentRules{classicRules: classicRules{config: config}, settings: settings}, nil
+}
+
+// Initialize records the bracket position alongside the classic setup
+func (tr *tournamentRules) Initialize(activeMatch *ActiveMatch) error {
+	if err := tr.classicRules.Initialize(activeMatch); err != nil {
+		return err
+	}
+
+	// Get bracket position from match settings
+	var bracketPosition interface{}
+	if activeMatch.Match.Settings != nil {
+		bracketPosition = activeMatch.Match.Settings["bracket_position"]
+	}
+
+	activeMatch.State.GameModeData["elimination"] = tr.settings.Elimination
+	activeMatch.State.GameModeData["bracket_position"] = bracketPosition
+	return nil
+}
+
+// customRules plays classic scoring with host supplied settings
+type customRules struct {
+	classicRules
+	settings customSettings
+}
+
+func newCustomRules(config ModeConfig) (GameModeRules, error) {
+	var settings customSettings
+	if err := decodeSettings(config.Settings, &settings); err != nil {
+		return nil, err
+	}
+	return &customRules{classicRules: classicRules{config: config}, settings: settings}, nil
+}
+
+// Initialize exposes the custom rule set alongside the classic setup
+func (cr *customRules) Initialize(activeMatch *ActiveMatch) error {
+	if err := cr.classicRules.Initialize(activeMatch); err != nil {
+		return err
+	}
+	activeMatch.State.GameModeData["custom_rules"] = cr.settings.CustomRules
+	return nil
+}
+
+// leadingPlayer returns the player with the highest score, or "" on a tie
+func leadingPlayer(state *models.MatchState) string {
+	leader := ""
+	best := 0
+	tied := false
+	for _, playerID := range state.Players {
+		score := state.Scores[playerID]
+		switch {
+		case leader == "" || score > best:
+			leader = playerID
+			best = score
+			tied = false
+		case score == best:
+			tied = true
+		}
+	}
+	if tied {
+		return ""
+	}
+	return leader
+}
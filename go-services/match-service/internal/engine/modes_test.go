@@ -0,0 +1,167 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+// newModeMatch initializes a match of the given mode for the players, with
+// the first player to act
+func newModeMatch(t *testing.T, mode string, settings map[string]interface{}, players ...string) (GameModeRules, *models.MatchState) {
+	t.Helper()
+	rules, err := defaultModeRegistry().Rules(mode, settings)
+	if err != nil {
+		t.Fatalf("failed to build %s rules: %v", mode, err)
+	}
+	state := &models.MatchState{
+		Players:      players,
+		Scores:       make(map[string]int),
+		Multipliers:  make(map[string]int),
+		GameModeData: make(map[string]interface{}),
+		CurrentTurn:  players[0],
+		TurnNumber:   1,
+	}
+	activeMatch := &ActiveMatch{Match: &models.Match{ID: "match", GameMode: mode, Settings: settings}, State: state, Rules: rules}
+	if err := rules.Initialize(activeMatch); err != nil {
+		t.Fatalf("failed to initialize %s: %v", mode, err)
+	}
+	return rules, state
+}
+
+func TestTargetModesCheckWin(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		settings map[string]interface{}
+		scores   map[string]int
+		winner   string
+		finished bool
+	}{
+		{name: "quickfire below target", mode: models.GameModeQuickfire, scores: map[string]int{"a": 49, "b": 30}},
+		{name: "quickfire on target", mode: models.GameModeQuickfire, scores: map[string]int{"a": 50, "b": 30}, winner: "a", finished: true},
+		{name: "classic below target", mode: models.GameModeClassic, scores: map[string]int{"a": 99, "b": 99}},
+		{name: "classic on target", mode: models.GameModeClassic, scores: map[string]int{"a": 60, "b": 100}, winner: "b", finished: true},
+		{name: "classic highest over target wins", mode: models.GameModeClassic, scores: map[string]int{"a": 104, "b": 112}, winner: "b", finished: true},
+		{name: "blitz on target", mode: models.GameModeBlitz, scores: map[string]int{"a": 50, "b": 0}, winner: "a", finished: true},
+		{name: "blitz below target", mode: models.GameModeBlitz, scores: map[string]int{"a": 49, "b": 0}},
+		{name: "tournament below target", mode: models.GameModeTournament, scores: map[string]int{"a": 99, "b": 0}},
+		{name: "tournament on target", mode: models.GameModeTournament, scores: map[string]int{"a": 100, "b": 0}, winner: "a", finished: true},
+		{name: "custom on target", mode: models.GameModeCustom, scores: map[string]int{"a": 0, "b": 100}, winner: "b", finished: true},
+		{
+			name:     "target from JSON settings",
+			mode:     models.GameModeClassic,
+			settings: map[string]interface{}{"target_score": float64(30)},
+			scores:   map[string]int{"a": 30, "b": 0},
+			winner:   "a",
+			finished: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, state := newModeMatch(t, tt.mode, tt.settings, "a", "b")
+			state.Scores = tt.scores
+			winner, finished := rules.CheckWin(state)
+			if winner != tt.winner || finished != tt.finished {
+				t.Errorf("CheckWin() = %q, %v, want %q, %v", winner, finished, tt.winner, tt.finished)
+			}
+		})
+	}
+}
+
+func TestModeTargets(t *testing.T) {
+	tests := []struct {
+		mode   string
+		target int
+	}{
+		{mode: models.GameModeQuickfire, target: 50},
+		{mode: models.GameModeClassic, target: 100},
+		{mode: models.GameModeBlitz, target: 50},
+		{mode: models.GameModeTournament, target: 100},
+		{mode: models.GameModeCustom, target: 100},
+		{mode: models.GameModeZeroHour, target: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			rules, state := newModeMatch(t, tt.mode, nil, "a", "b")
+			if got := rules.Config().TargetScore; got != tt.target {
+				t.Errorf("TargetScore = %d, want %d", got, tt.target)
+			}
+			if got := state.GameModeData["target_score"]; got != tt.target {
+				t.Errorf("target_score = %v, want %d", got, tt.target)
+			}
+		})
+	}
+}
+
+func TestInvalidModeSettings(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		settings map[string]interface{}
+	}{
+		{name: "target not a number", mode: models.GameModeClassic, settings: map[string]interface{}{"target_score": "high"}},
+		{name: "time bank not a number", mode: models.GameModeBlitz, settings: map[string]interface{}{"time_bank": "long"}},
+		{name: "single one factor not a number", mode: models.GameModeTrueGrit, settings: map[string]interface{}{"single_one_factor": "x"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := defaultModeRegistry().Rules(tt.mode, tt.settings); err == nil {
+				t.Error("Rules() succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestRecordedRules(t *testing.T) {
+	registry := defaultModeRegistry()
+	rules, err := registry.Rules(models.GameModeTrueGrit, map[string]interface{}{"target_score": 30})
+	if err != nil {
+		t.Fatalf("failed to build rules: %v", err)
+	}
+	mode := rules.Config()
+
+	// The configuration travels in the create_match event
+	data, err := eventData(&matchCreatedEvent{GameMode: models.GameModeTrueGrit, Mode: &mode})
+	if err != nil {
+		t.Fatalf("failed to encode event: %v", err)
+	}
+	var created matchCreatedEvent
+	if err := decodeSettings(data, &created); err != nil {
+		t.Fatalf("failed to decode event: %v", err)
+	}
+
+	// Later changes to the mode must not reach the recorded match
+	changed, _ := registry.ModeConfig(models.GameModeTrueGrit)
+	changed.Enabled = false
+	changed.TargetScore = 500
+	changed.Settings = map[string]interface{}{"single_one_factor": 2.0}
+	if err := registry.Configure(models.GameModeTrueGrit, changed); err != nil {
+		t.Fatalf("failed to reconfigure: %v", err)
+	}
+
+	recorded, err := registry.RecordedRules(*created.Mode)
+	if err != nil {
+		t.Fatalf("RecordedRules() failed: %v", err)
+	}
+	got := recorded.Config()
+	if got.TargetScore != mode.TargetScore || got.TurnTime != mode.TurnTime || !got.Enabled {
+		t.Errorf("recorded config = %+v, want %+v", got, mode)
+	}
+
+	// The new single_one_factor reweights the dice of new matches only
+	current, err := newTrueGritRules(changed)
+	if err != nil {
+		t.Fatalf("failed to build reconfigured rules: %v", err)
+	}
+	want := newMatchDice(nil, rules).Weights()
+	if newMatchDice(nil, current).Weights() == want {
+		t.Fatalf("reconfigured weights = %v, want them changed", want)
+	}
+	if weights := newMatchDice(nil, recorded).Weights(); weights != want {
+		t.Errorf("recorded dice weights = %v, want %v", weights, want)
+	}
+}
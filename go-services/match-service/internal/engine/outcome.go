@@ -0,0 +1,120 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+// maxConsecutiveTimeouts is how many turns in a row a player may let time out before abandoning the match
+const maxConsecutiveTimeouts = 3
+
+// handleSurrender records a player conceding; the match loop then ends the match
+func (ge *GameEngine) handleSurrender(activeMatch *ActiveMatch, action *models.GameAction) error {
+	if _, ok := activeMatch.State.PlayerData[action.PlayerID]; !ok {
+		return fmt.Errorf("player not in match: %s", action.PlayerID)
+	}
+	if !matchInPlay(activeMatch) {
+		return fmt.Errorf("surrender is not allowed during the %s phase", activeMatch.GamePhase)
+	}
+
+	appendEvent(activeMatch.State, action, &models.GameActionResult{
+		Success:  true,
+		Message:  fmt.Sprintf("%s surrendered", action.PlayerID),
+		GameOver: true,
+	})
+	return nil
+}
+
+// noteTimeout counts a turn the player let time out
+func noteTimeout(state *models.MatchState, playerID string) {
+	if player, ok := state.PlayerData[playerID]; ok {
+		player.ConsecutiveTimeouts++
+		state.PlayerData[playerID] = player
+	}
+}
+
+// resetTimeouts clears a player's timeout run once they act again
+func resetTimeouts(state *models.MatchState, playerID string) {
+	if player, ok := state.PlayerData[playerID]; ok && player.ConsecutiveTimeouts > 0 {
+		player.ConsecutiveTimeouts = 0
+		state.PlayerData[playerID] = player
+	}
+}
+
+// checkMatchEnd returns the end_match data for a match that is over, or nil while play goes on
+func (ge *GameEngine) checkMatchEnd(activeMatch *ActiveMatch) map[string]interface{} {
+	state := activeMatch.State
+
+	if last := state.LastAction; last != nil && last.Type == "surrender" {
+		return concededMatch(models.WinReasonSurrender, last.PlayerID)
+	}
+
+	// A flag falling loses the match, even to a move made after it fell
+	if playerID := flaggedPlayer(state); playerID != "" {
+		return concededMatch(models.WinReasonFlagFall, playerID)
+	}
+
+	for _, playerID := range state.Players {
+		if state.PlayerData[playerID].ConsecutiveTimeouts >= maxConsecutiveTimeouts {
+			return concededMatch(models.WinReasonAbandoned, playerID)
+		}
+	}
+
+	// A match the mode decides without a winner is a tie
+	if winner, finished := activeMatch.Rules.CheckWin(state); finished || state.Winner != "" {
+		if state.Winner == "" && winner == "" {
+			return map[string]interface{}{"reason": models.WinReasonDraw}
+		}
+		return map[string]interface{}{"reason": models.WinReasonVictory}
+	}
+
+	if limit := state.Settings.MaxTurns; limit > 0 && state.TurnNumber > limit {
+		return map[string]interface{}{"reason": models.WinReasonDraw, "cause": "turn_limit"}
+	}
+
+	return nil
+}
+
+// concededMatch is the end_match data for a match a player gave up
+func concededMatch(reason, playerID string) map[string]interface{} {
+	return map[string]interface{}{
+		"reason":       reason,
+		"forfeited_by": playerID,
+	}
+}
+
+// matchStatus is the final status a match ends with: abandoned when it was
+// not played to a result, completed otherwise
+func matchStatus(reason string) string {
+	switch reason {
+	case models.WinReasonAbandoned, models.WinReasonVoid:
+		return "abandoned"
+	default:
+		return "completed"
+	}
+}
+
+// matchWinner settles the winner for an ended match. Draws and void matches
+// have none; a player who gave the match up leaves it to the leader among the rest.
+func matchWinner(state *models.MatchState, reason, forfeitedBy string) string {
+	switch reason {
+	case models.WinReasonDraw, models.WinReasonVoid:
+		return ""
+	case models.WinReasonVictory:
+		if state.Winner != "" {
+			return state.Winner
+		}
+	}
+
+	winner := ""
+	for _, playerID := range state.Players {
+		if playerID == forfeitedBy {
+			continue
+		}
+		if winner == "" || state.Scores[playerID] > state.Scores[winner] {
+			winner = playerID
+		}
+	}
+	return winner
+}
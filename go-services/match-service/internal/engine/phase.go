@@ -0,0 +1,160 @@
+package engine
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+// turnDeciderTimeout is how long the chooser has to call odd or even
+const turnDeciderTimeout = 10 * time.Second
+
+// turnDeciderTurn is the turn number the decider die is rolled under, ahead of turn 1
+const turnDeciderTurn = 0
+
+// Parity calls for the turn decider
+const (
+	parityOdd  = "odd"
+	parityEven = "even"
+)
+
+// actionPhases lists the phase each action is restricted to; other actions are accepted in any phase
+var actionPhases = map[string]string{
+	eventStartMatch: models.MatchPhaseSetup,
+	"choose_parity": models.MatchPhaseTurnDecider,
+	"roll_dice":     models.MatchPhaseActive,
+	"hold_dice":     models.MatchPhaseActive,
+	"bank":          models.MatchPhaseActive,
+	"end_turn":      models.MatchPhaseActive,
+	"use_ability":   models.MatchPhaseActive,
+}
+
+// setPhase moves the match to a new phase
+func setPhase(activeMatch *ActiveMatch, phase string) {
+	activeMatch.GamePhase = phase
+	activeMatch.State.Phase = phase
+}
+
+// requirePhase rejects actions that are not allowed in the current phase
+func requirePhase(activeMatch *ActiveMatch, action *models.GameAction) error {
+	if phase, restricted := actionPhases[action.Type]; restricted && phase != activeMatch.GamePhase {
+		return fmt.Errorf("%s is not allowed during the %s phase", action.Type, activeMatch.GamePhase)
+	}
+	return nil
+}
+
+// randomIndex returns a uniform index below n from crypto/rand
+func randomIndex(n int) (int, error) {
+	index, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to draw random index: %w", err)
+	}
+	return int(index.Int64()), nil
+}
+
+// startTurnDecider opens the odd/even call for the chooser drawn at match start
+func (ge *GameEngine) startTurnDecider(activeMatch *ActiveMatch, chooserID string, at time.Time) error {
+	state := activeMatch.State
+	if _, ok := state.PlayerData[chooserID]; !ok {
+		return fmt.Errorf("chooser not in match: %s", chooserID)
+	}
+
+	deadline := at.Add(turnDeciderTimeout)
+	state.TurnDecider = &models.TurnDecider{
+		ChooserID: chooserID,
+		Deadline:  deadline,
+	}
+	state.CurrentTurn = ""
+	state.TurnNumber = turnDeciderTurn
+	startDeciderClock(activeMatch, deadline)
+	setPhase(activeMatch, models.MatchPhaseTurnDecider)
+
+	return nil
+}
+
+// handleChooseParity rolls the decider die for the chooser's call and starts play.
+// A correct call lets the chooser start, otherwise the next seat starts.
+func (ge *GameEngine) handleChooseParity(activeMatch *ActiveMatch, action *models.GameAction) error {
+	state := activeMatch.State
+	decider := state.TurnDecider
+	if action.PlayerID != "" && action.PlayerID != decider.ChooserID {
+		return fmt.Errorf("only %s can choose parity", decider.ChooserID)
+	}
+
+	choice, _ := action.Data["parity"].(string)
+	if choice != parityOdd && choice != parityEven {
+		return fmt.Errorf("invalid parity: %q", choice)
+	}
+
+	// The decider die is always fair, whatever dice the mode plays with
+	roll := action.Roll
+	if !activeMatch.replaying {
+		rollIndex := activeMatch.Fairness.NextRoll(turnDeciderTurn)
+		die := NewWeightedDice(activeMatch.Fairness, fairDiceWeights).RollDie()
+		roll = &models.DiceRoll{
+			PlayerID:   decider.ChooserID,
+			Dice1:      die,
+			Total:      die,
+			Timestamp:  action.Timestamp,
+			TurnNumber: turnDeciderTurn,
+			RollIndex:  rollIndex,
+		}
+	}
+	if roll == nil {
+		return fmt.Errorf("turn decider event has no recorded die")
+	}
+	die := roll.Dice1
+
+	starter := decider.ChooserID
+	if (die%2 == 1) != (choice == parityOdd) {
+		state.CurrentTurn = decider.ChooserID
+		starter = nextPlayerID(state)
+	}
+
+	decider.Choice = choice
+	decider.AutoPicked = action.PlayerID == ""
+	decider.Roll = die
+	decider.StarterID = starter
+	action.Roll = roll
+
+	state.CurrentTurn = starter
+	state.TurnNumber = 1
+	setPhase(activeMatch, models.MatchPhaseActive)
+	runTimeBank(activeMatch, action.Timestamp)
+	startTurnClock(activeMatch, action.Timestamp)
+
+	result := &models.GameActionResult{
+		Success: true,
+		Message: fmt.Sprintf("Rolled %d, %s starts", die, starter),
+		Data: map[string]interface{}{
+			"choice":  choice,
+			"starter": starter,
+		},
+		Dice1:          die,
+		Total:          die,
+		NextPlayer:     starter,
+		NextTurnNumber: state.TurnNumber,
+	}
+	ge.recordActionResult(activeMatch, action, result)
+	return nil
+}
+
+// parityTimeoutAction calls odd or even for a chooser who ran out of time
+func parityTimeoutAction(activeMatch *ActiveMatch, now time.Time) *models.GameAction {
+	choice := parityOdd
+	if index, err := randomIndex(2); err == nil && index == 1 {
+		choice = parityEven
+	}
+
+	return &models.GameAction{
+		ID:        fmt.Sprintf("timeout_%d", now.UnixNano()),
+		MatchID:   activeMatch.Match.ID,
+		PlayerID:  "", // System action
+		Type:      "choose_parity",
+		Timestamp: now,
+		Data:      map[string]interface{}{"parity": choice, "reason": "timeout"},
+	}
+}
@@ -0,0 +1,141 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+// newDeciderMatch starts the turn decider of a classic match, with a to call
+func newDeciderMatch(t *testing.T, at time.Time) (*GameEngine, *ActiveMatch) {
+	t.Helper()
+	rules, state := newModeMatch(t, models.GameModeClassic, nil, "a", "b")
+	state.PlayerData = map[string]models.MatchPlayer{"a": {UserID: "a"}, "b": {UserID: "b"}}
+	activeMatch := &ActiveMatch{
+		Match:    &models.Match{ID: "match", Players: state.Players},
+		State:    state,
+		Rules:    rules,
+		Fairness: NewSeededRandom([]byte("server-seed"), combineClientSeeds(state.Players, map[string]string{})),
+	}
+
+	ge := &GameEngine{logger: zap.NewNop()}
+	if err := ge.startTurnDecider(activeMatch, "a", at); err != nil {
+		t.Fatalf("startTurnDecider() failed: %v", err)
+	}
+	return ge, activeMatch
+}
+
+func TestChooseParityStarter(t *testing.T) {
+	tests := []struct {
+		name    string
+		choice  string
+		die     int
+		starter string
+	}{
+		{name: "odd called on odd", choice: parityOdd, die: 3, starter: "a"},
+		{name: "odd called on even", choice: parityOdd, die: 4, starter: "b"},
+		{name: "even called on even", choice: parityEven, die: 6, starter: "a"},
+		{name: "even called on odd", choice: parityEven, die: 1, starter: "b"},
+	}
+
+	at := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ge, activeMatch := newDeciderMatch(t, at)
+			// Replays take the recorded die, which pins the roll
+			activeMatch.replaying = true
+			err := ge.handleChooseParity(activeMatch, &models.GameAction{
+				ID:        "call",
+				PlayerID:  "a",
+				Type:      "choose_parity",
+				Data:      map[string]interface{}{"parity": tt.choice},
+				Roll:      &models.DiceRoll{PlayerID: "a", Dice1: tt.die, Total: tt.die},
+				Timestamp: at.Add(time.Second),
+			})
+			if err != nil {
+				t.Fatalf("handleChooseParity() failed: %v", err)
+			}
+
+			state := activeMatch.State
+			if state.CurrentTurn != tt.starter || state.TurnDecider.StarterID != tt.starter {
+				t.Errorf("starter = %q, want %q", state.CurrentTurn, tt.starter)
+			}
+			if activeMatch.GamePhase != models.MatchPhaseActive || state.TurnNumber != 1 {
+				t.Errorf("phase %s on turn %d, want active on turn 1", activeMatch.GamePhase, state.TurnNumber)
+			}
+			if state.TurnDecider.AutoPicked {
+				t.Error("call made by the chooser was marked as auto-picked")
+			}
+		})
+	}
+}
+
+func TestChooseParityRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		player string
+		parity string
+	}{
+		{name: "call by the other player", player: "b", parity: parityOdd},
+		{name: "call that is neither odd nor even", player: "a", parity: "high"},
+	}
+
+	at := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ge, activeMatch := newDeciderMatch(t, at)
+			err := ge.handleChooseParity(activeMatch, &models.GameAction{
+				ID:        "call",
+				PlayerID:  tt.player,
+				Type:      "choose_parity",
+				Data:      map[string]interface{}{"parity": tt.parity},
+				Timestamp: at.Add(time.Second),
+			})
+			if err == nil {
+				t.Fatal("handleChooseParity() accepted the call")
+			}
+			if activeMatch.GamePhase != models.MatchPhaseTurnDecider || activeMatch.State.Sequence != 0 {
+				t.Errorf("rejected call moved the match to %s at sequence %d", activeMatch.GamePhase, activeMatch.State.Sequence)
+			}
+		})
+	}
+}
+
+func TestParityTimeoutAutoPick(t *testing.T) {
+	at := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	ge, activeMatch := newDeciderMatch(t, at)
+	if !activeMatch.TurnDeadline.Equal(at.Add(turnDeciderTimeout)) {
+		t.Fatalf("decider deadline = %v, want %v", activeMatch.TurnDeadline, at.Add(turnDeciderTimeout))
+	}
+
+	expired := at.Add(turnDeciderTimeout)
+	action := turnTimeoutAction(activeMatch, expired)
+	choice, _ := action.Data["parity"].(string)
+	if action.Type != "choose_parity" || action.PlayerID != "" || (choice != parityOdd && choice != parityEven) {
+		t.Fatalf("timeout action = %s by %q calling %q, want a system parity call", action.Type, action.PlayerID, choice)
+	}
+
+	if err := ge.handleChooseParity(activeMatch, action); err != nil {
+		t.Fatalf("handleChooseParity() failed: %v", err)
+	}
+	decider := activeMatch.State.TurnDecider
+	if !decider.AutoPicked || decider.Choice != choice {
+		t.Errorf("decider = %+v, want %s auto-picked", decider, choice)
+	}
+	if decider.Roll < 1 || decider.Roll > 6 || action.Roll == nil || action.Roll.Dice1 != decider.Roll {
+		t.Errorf("decider die = %d, logged as %+v", decider.Roll, action.Roll)
+	}
+	wantStarter := "a"
+	if (decider.Roll%2 == 1) != (choice == parityOdd) {
+		wantStarter = "b"
+	}
+	if decider.StarterID != wantStarter || activeMatch.State.CurrentTurn != wantStarter {
+		t.Errorf("starter = %q, want %q", decider.StarterID, wantStarter)
+	}
+	if timeouts := activeMatch.State.PlayerData["a"].ConsecutiveTimeouts; timeouts != 0 {
+		t.Errorf("chooser has %d timeouts, want the auto-pick not to count", timeouts)
+	}
+}
@@ -0,0 +1,327 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+// Replay playback speeds, as multiples of the speed the match was played at
+const (
+	minReplaySpeed = 0.25
+	maxReplaySpeed = 8
+)
+
+// invalidSpeedMessage explains the speeds a replay can be played at
+var invalidSpeedMessage = fmt.Sprintf("speed must be between %gx and %gx", float64(minReplaySpeed), float64(maxReplaySpeed))
+
+// validReplaySpeed reports whether a replay can be played at a speed
+func validReplaySpeed(speed float64) bool {
+	return speed >= minReplaySpeed && speed <= maxReplaySpeed
+}
+
+// replayPlayback plays a replay to one socket over the live match protocol:
+// a snapshot at the playback position, then a patch as each event comes due.
+// Viewers who did not play in the match see it as a spectator would have.
+type replayPlayback struct {
+	ge     *GameEngine
+	conn   *websocket.Conn
+	replay *matchReplay
+	redact bool
+
+	speed  float64
+	paused bool
+
+	// Match rebuilt up to the playback position, the next event to apply,
+	// and the wall clock time the position was last moved at
+	match    *ActiveMatch
+	next     int
+	position time.Duration
+	clock    time.Time
+
+	// What the client was last sent
+	version  int64
+	doc      syncDocument
+	history  []models.GameAction
+	redacted redactedLog
+}
+
+// playReplay plays a replay to a socket from the given position until the
+// socket closes. Clients may seek, change speed and pause while it plays.
+func (ge *GameEngine) playReplay(conn *websocket.Conn, replay *matchReplay, userID string, speed float64, position time.Duration) {
+	defer conn.Close()
+
+	p := &replayPlayback{
+		ge:     ge,
+		conn:   conn,
+		replay: replay,
+		redact: !containsString(replay.header.Players, userID),
+		speed:  speed,
+	}
+	done := make(chan struct{})
+	defer close(done)
+	controls := make(chan []byte)
+	go p.readControls(controls, done)
+
+	if err := p.seek(position); err != nil {
+		ge.logger.Error("Failed to start replay",
+			zap.String("match_id", replay.header.MatchID),
+			zap.Error(err))
+		return
+	}
+
+	ticker := time.NewTicker(socketPingPeriod)
+	defer ticker.Stop()
+
+	for {
+		var due <-chan time.Time
+		var timer *time.Timer
+		if !p.paused && p.next < len(p.replay.events) {
+			timer = time.NewTimer(p.wait())
+			due = timer.C
+		}
+
+		var err error
+		select {
+		case raw, ok := <-controls:
+			if !ok {
+				return
+			}
+			err = p.control(raw)
+		case <-due:
+			err = p.step()
+		case <-ticker.C:
+			p.conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+			err = p.conn.WriteMessage(websocket.PingMessage, nil)
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// readControls passes the client's messages to the playback loop until the
+// socket closes
+func (p *replayPlayback) readControls(controls chan<- []byte, done <-chan struct{}) {
+	defer close(controls)
+
+	p.conn.SetReadLimit(socketReadLimit)
+	p.conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	p.conn.SetPongHandler(func(string) error {
+		p.conn.SetReadDeadline(time.Now().Add(socketPongWait))
+		return nil
+	})
+
+	for {
+		_, raw, err := p.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		select {
+		case controls <- raw:
+		case <-done:
+			return
+		}
+	}
+}
+
+// control handles a client message
+func (p *replayPlayback) control(raw []byte) error {
+	var message clientMessage
+	if err := json.Unmarshal(raw, &message); err != nil {
+		return p.send(serverMessage{Type: "error", Error: "invalid message", Code: "INVALID_MESSAGE"})
+	}
+
+	p.advanceClock(time.Now())
+	switch message.Type {
+	case "ping":
+		return p.send(serverMessage{Type: "pong"})
+	case "resync":
+		return p.sendSnapshot()
+	case "seek":
+		return p.seek(time.Duration(message.Position) * time.Millisecond)
+	case "speed":
+		if !validReplaySpeed(message.Speed) {
+			return p.send(serverMessage{
+				Type:  "error",
+				Error: invalidSpeedMessage,
+				Code:  "INVALID_SPEED",
+			})
+		}
+		p.speed = message.Speed
+		return nil
+	case "pause":
+		p.paused = true
+		return nil
+	case "resume":
+		p.paused = false
+		return nil
+	case "game_action":
+		return p.send(serverMessage{
+			Type:     "error",
+			ActionID: message.ActionID,
+			Error:    "replays cannot take actions",
+			Code:     "REPLAY_ACTION",
+		})
+	default:
+		return p.send(serverMessage{
+			Type:  "error",
+			Error: fmt.Sprintf("unknown message type: %s", message.Type),
+			Code:  "UNKNOWN_MESSAGE",
+		})
+	}
+}
+
+// advanceClock moves the position on by the match time played since it was
+// last moved, so pausing or changing speed keeps the playback's place
+func (p *replayPlayback) advanceClock(now time.Time) {
+	if !p.paused && p.next < len(p.replay.events) {
+		p.position += time.Duration(float64(now.Sub(p.clock)) * p.speed)
+		if due := p.replay.offset(p.replay.events[p.next]); p.position > due {
+			p.position = due
+		}
+	}
+	p.clock = now
+}
+
+// wait is how long until the next event is due at the current speed
+func (p *replayPlayback) wait() time.Duration {
+	remaining := p.replay.offset(p.replay.events[p.next]) - p.position
+	if remaining <= 0 {
+		return 0
+	}
+	return time.Duration(float64(remaining) / p.speed)
+}
+
+// step applies the next event and sends the patch it makes, then tells the
+// client when the replay has reached its end
+func (p *replayPlayback) step() error {
+	event := p.replay.events[p.next]
+	if err := p.ge.applyAction(p.match, replayEvent(event)); err != nil {
+		return fmt.Errorf("failed to replay event %d (%s): %w", event.Sequence, event.Type, err)
+	}
+	p.next++
+	p.position = p.replay.offset(event)
+	p.clock = time.Now()
+
+	if err := p.sendPatch(); err != nil {
+		return err
+	}
+	if p.next == len(p.replay.events) {
+		return p.send(serverMessage{Type: "replay_end", Position: p.position.Milliseconds()})
+	}
+	return nil
+}
+
+// seek moves playback to a position in the match and sends the snapshot of
+// the state there. Seeking forward plays the events in between; seeking back
+// replays the match from the start.
+func (p *replayPlayback) seek(position time.Duration) error {
+	if position < 0 {
+		position = 0
+	}
+	if duration := p.replay.duration(); position > duration {
+		position = duration
+	}
+
+	// Every event up to the position has happened, the create_match event always
+	events := p.replay.events
+	target := 1
+	for target < len(events) && p.replay.offset(events[target]) <= position {
+		target++
+	}
+
+	if p.match == nil || target < p.next {
+		match, err := p.ge.replayEvents(events, events[target-1].Sequence)
+		if err != nil {
+			return err
+		}
+		p.match = match
+	} else {
+		for _, event := range events[p.next:target] {
+			if err := p.ge.applyAction(p.match, replayEvent(event)); err != nil {
+				return fmt.Errorf("failed to replay event %d (%s): %w", event.Sequence, event.Type, err)
+			}
+		}
+	}
+	p.next = target
+	p.position = position
+	p.clock = time.Now()
+
+	if err := p.sendSnapshot(); err != nil {
+		return err
+	}
+	if p.next == len(events) {
+		return p.send(serverMessage{Type: "replay_end", Position: p.position.Milliseconds()})
+	}
+	return nil
+}
+
+// view returns the rebuilt state as the viewer may see it
+func (p *replayPlayback) view() (syncDocument, []models.GameAction, error) {
+	state := p.match.State
+	if !p.redact {
+		return newSyncDocument(state)
+	}
+	doc, _, err := newSyncDocument(spectatorState(state))
+	return doc, p.redacted.sync(state.ActionHistory), err
+}
+
+// sendSnapshot sends the state at the playback position
+func (p *replayPlayback) sendSnapshot() error {
+	doc, history, err := p.view()
+	if err != nil {
+		return err
+	}
+	p.doc, p.history = doc, history
+	p.version++
+
+	return p.send(serverMessage{
+		Type:     "snapshot",
+		Version:  p.version,
+		Sequence: historySequence(history),
+		State:    syncSnapshot(doc, history),
+		Position: p.position.Milliseconds(),
+		Duration: p.replay.duration().Milliseconds(),
+	})
+}
+
+// sendPatch sends the patch from the state the client holds to the state at
+// the playback position
+func (p *replayPlayback) sendPatch() error {
+	doc, history, err := p.view()
+	if err != nil {
+		return err
+	}
+	ops := syncPatch(p.doc, doc, p.history, history)
+	if len(ops) == 0 {
+		return nil
+	}
+	base := p.version
+	p.doc, p.history = doc, history
+	p.version++
+
+	return p.send(serverMessage{
+		Type:        "patch",
+		Version:     p.version,
+		BaseVersion: base,
+		Sequence:    historySequence(history),
+		Ops:         ops,
+		Position:    p.position.Milliseconds(),
+	})
+}
+
+// send writes a message to the socket
+func (p *replayPlayback) send(message serverMessage) error {
+	message.Timestamp = time.Now().Unix()
+	p.conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+	return p.conn.WriteJSON(message)
+}
@@ -0,0 +1,133 @@
+package engine
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newSocketPair connects a client socket to a server socket over a test server
+func newSocketPair(t *testing.T) (server, client *websocket.Conn) {
+	t.Helper()
+	upgraded := make(chan *websocket.Conn, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("failed to upgrade socket: %v", err)
+			return
+		}
+		upgraded <- conn
+	}))
+	t.Cleanup(ts.Close)
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("failed to dial test server: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	server = <-upgraded
+	t.Cleanup(func() { server.Close() })
+	return server, client
+}
+
+// readMessage reads the next message the server sent to a client socket
+func readMessage(t *testing.T, client *websocket.Conn) serverMessage {
+	t.Helper()
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var message serverMessage
+	if err := client.ReadJSON(&message); err != nil {
+		t.Fatalf("failed to read message: %v", err)
+	}
+	return message
+}
+
+func TestReplayPlaybackSeek(t *testing.T) {
+	ge := newMemoryEngine(newMemoryDB(), "a")
+	replay, err := ge.replayFromEvents(newEndedMatch(t, ge))
+	if err != nil {
+		t.Fatalf("replayFromEvents() failed: %v", err)
+	}
+
+	// Events fall every 2s, so the one after 5s is due at 6s
+	tests := []struct {
+		speed       float64
+		wait        time.Duration
+		advanced    time.Duration
+		advanceWait time.Duration
+	}{
+		{speed: 1, wait: time.Second, advanced: 5400 * time.Millisecond, advanceWait: 600 * time.Millisecond},
+		{speed: 2, wait: 500 * time.Millisecond, advanced: 5800 * time.Millisecond, advanceWait: 100 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%gx", tt.speed), func(t *testing.T) {
+			server, client := newSocketPair(t)
+			p := &replayPlayback{ge: ge, conn: server, replay: replay, speed: tt.speed}
+
+			if err := p.seek(5 * time.Second); err != nil {
+				t.Fatalf("seek() failed: %v", err)
+			}
+			snapshot := readMessage(t, client)
+			if snapshot.Type != "snapshot" || snapshot.Sequence != 3 || snapshot.Position != 5000 || snapshot.Duration != 12000 {
+				t.Errorf("seek sent %s at event %d, %d of %d ms, want a snapshot at event 3, 5000 of 12000 ms",
+					snapshot.Type, snapshot.Sequence, snapshot.Position, snapshot.Duration)
+			}
+			if p.next != 3 {
+				t.Errorf("next event = %d, want 3", p.next)
+			}
+			if wait := p.wait(); wait != tt.wait {
+				t.Errorf("wait() = %v, want %v", wait, tt.wait)
+			}
+
+			// 400ms of wall clock plays 400ms of the match per unit of speed
+			p.advanceClock(p.clock.Add(400 * time.Millisecond))
+			if p.position != tt.advanced {
+				t.Errorf("position = %v after 400ms, want %v", p.position, tt.advanced)
+			}
+			if wait := p.wait(); wait != tt.advanceWait {
+				t.Errorf("wait() = %v after 400ms, want %v", wait, tt.advanceWait)
+			}
+
+			// Playback never runs past an event it has not applied
+			p.advanceClock(p.clock.Add(2 * time.Second))
+			if p.position != 6*time.Second || p.wait() != 0 {
+				t.Errorf("position = %v with %v to wait, want the event at 6s due", p.position, p.wait())
+			}
+			if err := p.step(); err != nil {
+				t.Fatalf("step() failed: %v", err)
+			}
+			if patch := readMessage(t, client); patch.Type != "patch" || patch.Sequence != 4 || patch.Position != 6000 || patch.BaseVersion != 1 {
+				t.Errorf("step sent %s of event %d at %d ms on version %d, want a patch of event 4 at 6000 ms on version 1",
+					patch.Type, patch.Sequence, patch.Position, patch.BaseVersion)
+			}
+
+			// Seeking back replays the match from the start
+			if err := p.seek(time.Second); err != nil {
+				t.Fatalf("seek() back failed: %v", err)
+			}
+			if snapshot := readMessage(t, client); snapshot.Sequence != 1 || snapshot.Position != 1000 {
+				t.Errorf("seek back sent event %d at %d ms, want event 1 at 1000 ms", snapshot.Sequence, snapshot.Position)
+			}
+			if p.next != 1 || p.match.State.Sequence != 1 {
+				t.Errorf("seek back left next event %d after sequence %d, want 1 after 1", p.next, p.match.State.Sequence)
+			}
+
+			// Seeking past the end stops at the end
+			if err := p.seek(20 * time.Second); err != nil {
+				t.Fatalf("seek() past the end failed: %v", err)
+			}
+			if snapshot := readMessage(t, client); snapshot.Type != "snapshot" || snapshot.Position != 12000 || snapshot.Sequence != 7 {
+				t.Errorf("seek past the end sent %s of event %d at %d ms, want a snapshot of event 7 at 12000 ms",
+					snapshot.Type, snapshot.Sequence, snapshot.Position)
+			}
+			if end := readMessage(t, client); end.Type != "replay_end" || end.Position != 12000 {
+				t.Errorf("seek past the end then sent %s at %d ms, want replay_end at 12000 ms", end.Type, end.Position)
+			}
+		})
+	}
+}
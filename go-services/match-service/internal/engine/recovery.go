@@ -0,0 +1,184 @@
+package engine
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+// activeMatchesKey is the Redis set of matches that have not ended yet
+const activeMatchesKey = "active_matches"
+
+// matchSeedTTL bounds how long an unfinished match's server seed is kept
+const matchSeedTTL = 24 * time.Hour
+
+// matchSeedKey is the Redis key holding a match's secret server seed. It is
+// kept apart from match_state, which is shared with clients.
+func matchSeedKey(matchID string) string {
+	return fmt.Sprintf("match_seed:%s", matchID)
+}
+
+// trackMatch records a new match and its server seed so it can be recovered after a restart
+func (ge *GameEngine) trackMatch(ctx context.Context, matchID string, serverSeed []byte) error {
+	redis := ge.dbManager.Redis()
+	if err := redis.Set(ctx, matchSeedKey(matchID), hex.EncodeToString(serverSeed), matchSeedTTL); err != nil {
+		return fmt.Errorf("failed to store server seed: %w", err)
+	}
+	if err := redis.SAdd(ctx, activeMatchesKey, matchID); err != nil {
+		return fmt.Errorf("failed to track active match: %w", err)
+	}
+	return nil
+}
+
+// untrackMatch forgets an ended match; its seed has been revealed in the final state
+func (ge *GameEngine) untrackMatch(ctx context.Context, matchID string) {
+	redis := ge.dbManager.Redis()
+	if err := redis.SRem(ctx, activeMatchesKey, matchID); err != nil {
+		ge.logger.Warn("Failed to untrack match",
+			zap.String("match_id", matchID),
+			zap.Error(err))
+	}
+	if err := redis.Delete(ctx, matchSeedKey(matchID)); err != nil {
+		ge.logger.Warn("Failed to delete server seed",
+			zap.String("match_id", matchID),
+			zap.Error(err))
+	}
+}
+
+// RecoverMatches rehydrates every unfinished match persisted in Redis that no
+// instance owns and restarts its processing, returning how many were recovered
+func (ge *GameEngine) RecoverMatches(ctx context.Context) (int, error) {
+	matchIDs, err := ge.dbManager.Redis().SMembers(ctx, activeMatchesKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list active matches: %w", err)
+	}
+
+	recovered := 0
+	for _, matchID := range matchIDs {
+		if _, exists := ge.GetMatch(matchID); exists {
+			continue
+		}
+
+		// Matches still leased by a live instance are left to their owner
+		claimed, err := ge.claimMatch(ctx, matchID)
+		if err != nil {
+			ge.logger.Error("Failed to recover match",
+				zap.String("match_id", matchID),
+				zap.Error(err))
+			continue
+		}
+		if claimed {
+			recovered++
+		}
+	}
+
+	return recovered, nil
+}
+
+// recoverMatch rebuilds an active match from its stored event log and server
+// seed. It returns nil when the match has nothing left to recover.
+func (ge *GameEngine) recoverMatch(ctx context.Context, matchID string) (*ActiveMatch, error) {
+	stored, err := ge.loadStoredState(ctx, matchID)
+	if errors.Is(err, errMatchNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if stored.CompletedAt != nil {
+		return nil, nil
+	}
+
+	activeMatch, err := ge.replayEvents(stored.ActionHistory, 0)
+	if err != nil {
+		return nil, err
+	}
+	activeMatch.replaying = false
+	state := activeMatch.State
+
+	serverSeed, err := ge.dbManager.Redis().Get(ctx, matchSeedKey(matchID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load server seed: %w", err)
+	}
+	seed, err := hex.DecodeString(serverSeed)
+	if err != nil || hashServerSeed(seed) != state.Fairness.ServerSeedHash {
+		return nil, fmt.Errorf("stored server seed does not match the commitment")
+	}
+
+	// Move the random stream past every roll already made
+	fairness := NewSeededRandom(seed, combineClientSeeds(state.Players, state.Fairness.ClientSeeds))
+	for _, event := range state.ActionHistory {
+		if event.Roll != nil {
+			fairness.NextRoll(event.Roll.TurnNumber)
+		}
+	}
+	activeMatch.Fairness = fairness
+	activeMatch.Dice = newMatchDice(fairness, activeMatch.Rules)
+
+	// The clocks stopped while the service was down
+	now := time.Now()
+	resumeClocks(activeMatch, now)
+
+	// Writes carry on from the events already stored, all of them for states
+	// stored before the event log was kept on its own
+	storedEvents, err := ge.dbManager.Redis().LLen(ctx, matchEventsKey(matchID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to count stored events: %w", err)
+	}
+
+	activeMatch.Match.Status = state.Status
+	activeMatch.Players = ge.loadPlayers(ctx, humanPlayers(state))
+	activeMatch.CurrentTurn = state.TurnNumber
+	activeMatch.UpdateChan = make(chan *models.GameAction, 100)
+	activeMatch.StateChan = make(chan *models.MatchState, 10)
+	activeMatch.hub = newMatchHub(matchID, ge.logger)
+	activeMatch.persistedSequence = storedEvents
+	activeMatch.outcomes = outcomesFromHistory(state.ActionHistory)
+	activeMatch.lastActivity = now
+	activeMatch.released = make(chan struct{})
+
+	return activeMatch, nil
+}
+
+// resumeClocks restarts a recovered match's clocks at now, so the player gets
+// back whatever time they had left at the last event
+func resumeClocks(activeMatch *ActiveMatch, now time.Time) {
+	state := activeMatch.State
+	activeMatch.TurnDeadline = now.Add(turnTimeRemaining(activeMatch))
+	if state.TurnClock != nil && state.Pause == nil {
+		state.TurnClock.Deadline = activeMatch.TurnDeadline
+	}
+	if state.TurnDecider != nil && activeMatch.GamePhase == models.MatchPhaseTurnDecider {
+		state.TurnDecider.Deadline = activeMatch.TurnDeadline
+	}
+
+	// The running time bank is charged up to the last event, not for the outage
+	if banks := state.TimeBanks; banks != nil && banks.Running != "" {
+		chargeTimeBank(state, state.UpdatedAt)
+		banks.RunningSince = now
+	}
+}
+
+// turnTimeRemaining returns how much of the current decision clock was left at the last event
+func turnTimeRemaining(activeMatch *ActiveMatch) time.Duration {
+	state := activeMatch.State
+
+	// A paused clock keeps what it had when play stopped
+	if state.Pause != nil {
+		return time.Duration(state.Pause.TurnTimeLeftMs) * time.Millisecond
+	}
+	if state.TurnClock == nil {
+		return activeMatch.Rules.Config().TurnTime
+	}
+
+	if remaining := state.TurnClock.Deadline.Sub(state.UpdatedAt); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
@@ -0,0 +1,50 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+func TestResumeClocks(t *testing.T) {
+	started := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	lastEvent := started.Add(10 * time.Second)
+	state := &models.MatchState{
+		ID:          "match",
+		Players:     []string{"a", "b"},
+		CurrentTurn: "a",
+		UpdatedAt:   lastEvent,
+		TurnClock:   &models.TurnClock{Decision: decisionRoll, Deadline: started.Add(40 * time.Second)},
+		TimeBanks:   newTimeBanks([]string{"a", "b"}, time.Minute, 0),
+	}
+	state.TimeBanks.Running, state.TimeBanks.RunningSince = "a", started
+	activeMatch := &ActiveMatch{
+		Match:     &models.Match{ID: state.ID, Players: state.Players},
+		State:     state,
+		GamePhase: models.MatchPhaseActive,
+	}
+
+	// The service comes back an hour later
+	now := started.Add(time.Hour)
+	resumeClocks(activeMatch, now)
+
+	banks := state.TimeBanks
+	if banks.RemainingMs["a"] != 50000 || !banks.RunningSince.Equal(now) {
+		t.Errorf("time bank = %d ms since %v, want 50000 ms since %v", banks.RemainingMs["a"], banks.RunningSince, now)
+	}
+	if want := now.Add(30 * time.Second); !activeMatch.TurnDeadline.Equal(want) || !state.TurnClock.Deadline.Equal(want) {
+		t.Errorf("turn deadline = %v, want %v", activeMatch.TurnDeadline, want)
+	}
+
+	// The first tick charges only the time since recovery
+	ge := &GameEngine{logger: zap.NewNop()}
+	if ge.tickTimeBanks(activeMatch, now.Add(5*time.Second)) {
+		t.Fatal("tickTimeBanks() ended the match on the outage")
+	}
+	if banks.RemainingMs["a"] != 45000 || banks.RemainingMs["b"] != 60000 {
+		t.Errorf("time banks = %v after the first tick, want a 45000 and b 60000", banks.RemainingMs)
+	}
+}
@@ -0,0 +1,407 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+// replayFormat names the replay file format in every file's header
+const replayFormat = "dashdice-replay"
+
+// replayFormatVersion is the version of the replay files written now. Files
+// written by earlier versions stay readable.
+const replayFormatVersion = 1
+
+// replaysCollection is the Firestore collection holding recorded replays
+const replaysCollection = "replays"
+
+// replayChunksCollection holds replay files in pieces, as a long match's
+// file outgrows the largest document Firestore stores (1 MiB)
+const replayChunksCollection = "replay_chunks"
+
+// replayChunkSize is how much of a replay file one chunk holds
+const replayChunkSize = 512 << 10
+
+// Errors returned when a replay cannot be played
+var (
+	errReplayNotFound = errors.New("replay not found")
+	errInvalidReplay  = errors.New("invalid replay")
+)
+
+// replayHeader is the first line of a replay file. It describes the match
+// and reveals its seeds, so the file can be verified and read on its own.
+type replayHeader struct {
+	Format         string            `json:"format"`
+	Version        int               `json:"version"`
+	MatchID        string            `json:"match_id"`
+	GameMode       string            `json:"game_mode"`
+	GameType       string            `json:"game_type,omitempty"`
+	Players        []string          `json:"players"`
+	CreatedAt      time.Time         `json:"created_at"`
+	CompletedAt    time.Time         `json:"completed_at"`
+	Winner         string            `json:"winner,omitempty"`
+	WinReason      string            `json:"win_reason,omitempty"`
+	ServerSeed     string            `json:"server_seed,omitempty"`
+	ServerSeedHash string            `json:"server_seed_hash,omitempty"`
+	ClientSeeds    map[string]string `json:"client_seeds,omitempty"`
+	Events         int               `json:"events"`
+
+	// The state the match started from, for readers that do not replay the
+	// events. Playback always rebuilds it from the events.
+	InitialState *models.MatchState `json:"initial_state,omitempty"`
+}
+
+// replayEntry is one event line of a replay file. Only what the event log
+// needs to be replayed is kept; everything the engine derives is dropped.
+type replayEntry struct {
+	Sequence int64                  `json:"seq"`
+	At       int64                  `json:"at"` // nanoseconds since the match was created
+	ID       string                 `json:"id"`
+	Type     string                 `json:"type"`
+	PlayerID string                 `json:"player,omitempty"`
+	Data     map[string]interface{} `json:"data,omitempty"`
+	Roll     *models.DiceRoll       `json:"roll,omitempty"`
+}
+
+// replayRecord is how a replay file is kept in Firestore. The file is kept
+// as written, so a record always holds a version some reader understands.
+// Records written before files were chunked hold the whole file in Data.
+type replayRecord struct {
+	MatchID   string    `json:"matchId" firestore:"matchId"`
+	Version   int       `json:"version" firestore:"version"`
+	CreatedAt time.Time `json:"createdAt" firestore:"createdAt"`
+	Data      string    `json:"data,omitempty" firestore:"data,omitempty"`
+	Chunks    int       `json:"chunks,omitempty" firestore:"chunks,omitempty"`
+}
+
+// replayChunk is one piece of a replay file, cut at any byte
+type replayChunk struct {
+	MatchID string `json:"matchId" firestore:"matchId"`
+	Index   int    `json:"index" firestore:"index"`
+	Data    []byte `json:"data" firestore:"data"`
+}
+
+// replayChunkID is the document ID of a piece of a match's replay file
+func replayChunkID(matchID string, index int) string {
+	return fmt.Sprintf("%s_%d", matchID, index)
+}
+
+// matchReplay is a replay ready to be played, whatever version its file was
+type matchReplay struct {
+	header replayHeader
+	events []models.GameAction
+}
+
+// recordsReplay reports whether a match keeps a replay. Matches are recorded
+// unless their host turned recording off.
+func recordsReplay(settings map[string]interface{}) bool {
+	var values replaySettings
+	if err := decodeSettings(settings, &values); err != nil || values.RecordReplay == nil {
+		return true
+	}
+	return *values.RecordReplay
+}
+
+// replayFromEvents builds the replay of an ended match from its event log,
+// replaying the log to check it
+func (ge *GameEngine) replayFromEvents(events []models.GameAction) (*matchReplay, error) {
+	final, err := ge.replayMatch(events, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidReplay, err)
+	}
+	if final.CompletedAt == nil {
+		return nil, fmt.Errorf("%w: match has not ended", errInvalidReplay)
+	}
+	initial, err := ge.replayMatch(events, events[0].Sequence)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidReplay, err)
+	}
+	initial.ActionHistory = nil
+
+	header := replayHeader{
+		Format:       replayFormat,
+		Version:      replayFormatVersion,
+		MatchID:      final.ID,
+		GameMode:     final.GameMode,
+		GameType:     final.GameType,
+		Players:      final.Players,
+		CreatedAt:    final.CreatedAt,
+		CompletedAt:  *final.CompletedAt,
+		Winner:       final.Winner,
+		WinReason:    final.WinReason,
+		Events:       len(events),
+		InitialState: initial,
+	}
+	if final.Fairness != nil {
+		header.ServerSeed = final.Fairness.ServerSeed
+		header.ServerSeedHash = final.Fairness.ServerSeedHash
+		header.ClientSeeds = final.Fairness.ClientSeeds
+	}
+	return &matchReplay{header: header, events: events}, nil
+}
+
+// duration is how long the recorded match ran
+func (r *matchReplay) duration() time.Duration {
+	return r.header.CompletedAt.Sub(r.header.CreatedAt)
+}
+
+// offset is how far into the match an event happened
+func (r *matchReplay) offset(event models.GameAction) time.Duration {
+	return event.Timestamp.Sub(r.header.CreatedAt)
+}
+
+// encode writes the replay file: the header line, then one line per event
+// in sequence order (NDJSON)
+func (r *matchReplay) encode() ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	if err := encoder.Encode(r.header); err != nil {
+		return nil, fmt.Errorf("failed to encode replay header: %w", err)
+	}
+	for _, event := range r.events {
+		entry := replayEntry{
+			Sequence: event.Sequence,
+			At:       r.offset(event).Nanoseconds(),
+			ID:       event.ID,
+			Type:     event.Type,
+			PlayerID: event.PlayerID,
+			Data:     event.Data,
+			Roll:     event.Roll,
+		}
+		if err := encoder.Encode(entry); err != nil {
+			return nil, fmt.Errorf("failed to encode replay event %d: %w", event.Sequence, err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// parseReplay reads a replay file of any version
+func (ge *GameEngine) parseReplay(raw []byte) (*matchReplay, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	var header replayHeader
+	if err := decoder.Decode(&header); err != nil {
+		return nil, fmt.Errorf("%w: unreadable header: %v", errInvalidReplay, err)
+	}
+	if header.Format != replayFormat {
+		return nil, fmt.Errorf("%w: not a %s file", errInvalidReplay, replayFormat)
+	}
+
+	switch header.Version {
+	case 1:
+		return ge.parseReplayV1(header, decoder)
+	default:
+		return nil, fmt.Errorf("%w: unsupported version %d", errInvalidReplay, header.Version)
+	}
+}
+
+// parseReplayV1 reads the events of a version 1 file. Events are rebuilt
+// from the log, so the header is worked out again rather than trusted.
+func (ge *GameEngine) parseReplayV1(header replayHeader, decoder *json.Decoder) (*matchReplay, error) {
+	events := make([]models.GameAction, 0, header.Events)
+	for {
+		var entry replayEntry
+		if err := decoder.Decode(&entry); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%w: unreadable event after %d: %v", errInvalidReplay, len(events), err)
+		}
+		events = append(events, models.GameAction{
+			ID:        entry.ID,
+			Sequence:  entry.Sequence,
+			MatchID:   header.MatchID,
+			PlayerID:  entry.PlayerID,
+			Type:      entry.Type,
+			Data:      entry.Data,
+			Timestamp: header.CreatedAt.Add(time.Duration(entry.At)),
+			Roll:      entry.Roll,
+		})
+	}
+	if len(events) != header.Events {
+		return nil, fmt.Errorf("%w: expected %d events, found %d", errInvalidReplay, header.Events, len(events))
+	}
+	return ge.replayFromEvents(events)
+}
+
+// storeReplay records an ended match's replay file, unless the match was
+// played with recording off
+func (ge *GameEngine) storeReplay(ctx context.Context, activeMatch *ActiveMatch) {
+	if !recordsReplay(activeMatch.Match.Settings) {
+		return
+	}
+
+	replay, err := ge.replayFromEvents(activeMatch.State.ActionHistory)
+	var data []byte
+	if err == nil {
+		data, err = replay.encode()
+	}
+	if err == nil {
+		err = ge.saveReplayFile(ctx, activeMatch.Match.ID, data)
+	}
+	if err != nil {
+		ge.logger.Error("Failed to store match replay",
+			zap.String("match_id", activeMatch.Match.ID),
+			zap.Error(err))
+	}
+}
+
+// saveReplayFile stores a replay file in chunks, then the record listing
+// them, so a record is never read before all of its chunks are stored
+func (ge *GameEngine) saveReplayFile(ctx context.Context, matchID string, data []byte) error {
+	firestore := ge.dbManager.Firestore()
+	chunks := 0
+	for start := 0; start < len(data); start += replayChunkSize {
+		end := start + replayChunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		chunk := replayChunk{MatchID: matchID, Index: chunks, Data: data[start:end]}
+		if err := firestore.Create(ctx, replayChunksCollection, replayChunkID(matchID, chunks), chunk); err != nil {
+			ge.deleteReplayChunks(ctx, matchID, chunks)
+			return fmt.Errorf("failed to store replay chunk %d: %w", chunks, err)
+		}
+		chunks++
+	}
+
+	err := firestore.Create(ctx, replaysCollection, matchID, replayRecord{
+		MatchID:   matchID,
+		Version:   replayFormatVersion,
+		CreatedAt: time.Now(),
+		Chunks:    chunks,
+	})
+	if err != nil {
+		ge.deleteReplayChunks(ctx, matchID, chunks)
+		return fmt.Errorf("failed to store replay: %w", err)
+	}
+	return nil
+}
+
+// loadReplayFile puts a recorded replay file back together
+func (ge *GameEngine) loadReplayFile(ctx context.Context, record replayRecord) ([]byte, error) {
+	if record.Chunks == 0 {
+		return []byte(record.Data), nil
+	}
+
+	var data []byte
+	for i := 0; i < record.Chunks; i++ {
+		var chunk replayChunk
+		if err := ge.dbManager.Firestore().Get(ctx, replayChunksCollection, replayChunkID(record.MatchID, i), &chunk); err != nil {
+			return nil, fmt.Errorf("failed to load replay chunk %d: %w", i, err)
+		}
+		data = append(data, chunk.Data...)
+	}
+	return data, nil
+}
+
+// deleteReplay removes a match's recorded replay, if it has one. The record
+// goes first, so a replay is never read with chunks missing.
+func (ge *GameEngine) deleteReplay(ctx context.Context, matchID string) error {
+	firestore := ge.dbManager.Firestore()
+	recorded, err := firestore.Exists(ctx, replaysCollection, matchID)
+	if err != nil {
+		return fmt.Errorf("failed to check replay: %w", err)
+	}
+	if !recorded {
+		return nil
+	}
+
+	var record replayRecord
+	if err := firestore.Get(ctx, replaysCollection, matchID, &record); err != nil {
+		return fmt.Errorf("failed to load replay: %w", err)
+	}
+	if err := firestore.Delete(ctx, replaysCollection, matchID); err != nil {
+		return fmt.Errorf("failed to delete replay: %w", err)
+	}
+	if !ge.deleteReplayChunks(ctx, matchID, record.Chunks) {
+		return fmt.Errorf("failed to delete replay chunks of %s", matchID)
+	}
+	return nil
+}
+
+// deleteReplayChunks removes the first chunks of a match's replay file,
+// reporting whether every one was removed
+func (ge *GameEngine) deleteReplayChunks(ctx context.Context, matchID string, chunks int) bool {
+	deleted := true
+	for i := 0; i < chunks; i++ {
+		if err := ge.dbManager.Firestore().Delete(ctx, replayChunksCollection, replayChunkID(matchID, i)); err != nil {
+			ge.logger.Warn("Failed to delete replay chunk",
+				zap.String("match_id", matchID),
+				zap.Int("chunk", i),
+				zap.Error(err))
+			deleted = false
+		}
+	}
+	return deleted
+}
+
+// LoadReplay returns an ended match's replay. Matches that ended before
+// replays were recorded are played from their stored event log.
+func (ge *GameEngine) LoadReplay(ctx context.Context, matchID string) (*matchReplay, error) {
+	replay, err := ge.recordedReplay(ctx, matchID)
+	if err != nil || replay != nil {
+		return replay, err
+	}
+
+	if _, running := ge.GetMatch(matchID); running {
+		return nil, fmt.Errorf("%w: %s", errMatchInProgress, matchID)
+	}
+	state, err := ge.loadStoredState(ctx, matchID)
+	if errors.Is(err, errMatchNotFound) {
+		return nil, fmt.Errorf("%w: %s", errReplayNotFound, matchID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if state.CompletedAt == nil {
+		return nil, fmt.Errorf("%w: %s", errMatchInProgress, matchID)
+	}
+
+	// Matches played with recording off have no replay
+	var created matchCreatedEvent
+	if len(state.ActionHistory) > 0 {
+		if err := decodeSettings(state.ActionHistory[0].Data, &created); err == nil && !recordsReplay(created.Settings) {
+			return nil, fmt.Errorf("%w: %s", errReplayNotFound, matchID)
+		}
+	}
+	return ge.replayFromEvents(state.ActionHistory)
+}
+
+// recordedReplay reads the replay stored when a match ended, or nil when
+// none was recorded
+func (ge *GameEngine) recordedReplay(ctx context.Context, matchID string) (*matchReplay, error) {
+	firestore := ge.dbManager.Firestore()
+	recorded, err := firestore.Exists(ctx, replaysCollection, matchID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check replay: %w", err)
+	}
+	if !recorded {
+		return nil, nil
+	}
+
+	var record replayRecord
+	if err := firestore.Get(ctx, replaysCollection, matchID, &record); err != nil {
+		return nil, fmt.Errorf("failed to load replay: %w", err)
+	}
+	data, err := ge.loadReplayFile(ctx, record)
+	if err != nil {
+		return nil, err
+	}
+	return ge.parseReplay(data)
+}
+
+// ReplayFile returns an ended match's replay file in the current format
+func (ge *GameEngine) ReplayFile(ctx context.Context, matchID string) ([]byte, error) {
+	replay, err := ge.LoadReplay(ctx, matchID)
+	if err != nil {
+		return nil, err
+	}
+	return replay.encode()
+}
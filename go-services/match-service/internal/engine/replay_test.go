@@ -0,0 +1,245 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+// replayStart is when the matches in the replay tests are created
+var replayStart = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// newEndedMatch plays a short classic match and returns its event log. Each
+// event comes two seconds after the last, and the match ends after 12s.
+func newEndedMatch(t *testing.T, ge *GameEngine) []models.GameAction {
+	t.Helper()
+	rules, err := ge.modes.Rules(models.GameModeClassic, nil)
+	if err != nil {
+		t.Fatalf("failed to build classic rules: %v", err)
+	}
+	players := []string{"a", "b"}
+	seed := []byte("server-seed")
+	fairness := NewSeededRandom(seed, combineClientSeeds(players, map[string]string{}))
+	dice := newMatchDice(fairness, rules)
+	config := rules.Config()
+
+	created := &matchCreatedEvent{
+		GameMode:       models.GameModeClassic,
+		Players:        players,
+		Mode:           &config,
+		Loadouts:       map[string]models.Loadout{"a": {Abilities: []string{}}, "b": {Abilities: []string{}}},
+		ClientSeeds:    map[string]string{"a": "", "b": ""},
+		ServerSeedHash: hashServerSeed(seed),
+		DiceWeights:    dice.Weights(),
+	}
+	data, err := eventData(created)
+	if err != nil {
+		t.Fatalf("eventData() failed: %v", err)
+	}
+	state := newMatchState("replayed", created, replayStart)
+	appendEvent(state, &models.GameAction{
+		ID:        "create",
+		MatchID:   state.ID,
+		Type:      eventCreateMatch,
+		Data:      data,
+		Timestamp: replayStart,
+	}, &models.GameActionResult{Success: true})
+	activeMatch := &ActiveMatch{
+		Match:     &models.Match{ID: state.ID, GameMode: models.GameModeClassic, Players: players},
+		State:     state,
+		Rules:     rules,
+		Dice:      dice,
+		Fairness:  fairness,
+		GamePhase: models.MatchPhaseSetup,
+	}
+
+	play := func(eventType, playerID string, data map[string]interface{}) {
+		t.Helper()
+		at := replayStart.Add(time.Duration(state.Sequence) * 2 * time.Second)
+		action := &models.GameAction{
+			ID:        fmt.Sprintf("event-%d", state.Sequence),
+			MatchID:   state.ID,
+			PlayerID:  playerID,
+			Type:      eventType,
+			Data:      data,
+			Timestamp: at,
+		}
+		if err := ge.applyAction(activeMatch, action); err != nil {
+			t.Fatalf("%s failed: %v", eventType, err)
+		}
+	}
+	play(eventStartMatch, "", map[string]interface{}{"chooser_id": "a"})
+	play("choose_parity", "a", map[string]interface{}{"parity": parityOdd})
+	for i := 0; i < 3; i++ {
+		play("roll_dice", state.CurrentTurn, map[string]interface{}{})
+	}
+	play(eventEndMatch, "", map[string]interface{}{"reason": models.WinReasonVoid, "cause": voidCauseEnded})
+	return state.ActionHistory
+}
+
+// newReplayFile encodes the replay of a short ended match
+func newReplayFile(t *testing.T, ge *GameEngine) []byte {
+	t.Helper()
+	replay, err := ge.replayFromEvents(newEndedMatch(t, ge))
+	if err != nil {
+		t.Fatalf("replayFromEvents() failed: %v", err)
+	}
+	raw, err := replay.encode()
+	if err != nil {
+		t.Fatalf("encode() failed: %v", err)
+	}
+	return raw
+}
+
+func TestReplayRoundTrip(t *testing.T) {
+	ge := newMemoryEngine(newMemoryDB(), "a")
+	events := newEndedMatch(t, ge)
+	replay, err := ge.replayFromEvents(events)
+	if err != nil {
+		t.Fatalf("replayFromEvents() failed: %v", err)
+	}
+	raw, err := replay.encode()
+	if err != nil {
+		t.Fatalf("encode() failed: %v", err)
+	}
+
+	parsed, err := ge.parseReplay(raw)
+	if err != nil {
+		t.Fatalf("parseReplay() failed: %v", err)
+	}
+	if parsed.header.Events != len(events) || parsed.duration() != 12*time.Second {
+		t.Errorf("parsed %d events over %v, want %d over 12s", parsed.header.Events, parsed.duration(), len(events))
+	}
+	for i, event := range parsed.events {
+		want := events[i]
+		if event.ID != want.ID || event.Sequence != want.Sequence || event.Type != want.Type || !event.Timestamp.Equal(want.Timestamp) {
+			t.Errorf("event %d = %s %s #%d at %v, want %s %s #%d at %v", i,
+				event.ID, event.Type, event.Sequence, event.Timestamp, want.ID, want.Type, want.Sequence, want.Timestamp)
+		}
+	}
+
+	// The file read back writes the same file
+	again, err := parsed.encode()
+	if err != nil {
+		t.Fatalf("encode() failed: %v", err)
+	}
+	if !bytes.Equal(again, raw) {
+		t.Errorf("re-encoded replay differs:\n%s\nwant:\n%s", again, raw)
+	}
+}
+
+func TestParseReplayRejected(t *testing.T) {
+	ge := newMemoryEngine(newMemoryDB(), "a")
+	raw := newReplayFile(t, ge)
+	lines := strings.SplitAfter(string(raw), "\n")
+	lines = lines[:len(lines)-1] // The file ends with a newline
+
+	// withHeader rewrites the header line of the file
+	withHeader := func(change func(header map[string]interface{})) []byte {
+		var header map[string]interface{}
+		if err := json.Unmarshal([]byte(lines[0]), &header); err != nil {
+			t.Fatalf("failed to decode header: %v", err)
+		}
+		change(header)
+		line, err := json.Marshal(header)
+		if err != nil {
+			t.Fatalf("failed to encode header: %v", err)
+		}
+		return []byte(string(line) + "\n" + strings.Join(lines[1:], ""))
+	}
+
+	tests := []struct {
+		name string
+		raw  []byte
+		want string
+	}{
+		{
+			name: "unsupported version",
+			raw:  withHeader(func(header map[string]interface{}) { header["version"] = 99 }),
+			want: "unsupported version 99",
+		},
+		{
+			name: "another format",
+			raw:  withHeader(func(header map[string]interface{}) { header["format"] = "chess-pgn" }),
+			want: "not a " + replayFormat + " file",
+		},
+		{
+			name: "event missing from the file",
+			raw:  []byte(strings.Join(lines[:len(lines)-1], "")),
+			want: fmt.Sprintf("expected %d events, found %d", len(lines)-1, len(lines)-2),
+		},
+		{
+			name: "more events than the header counts",
+			raw:  withHeader(func(header map[string]interface{}) { header["events"] = len(lines) - 2 }),
+			want: fmt.Sprintf("expected %d events, found %d", len(lines)-2, len(lines)-1),
+		},
+		{
+			name: "unreadable event",
+			raw:  []byte(strings.Join(lines[:2], "") + "{\n"),
+			want: "unreadable event after 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ge.parseReplay(tt.raw)
+			if !errors.Is(err, errInvalidReplay) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("parseReplay() = %v, want an invalid replay: %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplayFileChunks(t *testing.T) {
+	ctx := context.Background()
+	db := newMemoryDB()
+	ge := newMemoryEngine(db, "a")
+
+	// A file of two and a half chunks is kept as three
+	data := bytes.Repeat([]byte("0123456789"), replayChunkSize/4)
+	if err := ge.saveReplayFile(ctx, "long", data); err != nil {
+		t.Fatalf("saveReplayFile() failed: %v", err)
+	}
+	if chunks := len(db.firestore.docs[replayChunksCollection]); chunks != 3 {
+		t.Fatalf("stored %d chunks, want 3", chunks)
+	}
+	var record replayRecord
+	if err := db.firestore.Get(ctx, replaysCollection, "long", &record); err != nil {
+		t.Fatalf("failed to load replay record: %v", err)
+	}
+	loaded, err := ge.loadReplayFile(ctx, record)
+	if err != nil {
+		t.Fatalf("loadReplayFile() failed: %v", err)
+	}
+	if !bytes.Equal(loaded, data) {
+		t.Errorf("loaded %d bytes that differ from the %d stored", len(loaded), len(data))
+	}
+
+	if err := ge.deleteReplay(ctx, "long"); err != nil {
+		t.Fatalf("deleteReplay() failed: %v", err)
+	}
+	if records, chunks := len(db.firestore.docs[replaysCollection]), len(db.firestore.docs[replayChunksCollection]); records != 0 || chunks != 0 {
+		t.Errorf("deleteReplay() left %d records and %d chunks", records, chunks)
+	}
+
+	// Replays recorded before files were chunked still load
+	raw := newReplayFile(t, ge)
+	legacy := replayRecord{MatchID: "replayed", Version: 1, CreatedAt: replayStart, Data: string(raw)}
+	if err := db.firestore.Create(ctx, replaysCollection, "replayed", legacy); err != nil {
+		t.Fatalf("failed to store replay record: %v", err)
+	}
+	replay, err := ge.LoadReplay(ctx, "replayed")
+	if err != nil {
+		t.Fatalf("LoadReplay() failed: %v", err)
+	}
+	if replay.header.MatchID != "replayed" || replay.header.Events != len(replay.events) {
+		t.Errorf("loaded replay of %s with %d events, want replayed", replay.header.MatchID, len(replay.events))
+	}
+}
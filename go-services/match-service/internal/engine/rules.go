@@ -0,0 +1,163 @@
+package engine
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+// Scoring constants for the two-dice DashDice rules
+const (
+	snakeEyesBonus   = 20
+	doubleMultiplier = 2
+)
+
+// rollDice rolls two dice for a player and builds the DiceRoll record
+func rollDice(source DiceSource, playerID string) *models.DiceRoll {
+	dice1 := source.RollDie()
+	dice2 := source.RollDie()
+
+	return &models.DiceRoll{
+		PlayerID:  playerID,
+		Dice1:     dice1,
+		Dice2:     dice2,
+		Total:     dice1 + dice2,
+		IsDouble:  dice1 == dice2,
+		Timestamp: time.Now(),
+	}
+}
+
+// isSingleOne reports whether exactly one die shows a 1
+func isSingleOne(roll *models.DiceRoll) bool {
+	return (roll.Dice1 == 1) != (roll.Dice2 == 1)
+}
+
+// isSnakeEyes reports whether both dice show a 1
+func isSnakeEyes(roll *models.DiceRoll) bool {
+	return roll.Dice1 == 1 && roll.Dice2 == 1
+}
+
+// isDoubleSix reports whether both dice show a 6
+func isDoubleSix(roll *models.DiceRoll) bool {
+	return roll.Dice1 == 6 && roll.Dice2 == 6
+}
+
+// applyRoll applies a roll to the current player's turn using the classic rules:
+// a single 1 busts the turn, snake eyes adds a flat bonus, double six wipes the
+// banked total and any other double activates the turn multiplier
+func applyRoll(state *models.MatchState, roll *models.DiceRoll) *models.GameActionResult {
+	playerID := roll.PlayerID
+	if state.Multipliers == nil {
+		state.Multipliers = make(map[string]int)
+	}
+	multiplier := turnMultiplier(state, playerID)
+
+	result := &models.GameActionResult{
+		Success: true,
+		Data:    make(map[string]interface{}),
+		Dice1:   roll.Dice1,
+		Dice2:   roll.Dice2,
+		Total:   roll.Total,
+	}
+
+	switch {
+	case isSingleOne(roll):
+		result.Message = "Single 1 rolled, turn score lost"
+		result.SpecialEffect = "bust"
+		result.ScoreChange = -state.TurnScore
+		state.TurnScore = 0
+		result.TurnOver = true
+
+	case isDoubleSix(roll):
+		result.Message = "Double six rolled, total score reset"
+		result.SpecialEffect = "double_six_reset"
+		result.ScoreChange = -(state.Scores[playerID] + state.TurnScore)
+		state.Scores[playerID] = 0
+		state.TurnScore = 0
+		result.TurnOver = true
+
+	case isSnakeEyes(roll):
+		result.Message = "Snake eyes"
+		result.SpecialEffect = "snake_eyes"
+		result.BonusPoints = snakeEyesBonus
+		result.ScoreChange = snakeEyesBonus
+		state.TurnScore += snakeEyesBonus
+		state.Multipliers[playerID] = doubleMultiplier
+
+	case roll.IsDouble:
+		result.Message = "Double rolled, multiplier active"
+		result.SpecialEffect = "double_multiplier"
+		result.ScoreChange = roll.Total
+		state.TurnScore += roll.Total
+		state.Multipliers[playerID] = doubleMultiplier
+
+	default:
+		result.Message = "Roll added to turn score"
+		result.ScoreChange = roll.Total * multiplier
+		state.TurnScore += roll.Total * multiplier
+	}
+
+	roll.Multiplier = turnMultiplier(state, playerID)
+	roll.BonusPoints = result.BonusPoints
+	roll.SpecialEffect = result.SpecialEffect
+
+	result.Multiplier = roll.Multiplier
+	result.NewScore = state.Scores[playerID]
+	result.Data["turnScore"] = state.TurnScore
+
+	return result
+}
+
+// bankTurnScore moves the turn score into the player's total and ends the turn
+func bankTurnScore(state *models.MatchState, playerID string) *models.GameActionResult {
+	banked := state.TurnScore
+	state.Scores[playerID] += banked
+	state.TurnScore = 0
+
+	result := &models.GameActionResult{
+		Success:     true,
+		Message:     fmt.Sprintf("Banked %d points", banked),
+		Data:        map[string]interface{}{"banked": banked},
+		ScoreChange: banked,
+		NewScore:    state.Scores[playerID],
+		TurnOver:    true,
+	}
+
+	return result
+}
+
+// turnMultiplier returns the active multiplier for a player's turn
+func turnMultiplier(state *models.MatchState, playerID string) int {
+	if multiplier, ok := state.Multipliers[playerID]; ok && multiplier > 0 {
+		return multiplier
+	}
+	return 1
+}
+
+// advanceTurn clears per-turn state and hands the turn to the given player
+func advanceTurn(state *models.MatchState, nextPlayer string, result *models.GameActionResult) {
+	delete(state.Multipliers, state.CurrentTurn)
+	state.TurnScore = 0
+	state.CurrentTurn = nextPlayer
+	state.TurnNumber++
+
+	if result != nil {
+		result.TurnOver = true
+		result.NextPlayer = state.CurrentTurn
+		result.NextTurnNumber = state.TurnNumber
+	}
+}
+
+// nextPlayerID returns the player after the current one in seating order
+func nextPlayerID(state *models.MatchState) string {
+	if len(state.Players) == 0 {
+		return ""
+	}
+	for i, playerID := range state.Players {
+		if playerID == state.CurrentTurn {
+			return state.Players[(i+1)%len(state.Players)]
+		}
+	}
+	return state.Players[0]
+}
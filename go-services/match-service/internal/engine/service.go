@@ -0,0 +1,735 @@
+package engine
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"time"
+	
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+	
+	"github.com/LukeAtkinz/dashdice/go-services/shared/config"
+	"github.com/LukeAtkinz/dashdice/go-services/shared/database"
+	apperrors "github.com/LukeAtkinz/dashdice/go-services/shared/errors"
+	"github.com/LukeAtkinz/dashdice/go-services/shared/middleware"
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+// MatchService handles all match-related operations
+type MatchService struct {
+	config    *config.Config
+	logger    *zap.Logger
+	dbManager database.DatabaseManager
+	server    *http.Server
+	engine    *gin.Engine
+	upgrader  *websocket.Upgrader
+	
+	// Match management
+	gameEngine *GameEngine
+}
+
+// NewMatchService creates a new Match Service instance
+func NewMatchService(cfg *config.Config, logger *zap.Logger, dbManager database.DatabaseManager) *MatchService {
+	// Set Gin mode based on environment
+	if cfg.Environment == "production" {
+		gin.SetMode(gin.ReleaseMode)
+	}
+	
+	service := &MatchService{
+		config:     cfg,
+		logger:     logger,
+		dbManager:  dbManager,
+		engine:     gin.New(),
+		upgrader:   newSocketUpgrader(cfg.CORSAllowedOrigins),
+		gameEngine: NewGameEngine(logger, dbManager, cfg.InstanceID, cfg.InstanceAddr),
+	}
+	
+	service.setupMiddleware()
+	service.setupRoutes()
+	
+	return service
+}
+
+// GameEngine returns the engine running the service's matches
+func (ms *MatchService) GameEngine() *GameEngine {
+	return ms.gameEngine
+}
+
+// setupMiddleware configures middleware for the Match Service
+func (ms *MatchService) setupMiddleware() {
+	// Recovery middleware
+	ms.engine.Use(middleware.RecoveryMiddleware(ms.logger))
+	
+	// Request ID middleware
+	ms.engine.Use(middleware.RequestIDMiddleware(ms.logger))
+	
+	// Logging middleware
+	ms.engine.Use(middleware.LoggingMiddleware(ms.logger))
+	
+	// Rate limiting for match operations
+	ms.engine.Use(middleware.UserRateLimiter(30, 60, ms.logger))
+}
+
+// matchForwardedHeader marks a request already proxied to a match's owner
+const matchForwardedHeader = "X-Match-Forwarded"
+
+// forwardToMatchOwner proxies requests for a match to the instance holding its
+// lease, so every action is applied by the single instance running the match
+func (ms *MatchService) forwardToMatchOwner(param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		matchID := c.Param(param)
+		if matchID == "" {
+			c.Next()
+			return
+		}
+		
+		addr, local, err := ms.gameEngine.MatchOwner(c.Request.Context(), matchID)
+		if err != nil || local {
+			// Unknown matches are left to the handler to report
+			c.Next()
+			return
+		}
+		
+		// Never bounce a request between instances that disagree on the owner
+		if c.GetHeader(matchForwardedHeader) != "" {
+			ms.logger.Warn("Forwarded request reached an instance that does not own the match",
+				zap.String("match_id", matchID),
+				zap.String("owner", addr))
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"error": errMatchOwnerUnavailable.Error(),
+				"code":  "MATCH_OWNER_UNAVAILABLE",
+			})
+			return
+		}
+		
+		proxy := httputil.NewSingleHostReverseProxy(&url.URL{Scheme: "http", Host: addr})
+		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			ms.logger.Error("Failed to forward request to match owner",
+				zap.String("match_id", matchID),
+				zap.String("owner", addr),
+				zap.Error(err))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error":"` + errMatchOwnerUnavailable.Error() + `","code":"MATCH_OWNER_UNAVAILABLE"}`))
+		}
+		
+		c.Request.Header.Set(matchForwardedHeader, ms.config.InstanceID)
+		proxy.ServeHTTP(c.Writer, c.Request)
+		c.Abort()
+	}
+}
+
+// setupRoutes configures routes for the Match Service
+func (ms *MatchService) setupRoutes() {
+	// Health check
+	ms.engine.GET("/health", ms.handleHealthCheck)
+	
+	// Internal API for other services
+	internal := ms.engine.Group("/internal")
+	internal.Use(ms.forwardToMatchOwner("id"))
+	{
+		internal.POST("/matches", ms.handleCreateMatch)
+		internal.GET("/matches/:id", ms.handleGetMatch)
+		internal.PUT("/matches/:id", ms.handleUpdateMatch)
+		internal.DELETE("/matches/:id", ms.handleDeleteMatch)
+		internal.GET("/matches/:id/state", ms.handleGetMatchState)
+		internal.PUT("/matches/:id/state", ms.handleUpdateMatchState)
+		
+		// Game actions
+		internal.POST("/matches/:id/actions", ms.handleGameAction)
+		internal.POST("/matches/:id/turn", ms.handleProcessTurn)
+		internal.POST("/matches/:id/end", ms.handleEndMatch)
+		
+		// Player connection changes reported by the realtime layer
+		internal.POST("/matches/:id/players/:userId/disconnect", ms.handlePlayerDisconnect)
+		internal.POST("/matches/:id/players/:userId/reconnect", ms.handlePlayerReconnect)
+		
+		// Spectators
+		internal.POST("/matches/:id/spectators/:userId", ms.handleJoinSpectator)
+		internal.DELETE("/matches/:id/spectators/:userId", ms.handleLeaveSpectator)
+		
+		// Match history
+		internal.GET("/users/:userId/matches", ms.handleGetUserMatches)
+		internal.GET("/matches/:id/history", ms.handleGetMatchHistory)
+		
+		// Provably fair dice
+		internal.GET("/matches/:id/verify", ms.handleVerifyMatch)
+		
+		// Event sourced state
+		internal.GET("/matches/:id/reconstruct", ms.handleReconstructMatch)
+		
+		// Replays
+		internal.GET("/matches/:id/replay", ms.handleGetReplay)
+	}
+	
+	// WebSocket for real-time updates
+	ms.engine.GET("/ws/:matchId", ms.forwardToMatchOwner("matchId"), ms.handleMatchWebSocket)
+	ms.engine.GET("/ws/replays/:matchId", ms.handleReplayWebSocket)
+}
+
+// Start starts the Match Service
+func (ms *MatchService) Start() error {
+	ms.server = &http.Server{
+		Addr:           ms.config.MatchServiceAddr,
+		Handler:        ms.engine,
+		ReadTimeout:    30 * time.Second,
+		WriteTimeout:   30 * time.Second,
+		IdleTimeout:    120 * time.Second,
+		MaxHeaderBytes: 1 << 20, // 1MB
+	}
+	
+	return ms.server.ListenAndServe()
+}
+
+// Shutdown gracefully shuts down the Match Service
+func (ms *MatchService) Shutdown(ctx context.Context) error {
+	// Stop accepting new matches
+	ms.gameEngine.StopAcceptingMatches()
+	
+	// Wait for ongoing matches to finish or timeout
+	ms.gameEngine.WaitForMatches(ctx)
+	
+	return ms.server.Shutdown(ctx)
+}
+
+// Handler implementations
+func (ms *MatchService) handleHealthCheck(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status":    "healthy",
+		"service":   "match-service",
+		"timestamp": time.Now().Unix(),
+		"version":   "1.0.0",
+		"active_matches": ms.gameEngine.GetActiveMatchCount(),
+	})
+}
+
+func (ms *MatchService) handleCreateMatch(c *gin.Context) {
+	var request struct {
+		GameMode    string   `json:"game_mode" binding:"required"`
+		GameType    string   `json:"game_type,omitempty"` // "quick", "ranked", "tournament" or "lobby"
+		PlayerIDs   []string `json:"player_ids" binding:"required"`
+		Region      string   `json:"region" binding:"required"`
+		Settings    map[string]interface{} `json:"settings,omitempty"`
+		ClientSeeds map[string]string      `json:"client_seeds,omitempty"`
+		Loadouts    map[string][]string    `json:"loadouts,omitempty"`
+		Bots        map[string]string      `json:"bots,omitempty"` // bot difficulty by player: "easy", "medium", "hard", "expert" or "auto"
+	}
+	
+	if err := c.ShouldBindJSON(&request); err != nil {
+		ms.logger.Warn("Invalid create match request", zap.Error(err))
+		apperrors.AbortWithError(c, apperrors.BadRequest("Invalid request body"))
+		return
+	}
+	
+	if len(request.PlayerIDs) < 2 || len(request.PlayerIDs) > 8 {
+		apperrors.AbortWithError(c, apperrors.ValidationError("Match must have between 2-8 players"))
+		return
+	}
+	
+	// Create match configuration
+	matchConfig := &models.Match{
+		ID:        generateMatchID(),
+		GameMode:  request.GameMode,
+		GameType:  request.GameType,
+		Players:   request.PlayerIDs,
+		PlayerIDs: request.PlayerIDs,
+		Region:    request.Region,
+		Status:    "waiting",
+		CreatedAt: time.Now(),
+		Settings:  request.Settings,
+		ClientSeeds: request.ClientSeeds,
+		Loadouts:  request.Loadouts,
+		Bots:      request.Bots,
+	}
+	
+	// Create match using game engine
+	match, err := ms.gameEngine.CreateMatch(c.Request.Context(), matchConfig)
+	if err != nil {
+		ms.abortWithError(c, err, "create match")
+		return
+	}
+	
+	ms.logger.Info("Match created successfully",
+		zap.String("match_id", match.ID),
+		zap.String("game_mode", request.GameMode),
+		zap.Int("player_count", len(request.PlayerIDs)))
+	
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": "Match created successfully",
+		"match": gin.H{
+			"id":          match.ID,
+			"game_mode":   match.GameMode,
+			"status":      match.Status,
+			"player_ids":  match.PlayerIDs,
+			"region":      match.Region,
+			"created_at":  match.CreatedAt.Unix(),
+			"settings":    match.Settings,
+			"bots":        match.Bots,
+		},
+	})
+}
+
+// handleGetMatch returns a match's record
+func (ms *MatchService) handleGetMatch(c *gin.Context) {
+	match, err := ms.gameEngine.MatchRecord(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		ms.abortWithError(c, err, "get match")
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"match":   match,
+	})
+}
+
+// handleUpdateMatch changes the settings of a running match
+func (ms *MatchService) handleUpdateMatch(c *gin.Context) {
+	var update matchUpdate
+	if err := c.ShouldBindJSON(&update); err != nil || update.empty() {
+		apperrors.AbortWithError(c, apperrors.BadRequest("Request must set spectator_mode or pause_on_disconnect"))
+		return
+	}
+	
+	event, err := ms.gameEngine.UpdateMatch(c.Param("id"), update)
+	if err != nil {
+		ms.abortWithError(c, err, "update match")
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"event":   event,
+	})
+}
+
+// handleDeleteMatch removes an ended match's record and stored state
+func (ms *MatchService) handleDeleteMatch(c *gin.Context) {
+	if err := ms.gameEngine.DeleteMatch(c.Request.Context(), c.Param("id")); err != nil {
+		ms.abortWithError(c, err, "delete match")
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+	})
+}
+
+// handleGetMatchState returns a match's live or last stored state
+func (ms *MatchService) handleGetMatchState(c *gin.Context) {
+	state, err := ms.gameEngine.MatchState(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		ms.abortWithError(c, err, "get match state")
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"state":   state,
+	})
+}
+
+// handleUpdateMatchState restores an ended match's stored state from the
+// events the service recorded for it
+func (ms *MatchService) handleUpdateMatchState(c *gin.Context) {
+	state, err := ms.gameEngine.RestoreMatchState(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		ms.abortWithError(c, err, "restore match state")
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"state":   state,
+	})
+}
+
+// handleGameAction applies a player's game action and returns the event it was logged as
+func (ms *MatchService) handleGameAction(c *gin.Context) {
+	var request struct {
+		ActionID        string                 `json:"action_id" binding:"required"`
+		PlayerID        string                 `json:"player_id" binding:"required"`
+		Type            string                 `json:"type" binding:"required"`
+		Data            map[string]interface{} `json:"data,omitempty"`
+		ExpectedVersion int64                  `json:"expected_version,omitempty"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		apperrors.AbortWithError(c, apperrors.BadRequest("Request must set action_id, player_id and type"))
+		return
+	}
+	if request.Data == nil {
+		request.Data = make(map[string]interface{})
+	}
+	
+	matchID := c.Param("id")
+	event, err := ms.gameEngine.ProcessGameAction(matchID, &models.GameAction{
+		ID:              request.ActionID,
+		MatchID:         matchID,
+		PlayerID:        request.PlayerID,
+		Type:            request.Type,
+		Data:            request.Data,
+		Timestamp:       time.Now(),
+		ExpectedVersion: request.ExpectedVersion,
+	})
+	if err != nil {
+		ms.abortWithError(c, err, "apply game action")
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"event":   event,
+	})
+}
+
+// handleProcessTurn makes the current player's pending decision for them
+func (ms *MatchService) handleProcessTurn(c *gin.Context) {
+	var request struct {
+		ExpectedVersion int64 `json:"expected_version,omitempty"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			apperrors.AbortWithError(c, apperrors.BadRequest("Invalid request body"))
+			return
+		}
+	}
+	
+	event, err := ms.gameEngine.ProcessTurn(c.Param("id"), request.ExpectedVersion)
+	if err != nil {
+		ms.abortWithError(c, err, "process turn")
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"event":   event,
+	})
+}
+
+// handleEndMatch ends a running match as a forfeit or a no contest
+func (ms *MatchService) handleEndMatch(c *gin.Context) {
+	var request struct {
+		ForfeitedBy string `json:"forfeited_by,omitempty"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			apperrors.AbortWithError(c, apperrors.BadRequest("Invalid request body"))
+			return
+		}
+	}
+	
+	event, err := ms.gameEngine.EndMatch(c.Param("id"), request.ForfeitedBy)
+	if err != nil {
+		ms.abortWithError(c, err, "end match")
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"event":   event,
+	})
+}
+
+func (ms *MatchService) handlePlayerDisconnect(c *gin.Context) {
+	ms.handleConnectionChange(c, ms.gameEngine.PlayerDisconnected)
+}
+
+func (ms *MatchService) handlePlayerReconnect(c *gin.Context) {
+	ms.handleConnectionChange(c, ms.gameEngine.PlayerReconnected)
+}
+
+// handleConnectionChange queues a player's disconnect or reconnect for the match
+func (ms *MatchService) handleConnectionChange(c *gin.Context, record func(matchID, playerID string) error) {
+	matchID := c.Param("id")
+	playerID := c.Param("userId")
+	
+	if err := record(matchID, playerID); err != nil {
+		ms.abortWithError(c, err, "record connection change")
+		return
+	}
+	
+	c.JSON(http.StatusAccepted, gin.H{
+		"success": true,
+	})
+}
+
+// handleJoinSpectator adds a user to a match's spectators
+func (ms *MatchService) handleJoinSpectator(c *gin.Context) {
+	event, err := ms.gameEngine.JoinSpectator(c.Param("id"), c.Param("userId"))
+	if err != nil {
+		ms.abortWithError(c, err, "add spectator")
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"event":   event,
+	})
+}
+
+// handleLeaveSpectator removes a user from a match's spectators
+func (ms *MatchService) handleLeaveSpectator(c *gin.Context) {
+	event, err := ms.gameEngine.LeaveSpectator(c.Param("id"), c.Param("userId"))
+	if err != nil {
+		ms.abortWithError(c, err, "remove spectator")
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"event":   event,
+	})
+}
+
+// handleGetUserMatches lists a user's matches newest first, a page at a time
+func (ms *MatchService) handleGetUserMatches(c *gin.Context) {
+	limit, appErr := pageSize(c)
+	if appErr != nil {
+		apperrors.AbortWithError(c, appErr)
+		return
+	}
+	position, appErr := decodeCursor(c)
+	if appErr != nil {
+		apperrors.AbortWithError(c, appErr)
+		return
+	}
+	before, appErr := parseMatchCursor(position)
+	if appErr != nil {
+		apperrors.AbortWithError(c, appErr)
+		return
+	}
+	
+	// One extra match tells whether another page follows
+	matches, err := ms.gameEngine.UserMatches(c.Request.Context(), c.Param("userId"), limit+1, before)
+	if err != nil {
+		ms.abortWithError(c, err, "list user matches")
+		return
+	}
+	
+	nextCursor := ""
+	if len(matches) > limit {
+		matches = matches[:limit]
+		nextCursor = matchCursor(matches[limit-1].CreatedAt)
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"matches":     matches,
+		"next_cursor": nextCursor,
+	})
+}
+
+// handleGetMatchHistory returns a match's event log in order, a page at a time
+func (ms *MatchService) handleGetMatchHistory(c *gin.Context) {
+	limit, appErr := pageSize(c)
+	if appErr != nil {
+		apperrors.AbortWithError(c, appErr)
+		return
+	}
+	position, appErr := decodeCursor(c)
+	if appErr != nil {
+		apperrors.AbortWithError(c, appErr)
+		return
+	}
+	after, appErr := parseHistoryCursor(position)
+	if appErr != nil {
+		apperrors.AbortWithError(c, appErr)
+		return
+	}
+	
+	events, err := ms.gameEngine.MatchEvents(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		ms.abortWithError(c, err, "get match history")
+		return
+	}
+	
+	// Events are numbered from 1 in log order
+	if after > int64(len(events)) {
+		after = int64(len(events))
+	}
+	page := events[after:]
+	nextCursor := ""
+	if len(page) > limit {
+		page = page[:limit]
+		nextCursor = historyCursor(page[limit-1].Sequence)
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"events":      page,
+		"next_cursor": nextCursor,
+	})
+}
+
+func (ms *MatchService) handleVerifyMatch(c *gin.Context) {
+	matchID := c.Param("id")
+	
+	report, err := ms.gameEngine.VerifyMatch(c.Request.Context(), matchID)
+	if err != nil {
+		ms.abortWithError(c, err, "verify match")
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"success":      true,
+		"verification": report,
+	})
+}
+
+// handleReconstructMatch rebuilds a match state from its event log, optionally as of an earlier event
+func (ms *MatchService) handleReconstructMatch(c *gin.Context) {
+	matchID := c.Param("id")
+	
+	var sequence int64
+	if raw := c.Query("sequence"); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || parsed < 1 {
+			apperrors.AbortWithError(c, apperrors.BadRequest("sequence must be a positive event number"))
+			return
+		}
+		sequence = parsed
+	}
+	
+	state, err := ms.gameEngine.ReconstructMatch(c.Request.Context(), matchID, sequence)
+	if err != nil {
+		ms.abortWithError(c, err, "reconstruct match")
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"state":   state,
+	})
+}
+
+// handleMatchWebSocket streams a match's live state to a player or spectator
+// and takes the player's game actions over the same socket
+func (ms *MatchService) handleMatchWebSocket(c *gin.Context) {
+	matchID := c.Param("matchId")
+	
+	userID, err := ms.authenticateSocket(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Authentication required",
+			"code":  "UNAUTHORIZED",
+		})
+		return
+	}
+	
+	activeMatch, exists := ms.gameEngine.GetMatch(matchID)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Match not found",
+			"code":  "MATCH_NOT_FOUND",
+		})
+		return
+	}
+	
+	activeMatch.mutex.RLock()
+	_, isPlayer := activeMatch.State.PlayerData[userID]
+	spectatable := canSpectate(activeMatch.State, userID) == nil
+	activeMatch.mutex.RUnlock()
+	if !isPlayer && !spectatable {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Match does not allow spectators",
+			"code":  "SPECTATING_DISABLED",
+		})
+		return
+	}
+	
+	conn, err := ms.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader has already replied
+		ms.logger.Warn("Failed to upgrade match socket",
+			zap.String("match_id", matchID),
+			zap.String("user_id", userID),
+			zap.Error(err))
+		return
+	}
+	
+	ms.gameEngine.serveMatchSocket(activeMatch, conn, userID, !isPlayer)
+}
+
+// handleGetReplay returns an ended match's replay file
+func (ms *MatchService) handleGetReplay(c *gin.Context) {
+	data, err := ms.gameEngine.ReplayFile(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		ms.abortWithError(c, err, "get replay")
+		return
+	}
+	
+	c.Data(http.StatusOK, "application/x-ndjson", data)
+}
+
+// handleReplayWebSocket plays an ended match's replay over a WebSocket, using
+// the same messages as the live match socket
+func (ms *MatchService) handleReplayWebSocket(c *gin.Context) {
+	matchID := c.Param("matchId")
+	
+	userID, err := ms.authenticateSocket(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Authentication required",
+			"code":  "UNAUTHORIZED",
+		})
+		return
+	}
+	
+	speed := 1.0
+	if raw := c.Query("speed"); raw != "" {
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil || !validReplaySpeed(parsed) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": invalidSpeedMessage,
+				"code":  "INVALID_SPEED",
+			})
+			return
+		}
+		speed = parsed
+	}
+	
+	var position time.Duration
+	if raw := c.Query("position"); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || parsed < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "position must be a number of milliseconds into the match",
+				"code":  "INVALID_POSITION",
+			})
+			return
+		}
+		position = time.Duration(parsed) * time.Millisecond
+	}
+	
+	replay, err := ms.gameEngine.LoadReplay(c.Request.Context(), matchID)
+	if err != nil {
+		ms.abortWithError(c, err, "load replay")
+		return
+	}
+	
+	conn, err := ms.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader has already replied
+		ms.logger.Warn("Failed to upgrade replay socket",
+			zap.String("match_id", matchID),
+			zap.String("user_id", userID),
+			zap.Error(err))
+		return
+	}
+	
+	ms.gameEngine.playReplay(conn, replay, userID, speed, position)
+}
+
+// generateMatchID creates a unique match ID
+func generateMatchID() string {
+	bytes := make([]byte, 16)
+	rand.Read(bytes)
+	return "match_" + hex.EncodeToString(bytes)
+}
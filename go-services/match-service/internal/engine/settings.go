@@ -0,0 +1,77 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// matchOverrides are the per-match settings that replace mode configuration values
+type matchOverrides struct {
+	TargetScore *int `json:"target_score"`
+	MaxTurns    *int `json:"max_turns"`
+	TurnTime    int  `json:"turn_time"` // seconds
+	RollTime    int  `json:"roll_time"` // seconds
+	BankTime    int  `json:"bank_time"` // seconds
+}
+
+// spectatorSettings are the per-match spectating settings, chosen by the
+// lobby host or the service creating the match
+type spectatorSettings struct {
+	AllowSpectators *bool `json:"allow_spectators"` // nil uses the default for the match type
+	SpectatorDelay  int   `json:"spectator_delay"`  // seconds
+}
+
+// replaySettings are the per-match recording settings, chosen by the lobby host
+type replaySettings struct {
+	RecordReplay *bool `json:"record_replay"` // nil records the match
+}
+
+// blitzSettings are the Blitz specific settings
+type blitzSettings struct {
+	TimeBank  int `json:"time_bank"` // seconds on each player's clock
+	Increment int `json:"increment"` // seconds added back for each roll
+}
+
+// tournamentSettings are the Tournament specific settings
+type tournamentSettings struct {
+	Elimination bool `json:"elimination"`
+}
+
+// customSettings are the host supplied settings of a custom match
+type customSettings struct {
+	CustomRules map[string]interface{} `json:"custom_rules"`
+}
+
+// zeroHourSettings are the Zero Hour specific settings
+type zeroHourSettings struct {
+	DoublesEffects map[string]DoubleEffect `json:"doublesEffects"`
+}
+
+// lastLineSettings are the Last Line specific settings
+type lastLineSettings struct {
+	RollLimit int `json:"roll_limit"`
+}
+
+// trueGritSettings are the True Grit specific settings
+type trueGritSettings struct {
+	SingleOneFactor float64                 `json:"single_one_factor"`
+	DoublesEffects  map[string]DoubleEffect `json:"doublesEffects"`
+}
+
+// decodeSettings decodes a settings map into a typed settings struct. Fields
+// missing from the map keep the value already in target, and numbers decoded
+// from JSON or Firestore as float64 convert to their declared type.
+func decodeSettings(settings map[string]interface{}, target interface{}) error {
+	if len(settings) == 0 {
+		return nil
+	}
+
+	raw, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("failed to encode settings: %w", err)
+	}
+	if err := json.Unmarshal(raw, target); err != nil {
+		return fmt.Errorf("invalid settings: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,346 @@
+package engine
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+// Simulation limits
+const (
+	// maxSimulatedActions gives up on a simulated match that never ends
+	maxSimulatedActions = 10000
+	// simulatedActionGap is the match time each simulated action takes
+	simulatedActionGap = time.Second
+)
+
+// errStalledMatch is returned when no bot has a move in a simulated match
+var errStalledMatch = errors.New("no player can move")
+
+// SimulationConfig is the setup a balance simulation plays
+type SimulationConfig struct {
+	Mode     string
+	Settings map[string]interface{}
+	// Bots holds the difficulty of each seat, in seating order
+	Bots []string
+	// Loadouts holds the abilities of each seat; a nil entry plays the difficulty's
+	Loadouts       [][]string
+	RandomLoadouts bool
+	// Seed makes runs repeatable; 0 draws fresh seeds
+	Seed int64
+}
+
+// newSimulationEngine builds an engine that only applies actions; it has no
+// database and runs no background work
+func newSimulationEngine() *GameEngine {
+	return &GameEngine{
+		logger:    zap.NewNop(),
+		modes:     defaultModeRegistry(),
+		abilities: defaultAbilityRegistry(),
+	}
+}
+
+// SimulatedMatch is the result of one simulated match
+type SimulatedMatch struct {
+	State *models.MatchState
+	// Deficits holds the furthest each player fell behind the leader
+	Deficits map[string]int
+}
+
+// Simulation plays matches of one setup; workers playing in parallel each
+// prepare their own
+type Simulation struct {
+	ge       *GameEngine
+	config   *SimulationConfig
+	rules    GameModeRules
+	players  []string
+	bots     map[string]string
+	loadouts map[string][]string
+}
+
+// NewSimulation checks the setup and prepares to play it
+func NewSimulation(config *SimulationConfig) (*Simulation, error) {
+	ge := newSimulationEngine()
+	rules, err := ge.modes.Rules(config.Mode, config.Settings)
+	if err != nil {
+		return nil, err
+	}
+	modeConfig := rules.Config()
+	if len(config.Bots) < modeConfig.MinPlayers || len(config.Bots) > modeConfig.MaxPlayers {
+		return nil, fmt.Errorf("%s requires %d-%d players, %d given",
+			modeConfig.ID, modeConfig.MinPlayers, modeConfig.MaxPlayers, len(config.Bots))
+	}
+
+	s := &Simulation{
+		ge:       ge,
+		config:   config,
+		rules:    rules,
+		bots:     make(map[string]string, len(config.Bots)),
+		loadouts: make(map[string][]string, len(config.Bots)),
+	}
+	for i, difficulty := range config.Bots {
+		if _, ok := botLevelFor(difficulty); !ok {
+			return nil, fmt.Errorf("%w: unknown difficulty %q for seat %d", errInvalidBots, difficulty, i+1)
+		}
+		playerID := fmt.Sprintf("seat%d", i+1)
+		s.players = append(s.players, playerID)
+		s.bots[playerID] = difficulty
+		if i < len(config.Loadouts) && config.Loadouts[i] != nil {
+			s.loadouts[playerID] = config.Loadouts[i]
+		}
+	}
+
+	// Fixed loadouts are checked once, as match creation would check them
+	if _, err := ge.validateLoadouts(context.Background(), s.match("", nil)); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// match is the match record a simulated match is created from
+func (s *Simulation) match(matchID string, loadouts map[string][]string) *models.Match {
+	if loadouts == nil {
+		loadouts = s.loadouts
+	}
+	return &models.Match{
+		ID:       matchID,
+		GameMode: s.rules.Config().ID,
+		GameType: "simulation",
+		Players:  s.players,
+		Settings: s.config.Settings,
+		Loadouts: loadouts,
+		Bots:     s.bots,
+	}
+}
+
+// Play plays one match to its end, with a bot in every seat. Actions go
+// straight to the engine's reducer, with no persistence, sockets or clocks.
+// The index tells matches of a seeded run apart.
+func (s *Simulation) Play(index int) (*SimulatedMatch, error) {
+	ge := s.ge
+	random, serverSeed, err := s.seeds(index)
+	if err != nil {
+		return nil, err
+	}
+
+	loadouts := s.loadouts
+	if s.config.RandomLoadouts {
+		loadouts = make(map[string][]string, len(s.players))
+		for _, playerID := range s.players {
+			level, _ := botLevelFor(s.bots[playerID])
+			loadouts[playerID] = randomLoadout(ge.abilities, level, random)
+		}
+	}
+	match := s.match(fmt.Sprintf("sim_%d", index), loadouts)
+	validated, err := ge.validateLoadouts(context.Background(), match)
+	if err != nil {
+		return nil, err
+	}
+	// Bots given no abilities would otherwise play their difficulty's
+	for playerID, abilityIDs := range loadouts {
+		if abilityIDs != nil && len(abilityIDs) == 0 {
+			validated[playerID] = models.Loadout{Abilities: abilityIDs}
+		}
+	}
+
+	rules, err := ge.modes.Rules(match.GameMode, match.Settings)
+	if err != nil {
+		return nil, err
+	}
+	clientSeeds := make(map[string]string, len(s.players))
+	for _, playerID := range s.players {
+		clientSeeds[playerID] = ""
+	}
+	fairness := NewSeededRandom(serverSeed, combineClientSeeds(s.players, clientSeeds))
+	dice := newMatchDice(fairness, rules)
+	modeConfig := rules.Config()
+
+	at := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	created := &matchCreatedEvent{
+		GameMode:       match.GameMode,
+		GameType:       match.GameType,
+		Players:        match.Players,
+		Settings:       match.Settings,
+		Mode:           &modeConfig,
+		Loadouts:       validated,
+		ClientSeeds:    clientSeeds,
+		ServerSeedHash: hashServerSeed(serverSeed),
+		DiceWeights:    dice.Weights(),
+		Bots:           match.Bots,
+	}
+	data, err := eventData(created)
+	if err != nil {
+		return nil, err
+	}
+	state := newMatchState(match.ID, created, at)
+	appendEvent(state, &models.GameAction{
+		ID:        fmt.Sprintf("%s_%s", eventCreateMatch, match.ID),
+		MatchID:   match.ID,
+		Type:      eventCreateMatch,
+		Data:      data,
+		Timestamp: at,
+	}, &models.GameActionResult{Success: true, Message: "Match created"})
+
+	activeMatch := &ActiveMatch{
+		Match:     match,
+		State:     state,
+		Rules:     rules,
+		Dice:      dice,
+		Fairness:  fairness,
+		GamePhase: models.MatchPhaseSetup,
+	}
+
+	bots := make([]*matchBot, len(s.players))
+	for i, playerID := range s.players {
+		level, _ := botLevelFor(s.bots[playerID])
+		bots[i] = &matchBot{
+			ge:            ge,
+			match:         activeMatch,
+			playerID:      playerID,
+			level:         level,
+			strategy:      botStrategyFor(rules.Config().ID),
+			random:        random,
+			skipAbilities: -1,
+		}
+	}
+
+	result := &SimulatedMatch{State: state, Deficits: make(map[string]int, len(s.players))}
+	next := &models.GameAction{
+		Type: eventStartMatch,
+		Data: map[string]interface{}{"chooser_id": s.players[random.Intn(len(s.players))]},
+	}
+	for actions := 0; ; actions++ {
+		if actions > 0 {
+			if outcome := ge.checkMatchEnd(activeMatch); outcome != nil {
+				next = &models.GameAction{Type: eventEndMatch, Data: outcome}
+			} else if next = nextSimulatedAction(bots, activeMatch); next == nil {
+				return nil, fmt.Errorf("match %d: %w in phase %s", index, errStalledMatch, state.Phase)
+			}
+		}
+		if actions == maxSimulatedActions {
+			return nil, fmt.Errorf("match %d did not end within %d actions", index, maxSimulatedActions)
+		}
+
+		at = at.Add(simulatedActionGap)
+		next.MatchID = match.ID
+		next.Timestamp = at
+		if next.ID == "" {
+			next.ID = fmt.Sprintf("%s_%s", next.Type, match.ID)
+		}
+		sequence := state.Sequence
+		if err := ge.applyAction(activeMatch, next); err != nil {
+			// A refused ability is skipped, as a live bot skips it
+			if next.Type == "use_ability" {
+				for _, bot := range bots {
+					if bot.playerID == next.PlayerID {
+						bot.skipAbilities = sequence
+					}
+				}
+				continue
+			}
+			return nil, fmt.Errorf("match %d: %s rejected: %w", index, next.Type, err)
+		}
+		if next.Type == eventEndMatch {
+			return result, nil
+		}
+		result.trackDeficits(state, rules.Config())
+	}
+}
+
+// seeds returns the bots' random source and the server seed for a match,
+// derived from the run's seed when it has one
+func (s *Simulation) seeds(index int) (*rand.Rand, []byte, error) {
+	if s.config.Seed == 0 {
+		serverSeed, err := newServerSeed()
+		if err != nil {
+			return nil, nil, err
+		}
+		return rand.New(rand.NewSource(time.Now().UnixNano() + int64(index))), serverSeed, nil
+	}
+	serverSeed := sha256.Sum256([]byte(fmt.Sprintf("%d:%d", s.config.Seed, index)))
+	return rand.New(rand.NewSource(s.config.Seed*1000003 + int64(index))), serverSeed[:], nil
+}
+
+// nextSimulatedAction asks the bots for their next move. Players waiting for
+// their turn go first, so abilities used against a turn land during it.
+func nextSimulatedAction(bots []*matchBot, activeMatch *ActiveMatch) *models.GameAction {
+	state := activeMatch.State
+	start := 0
+	for i, bot := range bots {
+		if bot.playerID == state.CurrentTurn {
+			start = i + 1
+		}
+	}
+
+	for offset := range bots {
+		bot := bots[(start+offset)%len(bots)]
+		actionType, data, _ := bot.decide(&botView{
+			state:    state,
+			rules:    activeMatch.Rules,
+			playerID: bot.playerID,
+			level:    bot.level,
+		})
+		if actionType != "" {
+			id := fmt.Sprintf("sim_%s_%d_%s", bot.playerID, state.Sequence, actionType)
+			if abilityID, ok := data["ability_id"].(string); ok {
+				id += "_" + abilityID
+			}
+			return &models.GameAction{
+				ID:       id,
+				PlayerID: bot.playerID,
+				Type:     actionType,
+				Data:     data,
+			}
+		}
+	}
+	return nil
+}
+
+// trackDeficits notes how far each player is behind the leader
+func (m *SimulatedMatch) trackDeficits(state *models.MatchState, config ModeConfig) {
+	progress := make(map[string]int, len(state.Players))
+	leader := 0
+	for i, playerID := range state.Players {
+		progress[playerID] = state.Scores[playerID] - config.StartingScore
+		if countsDown(config) {
+			progress[playerID] = -progress[playerID]
+		}
+		if i == 0 || progress[playerID] > leader {
+			leader = progress[playerID]
+		}
+	}
+	for playerID, points := range progress {
+		if deficit := leader - points; deficit > m.Deficits[playerID] {
+			m.Deficits[playerID] = deficit
+		}
+	}
+}
+
+// randomLoadout equips abilities at random within a bot level's star budget,
+// at most one of each category. Each ability is left out half the time so
+// every ability is also played without.
+func randomLoadout(abilities *AbilityRegistry, level *botLevel, random *rand.Rand) []string {
+	ids := abilities.Abilities()
+	random.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+
+	budget := starBudget(level.Level)
+	categories := make(map[string]bool)
+	loadout := make([]string, 0, maxLoadoutSize)
+	for _, id := range ids {
+		ability, _ := abilities.Get(id)
+		if len(loadout) == maxLoadoutSize || categories[ability.Category] || ability.StarCost > budget || random.Intn(2) == 0 {
+			continue
+		}
+		loadout = append(loadout, id)
+		categories[ability.Category] = true
+		budget -= ability.StarCost
+	}
+	return loadout
+}
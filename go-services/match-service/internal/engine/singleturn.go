@@ -0,0 +1,394 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+// GameModeData keys shared by the single-turn modes
+const (
+	completedPlayersKey = "completed_players"
+	decidedWinnerKey    = "decided_winner"
+)
+
+// completedPlayers returns the players who have finished their turn this round
+func completedPlayers(state *models.MatchState) []string {
+	return stringListSetting(state.GameModeData, completedPlayersKey)
+}
+
+// markTurnCompleted records that a player has used their turn this round
+func markTurnCompleted(state *models.MatchState, playerID string) []string {
+	completed := completedPlayers(state)
+	if !containsString(completed, playerID) {
+		completed = append(completed, playerID)
+	}
+	state.GameModeData[completedPlayersKey] = completed
+	return completed
+}
+
+// firstPendingPlayer returns the first of contenders, in seating order after the
+// current player, who has not yet played this round
+func firstPendingPlayer(state *models.MatchState, contenders []string) string {
+	completed := completedPlayers(state)
+	start := 0
+	for i, playerID := range state.Players {
+		if playerID == state.CurrentTurn {
+			start = i + 1
+			break
+		}
+	}
+
+	for offset := 0; offset < len(state.Players); offset++ {
+		playerID := state.Players[(start+offset)%len(state.Players)]
+		if containsString(contenders, playerID) && !containsString(completed, playerID) {
+			return playerID
+		}
+	}
+	return nextPlayerID(state)
+}
+
+// decidedWinner returns the winner recorded by a single-turn mode, if any
+func decidedWinner(state *models.MatchState) (string, bool) {
+	winner, ok := state.GameModeData[decidedWinnerKey].(string)
+	return winner, ok && winner != ""
+}
+
+// lastLineRules gives every player one short turn; doubles earn extra rolls and
+// a tie for the lead goes to sudden death, where the highest single roll wins
+type lastLineRules struct {
+	config   ModeConfig
+	settings lastLineSettings
+}
+
+func newLastLineRules(config ModeConfig) (GameModeRules, error) {
+	settings := lastLineSettings{RollLimit: 1}
+	if err := decodeSettings(config.Settings, &settings); err != nil {
+		return nil, err
+	}
+	return &lastLineRules{config: config, settings: settings}, nil
+}
+
+// Config returns the mode configuration
+func (lr *lastLineRules) Config() ModeConfig {
+	return lr.config
+}
+
+// rollLimit returns the number of rolls each player starts their turn with
+func (lr *lastLineRules) rollLimit() int {
+	if lr.settings.RollLimit > 0 {
+		return lr.settings.RollLimit
+	}
+	return 1
+}
+
+// Initialize sets up the single round and the roll allowance
+func (lr *lastLineRules) Initialize(activeMatch *ActiveMatch) error {
+	activeMatch.State.Status = "active"
+	activeMatch.State.Settings.MaxTurns = lr.config.MaxTurns
+
+	activeMatch.State.GameModeData = map[string]interface{}{
+		"roll_limit":         lr.rollLimit(),
+		"rolls_remaining":    lr.rollLimit(),
+		completedPlayersKey:  []string{},
+		"sudden_death":       []string{},
+		"sudden_death_rolls": map[string]int{},
+	}
+
+	for _, playerID := range activeMatch.State.Players {
+		activeMatch.State.Scores[playerID] = lr.config.StartingScore
+	}
+
+	return nil
+}
+
+// ProcessRoll scores the roll and banks automatically once the rolls run out
+func (lr *lastLineRules) ProcessRoll(state *models.MatchState, roll *models.DiceRoll) *models.GameActionResult {
+	playerID := roll.PlayerID
+	result := &models.GameActionResult{
+		Success: true,
+		Data:    make(map[string]interface{}),
+		Dice1:   roll.Dice1,
+		Dice2:   roll.Dice2,
+		Total:   roll.Total,
+	}
+
+	// Sudden death is a single roll per contender and never touches the score
+	if len(stringListSetting(state.GameModeData, "sudden_death")) > 0 {
+		rolls := intMapSetting(state.GameModeData, "sudden_death_rolls")
+		rolls[playerID] = roll.Total
+		state.GameModeData["sudden_death_rolls"] = rolls
+
+		result.Message = fmt.Sprintf("Sudden death roll of %d", roll.Total)
+		result.SpecialEffect = "sudden_death"
+		result.TurnOver = true
+		result.NewScore = state.Scores[playerID]
+		return result
+	}
+
+	state.TurnScore += roll.Total
+	remaining := intSetting(state.GameModeData, "rolls_remaining", lr.rollLimit()) - 1
+	result.Message = "Roll added to turn score"
+	result.ScoreChange = roll.Total
+	if roll.IsDouble {
+		remaining++
+		result.Message = "Double rolled, extra roll granted"
+		result.SpecialEffect = "extra_roll"
+	}
+	state.GameModeData["rolls_remaining"] = remaining
+
+	if remaining <= 0 {
+		state.Scores[playerID] += state.TurnScore
+		state.TurnScore = 0
+		result.TurnOver = true
+	}
+
+	roll.SpecialEffect = result.SpecialEffect
+	result.NewScore = state.Scores[playerID]
+	result.Data["turnScore"] = state.TurnScore
+	result.Data["rollsRemaining"] = remaining
+	return result
+}
+
+// CanBank is always false; turns bank automatically
+func (lr *lastLineRules) CanBank(state *models.MatchState) bool {
+	return false
+}
+
+// ProcessBank is not allowed; turns bank automatically
+func (lr *lastLineRules) ProcessBank(state *models.MatchState, playerID string) *models.GameActionResult {
+	return &models.GameActionResult{
+		Success: false,
+		Message: "banking is not allowed in Last Line",
+	}
+}
+
+// CheckWin returns the winner once the round, and any sudden death, is decided
+func (lr *lastLineRules) CheckWin(state *models.MatchState) (string, bool) {
+	return decidedWinner(state)
+}
+
+// OnTurnEnd closes the round once every contender has played, starting
+// sudden death between the leaders when they are tied
+func (lr *lastLineRules) OnTurnEnd(state *models.MatchState, playerID string) {
+	state.GameModeData["rolls_remaining"] = lr.rollLimit()
+
+	contenders := lr.contenders(state)
+	completed := markTurnCompleted(state, playerID)
+	for _, contender := range contenders {
+		if !containsString(completed, contender) {
+			return
+		}
+	}
+
+	// Everyone has played: rank by score, or by the sudden death roll
+	values := state.Scores
+	if len(stringListSetting(state.GameModeData, "sudden_death")) > 0 {
+		values = intMapSetting(state.GameModeData, "sudden_death_rolls")
+	}
+
+	leaders := make([]string, 0, len(contenders))
+	best := 0
+	for _, contender := range contenders {
+		value := values[contender]
+		switch {
+		case len(leaders) == 0 || value > best:
+			leaders = []string{contender}
+			best = value
+		case value == best:
+			leaders = append(leaders, contender)
+		}
+	}
+
+	if len(leaders) == 1 {
+		state.GameModeData[decidedWinnerKey] = leaders[0]
+		return
+	}
+
+	state.GameModeData["sudden_death"] = leaders
+	state.GameModeData["sudden_death_rolls"] = map[string]int{}
+	state.GameModeData[completedPlayersKey] = []string{}
+	state.GameModeData["rolls_remaining"] = 1
+}
+
+// NextPlayer hands the turn to the next contender who has not played this round
+func (lr *lastLineRules) NextPlayer(state *models.MatchState) string {
+	return firstPendingPlayer(state, lr.contenders(state))
+}
+
+// contenders returns the players still competing, narrowed during sudden death
+func (lr *lastLineRules) contenders(state *models.MatchState) []string {
+	if suddenDeath := stringListSetting(state.GameModeData, "sudden_death"); len(suddenDeath) > 0 {
+		return suddenDeath
+	}
+	return state.Players
+}
+
+// defaultTrueGritDoubles sets the turn multiplier to the die face; snake eyes is
+// worth 7x. Doubles add no points of their own, as in the frontend's table.
+var defaultTrueGritDoubles = map[int]DoubleEffect{
+	1: {Multiplier: 7},
+	2: {Multiplier: 2},
+	3: {Multiplier: 3},
+	4: {Multiplier: 4},
+	5: {Multiplier: 5},
+	6: {Multiplier: 6},
+}
+
+// trueGritRules gives every player one extended turn without banking. The turn
+// ends on a single 1, and the highest total wins.
+type trueGritRules struct {
+	config   ModeConfig
+	settings trueGritSettings
+	doubles  map[int]DoubleEffect
+}
+
+func newTrueGritRules(config ModeConfig) (GameModeRules, error) {
+	settings := trueGritSettings{SingleOneFactor: 0.8}
+	if err := decodeSettings(config.Settings, &settings); err != nil {
+		return nil, err
+	}
+	return &trueGritRules{
+		config:   config,
+		settings: settings,
+		doubles:  mergeDoubleEffects(defaultTrueGritDoubles, settings.DoublesEffects),
+	}, nil
+}
+
+// Config returns the mode configuration
+func (tg *trueGritRules) Config() ModeConfig {
+	return tg.config
+}
+
+// DiceWeights makes a single 1 less likely so extended turns run longer
+func (tg *trueGritRules) DiceWeights() [6]float64 {
+	return singleOneWeights(tg.settings.SingleOneFactor)
+}
+
+// Initialize sets up the single round
+func (tg *trueGritRules) Initialize(activeMatch *ActiveMatch) error {
+	activeMatch.State.Status = "active"
+	activeMatch.State.Settings.MaxTurns = tg.config.MaxTurns
+
+	activeMatch.State.GameModeData = map[string]interface{}{
+		completedPlayersKey: []string{},
+		"single_one_factor": tg.settings.SingleOneFactor,
+	}
+
+	for _, playerID := range activeMatch.State.Players {
+		activeMatch.State.Scores[playerID] = tg.config.StartingScore
+	}
+
+	return nil
+}
+
+// ProcessRoll applies True Grit scoring. A single 1 banks the turn and ends it;
+// doubles set the turn multiplier; the last player to go stops as soon as they
+// overtake everyone else.
+func (tg *trueGritRules) ProcessRoll(state *models.MatchState, roll *models.DiceRoll) *models.GameActionResult {
+	playerID := roll.PlayerID
+	if state.Multipliers == nil {
+		state.Multipliers = make(map[string]int)
+	}
+	multiplier := turnMultiplier(state, playerID)
+
+	result := &models.GameActionResult{
+		Success: true,
+		Data:    make(map[string]interface{}),
+		Dice1:   roll.Dice1,
+		Dice2:   roll.Dice2,
+		Total:   roll.Total,
+	}
+
+	switch {
+	case isSingleOne(roll):
+		result.Message = fmt.Sprintf("Single 1 rolled, banked %d", state.TurnScore)
+		result.SpecialEffect = "turn_end"
+		result.ScoreChange = state.TurnScore
+		state.Scores[playerID] += state.TurnScore
+		state.TurnScore = 0
+		result.TurnOver = true
+
+	case roll.IsDouble:
+		effect := tg.doubles[roll.Dice1]
+		state.TurnScore += effect.ScoreBonus
+		if effect.Multiplier > 1 {
+			state.Multipliers[playerID] = effect.Multiplier
+		}
+		result.Message = fmt.Sprintf("Double %ds rolled, %dx multiplier", roll.Dice1, effect.Multiplier)
+		result.SpecialEffect = fmt.Sprintf("double_%d", roll.Dice1)
+		result.BonusPoints = effect.ScoreBonus
+		result.ScoreChange = effect.ScoreBonus
+
+	default:
+		result.Message = "Roll added to turn score"
+		result.ScoreChange = roll.Total * multiplier
+		state.TurnScore += roll.Total * multiplier
+	}
+
+	// The final player stops once the match can no longer be lost
+	if !result.TurnOver && tg.isFinalPlayer(state, playerID) {
+		best := 0
+		for _, opponentID := range state.Players {
+			if opponentID != playerID && state.Scores[opponentID] > best {
+				best = state.Scores[opponentID]
+			}
+		}
+		if state.Scores[playerID]+state.TurnScore > best {
+			state.Scores[playerID] += state.TurnScore
+			state.TurnScore = 0
+			result.TurnOver = true
+			result.Message = "Overtook the leader"
+			result.Data["earlyEnd"] = true
+		}
+	}
+
+	roll.Multiplier = turnMultiplier(state, playerID)
+	roll.BonusPoints = result.BonusPoints
+	roll.SpecialEffect = result.SpecialEffect
+
+	result.Multiplier = roll.Multiplier
+	result.NewScore = state.Scores[playerID]
+	result.Data["turnScore"] = state.TurnScore
+	return result
+}
+
+// CanBank is always false; the turn only ends on a single 1
+func (tg *trueGritRules) CanBank(state *models.MatchState) bool {
+	return false
+}
+
+// ProcessBank is not allowed; the turn only ends on a single 1
+func (tg *trueGritRules) ProcessBank(state *models.MatchState, playerID string) *models.GameActionResult {
+	return &models.GameActionResult{
+		Success: false,
+		Message: "banking is not allowed in True Grit",
+	}
+}
+
+// CheckWin decides the match once every player has had their turn
+func (tg *trueGritRules) CheckWin(state *models.MatchState) (string, bool) {
+	completed := completedPlayers(state)
+	for _, playerID := range state.Players {
+		if !containsString(completed, playerID) {
+			return "", false
+		}
+	}
+	return leadingPlayer(state), true
+}
+
+// OnTurnEnd records that the player has used their only turn
+func (tg *trueGritRules) OnTurnEnd(state *models.MatchState, playerID string) {
+	markTurnCompleted(state, playerID)
+}
+
+// NextPlayer hands the turn to the next player who has not yet played
+func (tg *trueGritRules) NextPlayer(state *models.MatchState) string {
+	return firstPendingPlayer(state, state.Players)
+}
+
+// isFinalPlayer reports whether everyone but playerID has finished their turn
+func (tg *trueGritRules) isFinalPlayer(state *models.MatchState, playerID string) bool {
+	completed := completedPlayers(state)
+	return len(completed) == len(state.Players)-1 && !containsString(completed, playerID)
+}
@@ -0,0 +1,164 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+// playRolls plays rolls for whoever's turn it is, handing the turn on as the
+// engine does when a roll ends it
+func playRolls(rules GameModeRules, state *models.MatchState, rolls [][2]int) *models.GameActionResult {
+	var result *models.GameActionResult
+	for _, dice := range rolls {
+		playerID := state.CurrentTurn
+		result = rules.ProcessRoll(state, &models.DiceRoll{
+			PlayerID: playerID,
+			Dice1:    dice[0],
+			Dice2:    dice[1],
+			Total:    dice[0] + dice[1],
+			IsDouble: dice[0] == dice[1],
+		})
+		if result.TurnOver {
+			delete(state.Multipliers, playerID)
+			rules.OnTurnEnd(state, playerID)
+			state.CurrentTurn = nextTurnPlayer(rules, state)
+		}
+	}
+	return result
+}
+
+func TestLastLineCheckWin(t *testing.T) {
+	tests := []struct {
+		name        string
+		players     []string
+		rolls       [][2]int
+		winner      string
+		finished    bool
+		suddenDeath []string
+	}{
+		{
+			name:    "round still in play",
+			players: []string{"a", "b"},
+			rolls:   [][2]int{{2, 4}},
+		},
+		{
+			name:     "highest total wins",
+			players:  []string{"a", "b"},
+			rolls:    [][2]int{{2, 4}, {5, 6}},
+			winner:   "b",
+			finished: true,
+		},
+		{
+			name:     "double earns an extra roll",
+			players:  []string{"a", "b"},
+			rolls:    [][2]int{{3, 3}, {2, 4}, {5, 6}},
+			winner:   "a",
+			finished: true,
+		},
+		{
+			name:        "tie for the lead goes to sudden death",
+			players:     []string{"a", "b", "c"},
+			rolls:       [][2]int{{3, 4}, {2, 5}, {1, 2}},
+			suddenDeath: []string{"a", "b"},
+		},
+		{
+			name:        "sudden death decided by the highest roll",
+			players:     []string{"a", "b", "c"},
+			rolls:       [][2]int{{3, 4}, {2, 5}, {1, 2}, {1, 2}, {2, 2}},
+			winner:      "b",
+			finished:    true,
+			suddenDeath: []string{"a", "b"},
+		},
+		{
+			name:        "tied sudden death goes again",
+			players:     []string{"a", "b"},
+			rolls:       [][2]int{{3, 4}, {2, 5}, {2, 3}, {1, 4}},
+			suddenDeath: []string{"a", "b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, state := newModeMatch(t, models.GameModeLastLine, nil, tt.players...)
+			playRolls(rules, state, tt.rolls)
+
+			winner, finished := rules.CheckWin(state)
+			if winner != tt.winner || finished != tt.finished {
+				t.Errorf("CheckWin() = %q, %v, want %q, %v", winner, finished, tt.winner, tt.finished)
+			}
+			suddenDeath := stringListSetting(state.GameModeData, "sudden_death")
+			if len(suddenDeath) != len(tt.suddenDeath) {
+				t.Fatalf("sudden death = %v, want %v", suddenDeath, tt.suddenDeath)
+			}
+			for i := range suddenDeath {
+				if suddenDeath[i] != tt.suddenDeath[i] {
+					t.Fatalf("sudden death = %v, want %v", suddenDeath, tt.suddenDeath)
+				}
+			}
+		})
+	}
+}
+
+func TestTrueGritCheckWin(t *testing.T) {
+	tests := []struct {
+		name     string
+		rolls    [][2]int
+		scores   map[string]int
+		winner   string
+		finished bool
+		earlyEnd bool
+	}{
+		{
+			name:   "first turn still in play",
+			rolls:  [][2]int{{2, 3}, {4, 4}},
+			scores: map[string]int{"a": 0, "b": 0},
+		},
+		{
+			name:   "single one banks the turn",
+			rolls:  [][2]int{{2, 3}, {4, 4}, {2, 3}, {1, 3}},
+			scores: map[string]int{"a": 25, "b": 0},
+		},
+		{
+			name:     "last player stops once they overtake",
+			rolls:    [][2]int{{2, 3}, {1, 3}, {2, 2}, {2, 3}},
+			scores:   map[string]int{"a": 5, "b": 10},
+			winner:   "b",
+			finished: true,
+			earlyEnd: true,
+		},
+		{
+			name:     "last player busts short",
+			rolls:    [][2]int{{5, 6}, {1, 3}, {2, 3}, {1, 2}},
+			scores:   map[string]int{"a": 11, "b": 5},
+			winner:   "a",
+			finished: true,
+		},
+		{
+			name:     "tie has no winner",
+			rolls:    [][2]int{{1, 2}, {1, 2}},
+			scores:   map[string]int{"a": 0, "b": 0},
+			finished: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, state := newModeMatch(t, models.GameModeTrueGrit, nil, "a", "b")
+			result := playRolls(rules, state, tt.rolls)
+
+			for playerID, score := range tt.scores {
+				if state.Scores[playerID] != score {
+					t.Errorf("score of %s = %d, want %d", playerID, state.Scores[playerID], score)
+				}
+			}
+			if earlyEnd, _ := result.Data["earlyEnd"].(bool); earlyEnd != tt.earlyEnd {
+				t.Errorf("early end = %v, want %v", earlyEnd, tt.earlyEnd)
+			}
+			winner, finished := rules.CheckWin(state)
+			if winner != tt.winner || finished != tt.finished {
+				t.Errorf("CheckWin() = %q, %v, want %q, %v", winner, finished, tt.winner, tt.finished)
+			}
+		})
+	}
+}
@@ -0,0 +1,419 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+
+	apperrors "github.com/LukeAtkinz/dashdice/go-services/shared/errors"
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+// maxSpectatorDelay is the longest broadcast delay a match may ask for, in seconds
+const maxSpectatorDelay = 300
+
+// gameTypeRanked is the match type spectating is off for unless asked for
+const gameTypeRanked = "ranked"
+
+// Errors returned when spectating is refused
+var (
+	errSpectatingDisabled = errors.New("match does not allow spectators")
+	errInvalidSpectating  = errors.New("invalid spectator settings")
+)
+
+// spectatorPolicy is how a match may be watched, settled when it is created
+type spectatorPolicy struct {
+	Allowed  bool     `json:"allowed"`
+	Delay    int      `json:"delay,omitempty"`     // seconds
+	OptedOut []string `json:"opted_out,omitempty"` // players who disabled spectating
+}
+
+// resolveSpectating works out a new match's spectator policy. Ranked matches
+// are private unless the creator asks otherwise, lobby hosts choose for their
+// own matches, and any player who disabled spectating keeps the match private.
+func resolveSpectating(match *models.Match, players map[string]*models.User) (spectatorPolicy, error) {
+	var settings spectatorSettings
+	if err := decodeSettings(match.Settings, &settings); err != nil {
+		return spectatorPolicy{}, fmt.Errorf("%w: %v", errInvalidSpectating, err)
+	}
+	if settings.SpectatorDelay < 0 || settings.SpectatorDelay > maxSpectatorDelay {
+		return spectatorPolicy{}, fmt.Errorf("%w: spectator_delay must be between 0 and %d seconds",
+			errInvalidSpectating, maxSpectatorDelay)
+	}
+
+	policy := spectatorPolicy{
+		Allowed: match.GameType != gameTypeRanked,
+		Delay:   settings.SpectatorDelay,
+	}
+	if settings.AllowSpectators != nil {
+		policy.Allowed = *settings.AllowSpectators
+	}
+
+	// Players whose profile could not be loaded keep the default
+	for _, playerID := range match.Players {
+		if user, ok := players[playerID]; ok && user.Preferences.DisableSpectating {
+			policy.OptedOut = append(policy.OptedOut, playerID)
+		}
+	}
+	if len(policy.OptedOut) > 0 {
+		policy.Allowed = false
+	}
+	return policy, nil
+}
+
+// canSpectate checks that a user may watch a match
+func canSpectate(state *models.MatchState, userID string) error {
+	if _, isPlayer := state.PlayerData[userID]; isPlayer {
+		return apperrors.BadRequest("Players cannot spectate their own match")
+	}
+	if !state.Settings.SpectatorMode {
+		return fmt.Errorf("%w: %s", errSpectatingDisabled, state.ID)
+	}
+	return nil
+}
+
+// isSpectating reports whether a user is watching a match
+func isSpectating(state *models.MatchState, userID string) bool {
+	return containsString(state.Spectators, userID)
+}
+
+// isSpectatorEvent reports whether an event only records spectators coming and going
+func isSpectatorEvent(eventType string) bool {
+	return eventType == eventSpectatorJoin || eventType == eventSpectatorLeave
+}
+
+// JoinSpectator adds a user to a match's spectators. Joining a match the user
+// already watches records nothing and returns no event.
+func (ge *GameEngine) JoinSpectator(matchID, userID string) (*models.GameAction, error) {
+	activeMatch, exists := ge.GetMatch(matchID)
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", errMatchNotFound, matchID)
+	}
+
+	activeMatch.mutex.RLock()
+	err := canSpectate(activeMatch.State, userID)
+	watching := isSpectating(activeMatch.State, userID)
+	activeMatch.mutex.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	if watching {
+		return nil, nil
+	}
+	return ge.submitAction(activeMatch, spectatorEvent(eventSpectatorJoin, matchID, userID), nil)
+}
+
+// LeaveSpectator removes a user from a match's spectators. Leaving a match the
+// user does not watch records nothing and returns no event.
+func (ge *GameEngine) LeaveSpectator(matchID, userID string) (*models.GameAction, error) {
+	activeMatch, exists := ge.GetMatch(matchID)
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", errMatchNotFound, matchID)
+	}
+
+	activeMatch.mutex.RLock()
+	watching := isSpectating(activeMatch.State, userID)
+	activeMatch.mutex.RUnlock()
+	if !watching {
+		return nil, nil
+	}
+	return ge.submitAction(activeMatch, spectatorEvent(eventSpectatorLeave, matchID, userID), nil)
+}
+
+// spectatorEvent builds a spectator join or leave event. Spectators are not
+// players, so the event names them in its data.
+func spectatorEvent(eventType, matchID, userID string) *models.GameAction {
+	now := time.Now()
+	return &models.GameAction{
+		ID:        fmt.Sprintf("%s_%s_%d", eventType, userID, now.UnixNano()),
+		MatchID:   matchID,
+		PlayerID:  "", // System action
+		Type:      eventType,
+		Timestamp: now,
+		Data:      map[string]interface{}{"user_id": userID},
+	}
+}
+
+// handleSpectatorJoin applies a spectator_join event
+func (ge *GameEngine) handleSpectatorJoin(activeMatch *ActiveMatch, action *models.GameAction) error {
+	state := activeMatch.State
+	if state.CompletedAt != nil {
+		return fmt.Errorf("match has already ended")
+	}
+
+	userID, _ := action.Data["user_id"].(string)
+	if userID == "" {
+		return fmt.Errorf("invalid %s event: missing user_id", eventSpectatorJoin)
+	}
+	if err := canSpectate(state, userID); err != nil {
+		return err
+	}
+	if isSpectating(state, userID) {
+		return fmt.Errorf("already spectating: %s", userID)
+	}
+
+	state.Spectators = append(state.Spectators, userID)
+	state.SpectatorCount = len(state.Spectators)
+
+	appendEvent(state, action, &models.GameActionResult{
+		Success: true,
+		Message: "Spectator joined",
+		Data:    map[string]interface{}{"spectator_count": state.SpectatorCount},
+	})
+	return nil
+}
+
+// handleSpectatorLeave applies a spectator_leave event
+func (ge *GameEngine) handleSpectatorLeave(activeMatch *ActiveMatch, action *models.GameAction) error {
+	state := activeMatch.State
+	userID, _ := action.Data["user_id"].(string)
+	if !isSpectating(state, userID) {
+		return fmt.Errorf("not spectating: %s", userID)
+	}
+
+	removeSpectators(state, userID)
+
+	appendEvent(state, action, &models.GameActionResult{
+		Success: true,
+		Message: "Spectator left",
+		Data:    map[string]interface{}{"spectator_count": state.SpectatorCount},
+	})
+	return nil
+}
+
+// removeSpectators drops the given spectators from the state, or all of them
+// when none are given
+func removeSpectators(state *models.MatchState, userIDs ...string) {
+	if len(userIDs) == 0 {
+		state.Spectators = nil
+		state.SpectatorCount = 0
+		return
+	}
+
+	remaining := make([]string, 0, len(state.Spectators))
+	for _, spectator := range state.Spectators {
+		if !containsString(userIDs, spectator) {
+			remaining = append(remaining, spectator)
+		}
+	}
+	state.Spectators = remaining
+	state.SpectatorCount = len(remaining)
+}
+
+// spectatorRedactedFields are the encoded state fields spectatorState changes,
+// besides the event log
+var spectatorRedactedFields = map[string]bool{
+	"playerData": true,
+	"fairness":   true,
+	"lastAction": true,
+	"lastResult": true,
+}
+
+// spectatorState copies the parts of a match state spectators may see:
+// seeds stay hidden until the match ends, and loadouts and connection
+// details are never shown
+func spectatorState(state *models.MatchState) *models.MatchState {
+	view := *state
+	view.ActionHistory = nil
+
+	view.PlayerData = make(map[string]models.MatchPlayer, len(state.PlayerData))
+	for playerID, player := range state.PlayerData {
+		player.Loadout = models.Loadout{}
+		player.IPAddress = ""
+		player.UserAgent = ""
+		view.PlayerData[playerID] = player
+	}
+
+	if state.Fairness != nil && state.CompletedAt == nil {
+		fairness := *state.Fairness
+		fairness.ServerSeed = ""
+		fairness.ClientSeeds = nil
+		view.Fairness = &fairness
+	}
+
+	if state.LastAction != nil {
+		lastAction := redactEvent(*state.LastAction)
+		view.LastAction = &lastAction
+		if state.LastResult == state.LastAction.Result {
+			view.LastResult = lastAction.Result
+		}
+	}
+	return &view
+}
+
+// redactEvent copies a logged event without the seeds and loadouts it carries
+func redactEvent(event models.GameAction) models.GameAction {
+	var hidden []string
+	switch event.Type {
+	case eventCreateMatch:
+		hidden = []string{"client_seeds", "loadouts"}
+	case "set_client_seed":
+		hidden = []string{"client_seed"}
+	default:
+		return event
+	}
+
+	event.Data = withoutKeys(event.Data, hidden)
+	if event.Result != nil {
+		result := *event.Result
+		result.Data = withoutKeys(result.Data, hidden)
+		event.Result = &result
+	}
+	return event
+}
+
+// withoutKeys copies a map without the given keys
+func withoutKeys(data map[string]interface{}, keys []string) map[string]interface{} {
+	if data == nil {
+		return nil
+	}
+	copied := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		if !containsString(keys, key) {
+			copied[key] = value
+		}
+	}
+	return copied
+}
+
+// spectatorUpdate is a redacted state held back until spectators may see it
+type spectatorUpdate struct {
+	doc     syncDocument
+	history []models.GameAction
+	due     time.Time
+}
+
+// spectatorFeed is the stream spectators watch: the match state redacted and
+// delayed, so it cannot be used to help a player. It is versioned apart from
+// the players' stream.
+type spectatorFeed struct {
+	version int64
+	doc     syncDocument
+	history []models.GameAction
+	pending []spectatorUpdate
+
+	// The event log redacted as far as it has been synced
+	redacted redactedLog
+}
+
+// redactedLog is a redacted copy of a growing event log
+type redactedLog []models.GameAction
+
+// sync returns the redacted copy of an event log, redacting only the events
+// not seen before
+func (l *redactedLog) sync(history []models.GameAction) []models.GameAction {
+	// Copies already handed out are never written to again
+	if len(history) < len(*l) {
+		*l = nil
+	}
+	for i := len(*l); i < len(history); i++ {
+		*l = append(*l, redactEvent(history[i]))
+	}
+	return (*l)[:len(history):len(history)]
+}
+
+// queueSpectatorUpdate holds a redacted state back for the match's broadcast
+// delay, or sends it to spectators straight away when there is none. Callers
+// hold the hub mutex.
+func (h *MatchHub) queueSpectatorUpdate(doc syncDocument, history []models.GameAction, delay time.Duration) {
+	now := time.Now()
+	h.spectators.pending = append(h.spectators.pending, spectatorUpdate{
+		doc:     doc,
+		history: h.spectators.redacted.sync(history),
+		due:     now.Add(delay),
+	})
+	if delay <= 0 {
+		h.releaseSpectatorUpdates(now, false)
+		return
+	}
+
+	time.AfterFunc(delay, func() {
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		if !h.closed {
+			h.releaseSpectatorUpdates(time.Now(), false)
+		}
+	})
+}
+
+// flushSpectatorUpdates sends spectators everything still held back. Once a
+// match is over there is nothing left to hide.
+func (h *MatchHub) flushSpectatorUpdates() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.releaseSpectatorUpdates(time.Now(), true)
+}
+
+// releaseSpectatorUpdates moves spectators on to the latest held back state
+// that is due, or to the latest of all. Spectators who had nothing to see yet
+// start from a snapshot. Callers hold the hub mutex.
+func (h *MatchHub) releaseSpectatorUpdates(now time.Time, all bool) {
+	feed := &h.spectators
+	due := 0
+	for due < len(feed.pending) && (all || !feed.pending[due].due.After(now)) {
+		due++
+	}
+	if due == 0 {
+		return
+	}
+	latest := feed.pending[due-1]
+	feed.pending = feed.pending[due:]
+
+	base, baseDoc, baseHistory := feed.version, feed.doc, feed.history
+	var ops []patchOp
+	if baseDoc != nil {
+		ops = syncPatch(baseDoc, latest.doc, baseHistory, latest.history)
+		if len(ops) == 0 {
+			return
+		}
+	}
+	feed.doc, feed.history = latest.doc, latest.history
+	feed.version++
+
+	message := serverMessage{
+		Type:        "patch",
+		Version:     feed.version,
+		BaseVersion: base,
+		Sequence:    historySequence(feed.history),
+		Ops:         ops,
+		Timestamp:   now.Unix(),
+	}
+	if baseDoc == nil {
+		message = serverMessage{
+			Type:      "snapshot",
+			Version:   feed.version,
+			Sequence:  historySequence(feed.history),
+			State:     syncSnapshot(feed.doc, feed.history),
+			Timestamp: now.Unix(),
+		}
+	}
+	payload, err := json.Marshal(message)
+	if err != nil {
+		h.logger.Error("Failed to encode spectator update",
+			zap.String("match_id", h.matchID),
+			zap.Error(err))
+		return
+	}
+	h.broadcast(payload, true)
+}
+
+// dropSpectators disconnects every spectator once a match stops allowing
+// them, and forgets what they were sent. Callers hold the hub mutex.
+func (h *MatchHub) dropSpectators() {
+	h.spectators = spectatorFeed{redacted: h.spectators.redacted}
+
+	message := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "spectating disabled")
+	for client := range h.clients {
+		if !client.spectator {
+			continue
+		}
+		delete(h.clients, client)
+		client.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(socketWriteWait))
+		client.closeSend()
+	}
+}
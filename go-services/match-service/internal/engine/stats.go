@@ -0,0 +1,197 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"go.uber.org/zap"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/database"
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+// usersCollection is the Firestore collection holding user records and their stats
+const usersCollection = "users"
+
+// Elo rating constants
+const (
+	defaultEloRating = 1200
+	eloKFactor       = 32
+)
+
+// matchPoints scores a player's result for ratings: 1 for a win, 0.5 for a draw, 0 for a loss
+func matchPoints(state *models.MatchState, playerID string) float64 {
+	switch {
+	case state.WinReason == models.WinReasonDraw:
+		return 0.5
+	case state.Winner == playerID:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// eloRating returns a player's rating in a game mode
+func eloRating(stats *models.PlayerStats, gameMode string) int {
+	if rating, ok := stats.EloRatings[gameMode]; ok {
+		return rating
+	}
+	return defaultEloRating
+}
+
+// ratingChanges returns each player's Elo change. Every player is rated
+// against every opponent: the winner beat them all, and the rest drew with
+// each other.
+func ratingChanges(state *models.MatchState, ratings map[string]int) map[string]int {
+	changes := make(map[string]int, len(ratings))
+	if len(ratings) < 2 {
+		return changes
+	}
+
+	for playerID, rating := range ratings {
+		total := 0.0
+		for opponentID, opponentRating := range ratings {
+			if opponentID == playerID {
+				continue
+			}
+			actual := 0.5
+			switch {
+			case state.WinReason == models.WinReasonDraw:
+			case state.Winner == playerID:
+				actual = 1
+			case state.Winner == opponentID:
+				actual = 0
+			}
+			expected := 1 / (1 + math.Pow(10, float64(opponentRating-rating)/400))
+			total += actual - expected
+		}
+		changes[playerID] = int(math.Round(eloKFactor * total / float64(len(ratings)-1)))
+	}
+	return changes
+}
+
+// statScore is the score a player's statistics record for a match: the
+// points they reached, or in countdown modes how far they counted down, so a
+// higher score is always the better one
+func statScore(state *models.MatchState, config ModeConfig, playerID string) int {
+	score := state.Scores[playerID]
+	if countsDown(config) {
+		score = config.StartingScore - score
+		if score < 0 {
+			score = 0
+		}
+	}
+	return score
+}
+
+// applyMatchStats adds one ended match to a player's statistics. Ratings only
+// move in ranked matches.
+func applyMatchStats(stats *models.PlayerStats, state *models.MatchState, config ModeConfig, playerID string, ratingChange int) {
+	score := statScore(state, config, playerID)
+	playTime := int64(0)
+	if state.StartedAt != nil && state.CompletedAt != nil {
+		playTime = int64(state.CompletedAt.Sub(*state.StartedAt).Seconds())
+	}
+
+	stats.TotalMatches++
+	stats.TotalScore += int64(score)
+	stats.PlayTime += playTime
+	if score > stats.HighestScore {
+		stats.HighestScore = score
+	}
+
+	// A draw neither extends nor breaks a winning streak
+	points := matchPoints(state, playerID)
+	switch points {
+	case 1:
+		stats.Wins++
+		stats.CurrentStreak++
+		if stats.CurrentStreak > stats.BestStreak {
+			stats.BestStreak = stats.CurrentStreak
+		}
+	case 0.5:
+		stats.Draws++
+	default:
+		stats.Losses++
+		stats.CurrentStreak = 0
+	}
+	stats.WinRate = float64(stats.Wins) / float64(stats.TotalMatches)
+	stats.AverageScore = float64(stats.TotalScore) / float64(stats.TotalMatches)
+
+	if stats.GameModeStats == nil {
+		stats.GameModeStats = make(map[string]models.GameModeStats)
+	}
+	modeStats := stats.GameModeStats[state.GameMode]
+	modeStats.Matches++
+	modeStats.PlayTime += playTime
+	modeStats.AverageScore += (float64(score) - modeStats.AverageScore) / float64(modeStats.Matches)
+	if score > modeStats.BestScore {
+		modeStats.BestScore = score
+	}
+	switch points {
+	case 1:
+		modeStats.Wins++
+	case 0.5:
+		modeStats.Draws++
+	default:
+		modeStats.Losses++
+	}
+	modeStats.WinRate = float64(modeStats.Wins) / float64(modeStats.Matches)
+	stats.GameModeStats[state.GameMode] = modeStats
+
+	if state.GameType != gameTypeRanked {
+		return
+	}
+	if stats.EloRatings == nil {
+		stats.EloRatings = make(map[string]int)
+	}
+	stats.EloRatings[state.GameMode] = eloRating(stats, state.GameMode) + ratingChange
+}
+
+// recordMatchStats updates every player's statistics and rating for an ended
+// match. Void matches count for no one. Each player's stats are updated in a
+// transaction, so results of matches ending together are never lost.
+func (ge *GameEngine) recordMatchStats(ctx context.Context, state *models.MatchState, config ModeConfig) {
+	if state.WinReason == models.WinReasonVoid {
+		return
+	}
+
+	// Rating changes are settled against the ratings players went in with
+	changes := make(map[string]int)
+	if state.GameType == gameTypeRanked {
+		users := ge.loadPlayers(ctx, humanPlayers(state))
+		ratings := make(map[string]int, len(state.Players))
+		for playerID, user := range users {
+			ratings[playerID] = eloRating(&user.Stats, state.GameMode)
+		}
+
+		// Bots count at their difficulty's rating and keep no statistics
+		for _, playerID := range state.Players {
+			if player := state.PlayerData[playerID]; player.IsBot {
+				ratings[playerID] = player.EloRating
+			}
+		}
+		changes = ratingChanges(state, ratings)
+	}
+
+	firestore := ge.dbManager.Firestore()
+	for _, playerID := range humanPlayers(state) {
+		err := firestore.RunTransaction(ctx, func(ctx context.Context, tx database.Transaction) error {
+			var user models.User
+			if err := tx.Get(ctx, usersCollection, playerID, &user); err != nil {
+				return fmt.Errorf("failed to load player stats: %w", err)
+			}
+			applyMatchStats(&user.Stats, state, config, playerID, changes[playerID])
+			return tx.Update(ctx, usersCollection, playerID, map[string]interface{}{
+				"stats": user.Stats,
+			})
+		})
+		if err != nil {
+			ge.logger.Error("Failed to update player stats",
+				zap.String("match_id", state.ID),
+				zap.String("user_id", playerID),
+				zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+func TestApplyMatchStats(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		gameType string
+		scores   map[string]int
+		score    int
+		rating   int
+	}{
+		{name: "quick match keeps the rating", mode: models.GameModeClassic, gameType: "quick", scores: map[string]int{"a": 104, "b": 60}, score: 104, rating: 1200},
+		{name: "ranked match moves the rating", mode: models.GameModeClassic, gameType: gameTypeRanked, scores: map[string]int{"a": 104, "b": 60}, score: 104, rating: 1216},
+		{name: "countdown records the distance counted down", mode: models.GameModeZeroHour, gameType: "quick", scores: map[string]int{"a": 0, "b": 37}, score: 100, rating: 1200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := defaultModeRegistry().Rules(tt.mode, nil)
+			if err != nil {
+				t.Fatalf("failed to build rules: %v", err)
+			}
+			state := &models.MatchState{
+				GameMode: tt.mode,
+				GameType: tt.gameType,
+				Players:  []string{"a", "b"},
+				Scores:   tt.scores,
+				Winner:   "a",
+			}
+			changes := ratingChanges(state, map[string]int{"a": defaultEloRating, "b": defaultEloRating})
+
+			var stats models.PlayerStats
+			applyMatchStats(&stats, state, rules.Config(), "a", changes["a"])
+			if stats.Wins != 1 || stats.CurrentStreak != 1 {
+				t.Errorf("wins = %d, streak = %d, want 1, 1", stats.Wins, stats.CurrentStreak)
+			}
+			if stats.HighestScore != tt.score || stats.GameModeStats[tt.mode].BestScore != tt.score {
+				t.Errorf("highest score = %d, best = %d, want %d", stats.HighestScore, stats.GameModeStats[tt.mode].BestScore, tt.score)
+			}
+			if got := eloRating(&stats, tt.mode); got != tt.rating {
+				t.Errorf("rating = %d, want %d", got, tt.rating)
+			}
+		})
+	}
+}
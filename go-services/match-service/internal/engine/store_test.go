@@ -0,0 +1,436 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/database"
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+// errNotStored is what the memory stores return for a missing key or document
+var errNotStored = fmt.Errorf("not stored")
+
+// memoryRedis keeps the Redis data the engine uses in memory. The lease and
+// state scripts are run by name, with the same results as the Lua.
+type memoryRedis struct {
+	database.RedisRepository
+	mutex  sync.Mutex
+	values map[string]string
+	lists  map[string][]string
+	sets   map[string]map[string]bool
+}
+
+func (r *memoryRedis) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	switch v := value.(type) {
+	case string:
+		r.values[key] = v
+	case []byte:
+		r.values[key] = string(v)
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		r.values[key] = string(data)
+	}
+	return nil
+}
+
+func (r *memoryRedis) Get(ctx context.Context, key string) (string, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	value, ok := r.values[key]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", errNotStored, key)
+	}
+	return value, nil
+}
+
+func (r *memoryRedis) GetObject(ctx context.Context, key string, dest interface{}) error {
+	value, err := r.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(value), dest)
+}
+
+func (r *memoryRedis) Delete(ctx context.Context, keys ...string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, key := range keys {
+		delete(r.values, key)
+		delete(r.lists, key)
+		delete(r.sets, key)
+	}
+	return nil
+}
+
+func (r *memoryRedis) Exists(ctx context.Context, keys ...string) (int64, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var count int64
+	for _, key := range keys {
+		if _, ok := r.values[key]; ok {
+			count++
+		} else if len(r.lists[key]) > 0 {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *memoryRedis) LLen(ctx context.Context, key string) (int64, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return int64(len(r.lists[key])), nil
+}
+
+func (r *memoryRedis) LRange(ctx context.Context, key string, start, stop int64) ([]string, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	list := r.lists[key]
+	if stop < 0 || stop >= int64(len(list)) {
+		stop = int64(len(list)) - 1
+	}
+	if start > stop {
+		return []string{}, nil
+	}
+	return append([]string(nil), list[start:stop+1]...), nil
+}
+
+func (r *memoryRedis) SAdd(ctx context.Context, key string, members ...interface{}) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.sets[key] == nil {
+		r.sets[key] = make(map[string]bool)
+	}
+	for _, member := range members {
+		r.sets[key][fmt.Sprint(member)] = true
+	}
+	return nil
+}
+
+func (r *memoryRedis) SRem(ctx context.Context, key string, members ...interface{}) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, member := range members {
+		delete(r.sets[key], fmt.Sprint(member))
+	}
+	return nil
+}
+
+func (r *memoryRedis) SMembers(ctx context.Context, key string) ([]string, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	members := make([]string, 0, len(r.sets[key]))
+	for member := range r.sets[key] {
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+func (r *memoryRedis) SIsMember(ctx context.Context, key string, member interface{}) (bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.sets[key][fmt.Sprint(member)], nil
+}
+
+func (r *memoryRedis) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	holder, held := r.values[keys[0]]
+	caller := fmt.Sprint(args[0])
+	switch script {
+	case acquireLeaseScript:
+		if held && holder != caller {
+			return int64(0), nil
+		}
+		r.values[keys[0]] = caller
+		return int64(1), nil
+	case renewLeaseScript:
+		if held && holder == caller {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	case releaseLeaseScript:
+		if held && holder == caller {
+			delete(r.values, keys[0])
+			return int64(1), nil
+		}
+		return int64(0), nil
+	case storeStateScript:
+		if !held || holder != caller {
+			return int64(0), nil
+		}
+		if stored, _ := args[3].(int64); stored != int64(len(r.lists[keys[2]])) {
+			return int64(-1), nil
+		}
+		r.values[keys[1]] = string(args[1].([]byte))
+		for _, event := range args[4:] {
+			r.lists[keys[2]] = append(r.lists[keys[2]], string(event.([]byte)))
+		}
+		return int64(1), nil
+	}
+	return nil, fmt.Errorf("unknown script")
+}
+
+// memoryFirestore keeps documents in memory, encoded as JSON
+type memoryFirestore struct {
+	database.FirestoreRepository
+	mutex sync.Mutex
+	docs  map[string]map[string][]byte
+}
+
+func (f *memoryFirestore) Create(ctx context.Context, collection, docID string, data interface{}) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if _, exists := f.docs[collection][docID]; exists {
+		return fmt.Errorf("document already exists: %s/%s", collection, docID)
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if f.docs[collection] == nil {
+		f.docs[collection] = make(map[string][]byte)
+	}
+	f.docs[collection][docID] = raw
+	return nil
+}
+
+func (f *memoryFirestore) Get(ctx context.Context, collection, docID string, dest interface{}) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	raw, exists := f.docs[collection][docID]
+	if !exists {
+		return fmt.Errorf("%w: %s/%s", errNotStored, collection, docID)
+	}
+	return json.Unmarshal(raw, dest)
+}
+
+func (f *memoryFirestore) Update(ctx context.Context, collection, docID string, updates map[string]interface{}) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	raw, exists := f.docs[collection][docID]
+	if !exists {
+		return fmt.Errorf("%w: %s/%s", errNotStored, collection, docID)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return err
+	}
+	for field, value := range updates {
+		doc[field] = value
+	}
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	f.docs[collection][docID] = raw
+	return nil
+}
+
+func (f *memoryFirestore) Delete(ctx context.Context, collection, docID string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	delete(f.docs[collection], docID)
+	return nil
+}
+
+func (f *memoryFirestore) Exists(ctx context.Context, collection, docID string) (bool, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	_, exists := f.docs[collection][docID]
+	return exists, nil
+}
+
+// memoryQuery collects the options of a List call. The memory store filters
+// and orders on the fields the engine queries: string arrays and times.
+type memoryQuery struct {
+	filters []memoryFilter
+	orderBy string
+	desc    bool
+	limit   int
+}
+
+// memoryFilter keeps documents whose field holds value (array-contains) or
+// comes before it (<)
+type memoryFilter struct {
+	field string
+	op    string
+	value interface{}
+}
+
+func (f memoryFilter) Apply(query interface{}) interface{} {
+	q := query.(*memoryQuery)
+	q.filters = append(q.filters, f)
+	return q
+}
+
+// memoryOption sets a List call's order or limit
+type memoryOption func(*memoryQuery)
+
+func (o memoryOption) Apply(query interface{}) interface{} {
+	o(query.(*memoryQuery))
+	return query
+}
+
+func (f *memoryFirestore) Where(field string, op string, value interface{}) database.Filter {
+	return memoryFilter{field: field, op: op, value: value}
+}
+
+func (f *memoryFirestore) OrderBy(field string, direction database.Direction) database.QueryOption {
+	return memoryOption(func(q *memoryQuery) {
+		q.orderBy, q.desc = field, direction == database.Desc
+	})
+}
+
+func (f *memoryFirestore) Limit(limit int) database.QueryOption {
+	return memoryOption(func(q *memoryQuery) { q.limit = limit })
+}
+
+func (f *memoryFirestore) List(ctx context.Context, collection string, dest interface{}, opts ...database.QueryOption) error {
+	query := &memoryQuery{}
+	for _, opt := range opts {
+		opt.Apply(query)
+	}
+
+	f.mutex.Lock()
+	type listed struct {
+		raw    json.RawMessage
+		fields map[string]interface{}
+	}
+	docs := make([]listed, 0, len(f.docs[collection]))
+	for _, raw := range f.docs[collection] {
+		var fields map[string]interface{}
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			f.mutex.Unlock()
+			return err
+		}
+		if query.matches(fields) {
+			docs = append(docs, listed{raw: raw, fields: fields})
+		}
+	}
+	f.mutex.Unlock()
+
+	if query.orderBy != "" {
+		sort.Slice(docs, func(i, j int) bool {
+			a, b := fieldTime(docs[i].fields[query.orderBy]), fieldTime(docs[j].fields[query.orderBy])
+			if query.desc {
+				return a.After(b)
+			}
+			return a.Before(b)
+		})
+	}
+	if query.limit > 0 && len(docs) > query.limit {
+		docs = docs[:query.limit]
+	}
+
+	page := make([]json.RawMessage, len(docs))
+	for i, doc := range docs {
+		page[i] = doc.raw
+	}
+	raw, err := json.Marshal(page)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, dest)
+}
+
+// matches reports whether a document passes every filter
+func (q *memoryQuery) matches(fields map[string]interface{}) bool {
+	for _, filter := range q.filters {
+		switch filter.op {
+		case "array-contains":
+			found := false
+			values, _ := fields[filter.field].([]interface{})
+			for _, value := range values {
+				found = found || value == filter.value
+			}
+			if !found {
+				return false
+			}
+		case "<":
+			if !fieldTime(fields[filter.field]).Before(filter.value.(time.Time)) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// fieldTime reads a time stored in a JSON document
+func fieldTime(value interface{}) time.Time {
+	raw, _ := value.(string)
+	at, _ := time.Parse(time.RFC3339Nano, raw)
+	return at
+}
+
+// memoryDB serves the engine's stores from memory. Users have no records, so
+// players play without loaded profiles.
+type memoryDB struct {
+	database.DatabaseManager
+	redis     *memoryRedis
+	firestore *memoryFirestore
+}
+
+func newMemoryDB() *memoryDB {
+	return &memoryDB{
+		redis: &memoryRedis{
+			values: make(map[string]string),
+			lists:  make(map[string][]string),
+			sets:   make(map[string]map[string]bool),
+		},
+		firestore: &memoryFirestore{docs: make(map[string]map[string][]byte)},
+	}
+}
+
+func (db *memoryDB) Redis() database.RedisRepository { return db.redis }
+
+func (db *memoryDB) Firestore() database.FirestoreRepository { return db.firestore }
+
+func (db *memoryDB) StoreMatch(ctx context.Context, match *models.Match) error {
+	return db.firestore.Create(ctx, matchesCollection, match.ID, match)
+}
+
+func (db *memoryDB) GetUser(ctx context.Context, userID string) (*models.User, error) {
+	return nil, fmt.Errorf("%w: user %s", errNotStored, userID)
+}
+
+// newMemoryEngine builds an engine on memory stores that runs no background work
+func newMemoryEngine(db *memoryDB, instanceID string) *GameEngine {
+	return &GameEngine{
+		logger:           zap.NewNop(),
+		dbManager:        db,
+		instanceID:       instanceID,
+		instanceAddr:     instanceID + ":8080",
+		modes:            defaultModeRegistry(),
+		abilities:        defaultAbilityRegistry(),
+		activeMatches:    make(map[string]*ActiveMatch),
+		stopChan:         make(chan bool),
+		acceptingMatches: true,
+	}
+}
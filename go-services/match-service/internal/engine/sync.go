@@ -0,0 +1,214 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+// historyField is the match state field holding the event log. It only ever
+// grows, so it is synced by appending new events instead of diffing.
+const historyField = "actionHistory"
+
+// patchOp is one RFC 6902 JSON Patch operation
+type patchOp struct {
+	Op    string      `json:"op"` // "add", "remove" or "replace"
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// syncDocument is a match state as clients see it, minus the event log, kept
+// as encoded fields so versions can be compared without decoding them
+type syncDocument map[string]json.RawMessage
+
+// syncField is a match state field as it is encoded for clients
+type syncField struct {
+	name      string
+	index     int
+	omitEmpty bool
+}
+
+// syncFields lists the match state's encoded fields, minus the event log
+var syncFields = matchStateFields()
+
+// matchStateFields reads the encoded fields from the match state's JSON tags
+func matchStateFields() []syncField {
+	stateType := reflect.TypeOf(models.MatchState{})
+	fields := make([]syncField, 0, stateType.NumField())
+	for i := 0; i < stateType.NumField(); i++ {
+		field := stateType.Field(i)
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if name == historyField {
+			continue
+		}
+		fields = append(fields, syncField{
+			name:      name,
+			index:     i,
+			omitEmpty: strings.Contains(","+options+",", ",omitempty,"),
+		})
+	}
+	return fields
+}
+
+// newSyncDocument captures the state's fields along with the event log it
+// had at the time
+func newSyncDocument(state *models.MatchState) (syncDocument, []models.GameAction, error) {
+	doc := make(syncDocument, len(syncFields))
+	if err := encodeSyncFields(doc, state, nil); err != nil {
+		return nil, nil, err
+	}
+
+	// Logged events are never changed, so the slice can be shared
+	return doc, state.ActionHistory, nil
+}
+
+// encodeSyncFields encodes the state's fields into a document one by one, so
+// no field is encoded that is not needed. Only the named fields are encoded
+// when only is set.
+func encodeSyncFields(doc syncDocument, state *models.MatchState, only map[string]bool) error {
+	value := reflect.ValueOf(state).Elem()
+	for _, field := range syncFields {
+		if only != nil && !only[field.name] {
+			continue
+		}
+		fieldValue := value.Field(field.index)
+		if field.omitEmpty && isEmptyValue(fieldValue) {
+			delete(doc, field.name)
+			continue
+		}
+		raw, err := json.Marshal(fieldValue.Interface())
+		if err != nil {
+			return fmt.Errorf("failed to encode match state %s: %w", field.name, err)
+		}
+		doc[field.name] = raw
+	}
+	return nil
+}
+
+// isEmptyValue reports whether encoding/json leaves a value out under omitempty
+func isEmptyValue(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return value.Len() == 0
+	case reflect.Bool:
+		return !value.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return value.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return value.Float() == 0
+	case reflect.Interface, reflect.Pointer:
+		return value.IsNil()
+	}
+	return false
+}
+
+// spectatorDocument derives the spectators' view from the players' document,
+// encoding again only the fields spectatorState redacts
+func spectatorDocument(doc syncDocument, state *models.MatchState) (syncDocument, error) {
+	view := make(syncDocument, len(doc))
+	for field, value := range doc {
+		view[field] = value
+	}
+	if err := encodeSyncFields(view, spectatorState(state), spectatorRedactedFields); err != nil {
+		return nil, err
+	}
+	return view, nil
+}
+
+// syncSnapshot is the full state a client starts from
+func syncSnapshot(doc syncDocument, history []models.GameAction) map[string]interface{} {
+	snapshot := make(map[string]interface{}, len(doc)+1)
+	for field, value := range doc {
+		snapshot[field] = value
+	}
+	if history == nil {
+		history = []models.GameAction{}
+	}
+	snapshot[historyField] = history
+	return snapshot
+}
+
+// historySequence is the sequence of the last event in a synced event log,
+// which clients send back as the version their actions were made against
+func historySequence(history []models.GameAction) int64 {
+	if len(history) == 0 {
+		return 0
+	}
+	return history[len(history)-1].Sequence
+}
+
+// syncPatch returns the operations that turn one synced state into the next.
+// Fields are compared two levels deep, which is where per-player and per-turn
+// values change, and anything deeper that changed is replaced whole.
+func syncPatch(from, to syncDocument, fromHistory, toHistory []models.GameAction) []patchOp {
+	ops := diffFields("", from, to, true)
+	for i := len(fromHistory); i < len(toHistory); i++ {
+		ops = append(ops, patchOp{Op: "add", Path: "/" + historyField + "/-", Value: toHistory[i]})
+	}
+	return ops
+}
+
+// diffFields compares two encoded objects field by field, in order so
+// patches are stable
+func diffFields(path string, from, to map[string]json.RawMessage, descend bool) []patchOp {
+	fields := make([]string, 0, len(to))
+	for field := range from {
+		fields = append(fields, field)
+	}
+	for field := range to {
+		if _, ok := from[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	var ops []patchOp
+	for _, field := range fields {
+		child := path + "/" + escapePointer(field)
+		fromValue, inFrom := from[field]
+		toValue, inTo := to[field]
+		switch {
+		case !inTo:
+			ops = append(ops, patchOp{Op: "remove", Path: child})
+		case !inFrom:
+			ops = append(ops, patchOp{Op: "add", Path: child, Value: toValue})
+		case bytes.Equal(fromValue, toValue):
+		case descend && isObject(fromValue) && isObject(toValue):
+			var fromObject, toObject map[string]json.RawMessage
+			if json.Unmarshal(fromValue, &fromObject) == nil && json.Unmarshal(toValue, &toObject) == nil {
+				ops = append(ops, diffFields(child, fromObject, toObject, false)...)
+				continue
+			}
+			ops = append(ops, patchOp{Op: "replace", Path: child, Value: toValue})
+		default:
+			ops = append(ops, patchOp{Op: "replace", Path: child, Value: toValue})
+		}
+	}
+	return ops
+}
+
+// isObject reports whether an encoded value is a JSON object
+func isObject(value json.RawMessage) bool {
+	return len(value) > 0 && value[0] == '{'
+}
+
+// pointerEscaper escapes the characters JSON Pointers reserve (RFC 6901)
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// escapePointer escapes a field name for use in a JSON Pointer
+func escapePointer(field string) string {
+	return pointerEscaper.Replace(field)
+}
@@ -0,0 +1,220 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+// newSyncState builds a mid-match state with a long event log, the shape
+// publishing and persisting have to keep cheap
+func newSyncState(events int) *models.MatchState {
+	joined := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	state := &models.MatchState{
+		ID:       "match",
+		GameMode: models.GameModeClassic,
+		GameType: "quick",
+		Status:   "active",
+		Phase:    models.MatchPhaseActive,
+		Players:  []string{"a", "b"},
+		PlayerData: map[string]models.MatchPlayer{
+			"a": {UserID: "a", DisplayName: "A", IsConnected: true, JoinedAt: joined, Loadout: models.Loadout{Abilities: []string{abilityLuckTurner}}},
+			"b": {UserID: "b", DisplayName: "B", IsConnected: true, JoinedAt: joined, IPAddress: "10.0.0.2"},
+		},
+		CurrentTurn:  "a",
+		TurnNumber:   events / 4,
+		Scores:       map[string]int{"a": 64, "b": 58},
+		Aura:         map[string]int{"a": 3, "b": 5},
+		GameModeData: map[string]interface{}{"target_score": 100},
+		Fairness: &models.FairnessProof{
+			Algorithm:      "hmac-sha256",
+			ServerSeedHash: "hash",
+			ClientSeeds:    map[string]string{"a": "seed-a", "b": "seed-b"},
+		},
+	}
+	for i := 0; i < events; i++ {
+		playerID := state.Players[i%2]
+		appendEvent(state, &models.GameAction{
+			ID:        fmt.Sprintf("event-%d", i),
+			MatchID:   state.ID,
+			PlayerID:  playerID,
+			Type:      "roll_dice",
+			Timestamp: joined.Add(time.Duration(i) * time.Second),
+			Roll:      &models.DiceRoll{PlayerID: playerID, TurnNumber: i / 4, RollIndex: i % 4, Dice1: 3, Dice2: 4, Total: 7},
+		}, &models.GameActionResult{Success: true, ScoreChange: 7})
+	}
+	return state
+}
+
+// roundTripDocument encodes a state the long way, as the hub used to
+func roundTripDocument(t *testing.T, state *models.MatchState) syncDocument {
+	t.Helper()
+	view := *state
+	view.ActionHistory = nil
+	data, err := json.Marshal(&view)
+	if err != nil {
+		t.Fatalf("failed to encode state: %v", err)
+	}
+	var doc syncDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("failed to decode state: %v", err)
+	}
+	delete(doc, historyField)
+	return doc
+}
+
+// assertSameDocument compares two documents field by field
+func assertSameDocument(t *testing.T, got, want syncDocument) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("document has %d fields, want %d", len(got), len(want))
+	}
+	for field, value := range want {
+		if !bytes.Equal(got[field], value) {
+			t.Errorf("%s = %s, want %s", field, got[field], value)
+		}
+	}
+}
+
+func TestNewSyncDocument(t *testing.T) {
+	tests := []struct {
+		name  string
+		state *models.MatchState
+	}{
+		{name: "empty state", state: &models.MatchState{}},
+		{name: "mid-match state", state: newSyncState(12)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, history, err := newSyncDocument(tt.state)
+			if err != nil {
+				t.Fatalf("newSyncDocument() failed: %v", err)
+			}
+			assertSameDocument(t, doc, roundTripDocument(t, tt.state))
+			if len(history) != len(tt.state.ActionHistory) {
+				t.Errorf("history has %d events, want %d", len(history), len(tt.state.ActionHistory))
+			}
+
+			view, err := spectatorDocument(doc, tt.state)
+			if err != nil {
+				t.Fatalf("spectatorDocument() failed: %v", err)
+			}
+			assertSameDocument(t, view, roundTripDocument(t, spectatorState(tt.state)))
+		})
+	}
+}
+
+func TestEncodeStoredState(t *testing.T) {
+	state := newSyncState(12)
+	data, events, err := encodeStoredState(state, 10)
+	if err != nil {
+		t.Fatalf("encodeStoredState() failed: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("encoded %d events, want 2", len(events))
+	}
+
+	var stored models.MatchState
+	if err := json.Unmarshal(data, &stored); err != nil {
+		t.Fatalf("failed to decode stored state: %v", err)
+	}
+	if len(stored.ActionHistory) != 0 || stored.Sequence != state.Sequence {
+		t.Errorf("stored %d inline events at sequence %d, want 0 at %d", len(stored.ActionHistory), stored.Sequence, state.Sequence)
+	}
+
+	if _, _, err := encodeStoredState(state, 13); err == nil {
+		t.Error("encodeStoredState() stored more events than the log holds")
+	}
+}
+
+// benchmarkEvents is the length of log the benchmarks publish and persist
+// from, around a long match's worth
+const benchmarkEvents = 400
+
+// BenchmarkSyncPublish measures one hub publish, capturing the state, diffing
+// it against the last one and encoding the patch, next to sending the whole
+// state as before
+func BenchmarkSyncPublish(b *testing.B) {
+	state := newSyncState(benchmarkEvents)
+	from, fromHistory, _ := newSyncDocument(state)
+	state.Scores["a"] += 7
+	state.TurnScore = 7
+
+	b.Run("patch", func(b *testing.B) {
+		var size int
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			doc, history, err := newSyncDocument(state)
+			if err != nil {
+				b.Fatal(err)
+			}
+			data, err := json.Marshal(syncPatch(from, doc, fromHistory, history))
+			if err != nil {
+				b.Fatal(err)
+			}
+			size = len(data)
+		}
+		b.ReportMetric(float64(size), "bytes/op")
+	})
+	b.Run("full snapshot", func(b *testing.B) {
+		var size int
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			data, err := json.Marshal(state)
+			if err != nil {
+				b.Fatal(err)
+			}
+			size = len(data)
+		}
+		b.ReportMetric(float64(size), "bytes/op")
+	})
+}
+
+// BenchmarkSpectatorDocument measures deriving the spectators' view from the
+// players' document
+func BenchmarkSpectatorDocument(b *testing.B) {
+	state := newSyncState(benchmarkEvents)
+	doc, _, _ := newSyncDocument(state)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := spectatorDocument(doc, state); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkStoredState compares persisting the events one action adds with
+// encoding the whole log
+func BenchmarkStoredState(b *testing.B) {
+	state := newSyncState(benchmarkEvents)
+	for _, bb := range []struct {
+		name   string
+		stored int64
+	}{
+		{name: "new events", stored: int64(len(state.ActionHistory) - 2)},
+		{name: "full log", stored: 0},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			var size int
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				data, events, err := encodeStoredState(state, bb.stored)
+				if err != nil {
+					b.Fatal(err)
+				}
+				size = len(data)
+				for _, event := range events {
+					size += len(event.([]byte))
+				}
+			}
+			b.ReportMetric(float64(size), "bytes/op")
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package engine
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+// newTimeBanks gives every player the same chess clock
+func newTimeBanks(players []string, bank, increment time.Duration) *models.TimeBanks {
+	banks := &models.TimeBanks{
+		RemainingMs: make(map[string]int64, len(players)),
+		IncrementMs: increment.Milliseconds(),
+	}
+	for _, playerID := range players {
+		banks.RemainingMs[playerID] = bank.Milliseconds()
+	}
+	return banks
+}
+
+// chargeTimeBank takes the time the running clock has run up to the given
+// time from its player. Charges are whole wall clock milliseconds, so
+// charging in several steps takes exactly as much as charging once.
+func chargeTimeBank(state *models.MatchState, at time.Time) {
+	banks := state.TimeBanks
+	if banks == nil || banks.Running == "" {
+		return
+	}
+
+	elapsed := at.UnixMilli() - banks.RunningSince.UnixMilli()
+	if elapsed < 0 {
+		return
+	}
+	remaining := banks.RemainingMs[banks.Running] - elapsed
+	if remaining < 0 {
+		remaining = 0
+	}
+	banks.RemainingMs[banks.Running] = remaining
+	banks.RunningSince = at
+}
+
+// stopTimeBank charges the running clock and stops it
+func stopTimeBank(state *models.MatchState, at time.Time) {
+	if state.TimeBanks == nil {
+		return
+	}
+	chargeTimeBank(state, at)
+	state.TimeBanks.Running = ""
+}
+
+// runTimeBank switches the clocks to the current player as of the given
+// time. No clock runs outside active play or while the match is paused.
+func runTimeBank(activeMatch *ActiveMatch, at time.Time) {
+	state := activeMatch.State
+	if state.TimeBanks == nil {
+		return
+	}
+
+	stopTimeBank(state, at)
+	if activeMatch.GamePhase == models.MatchPhaseActive && state.Pause == nil {
+		state.TimeBanks.Running = state.CurrentTurn
+		state.TimeBanks.RunningSince = at
+	}
+}
+
+// addTimeIncrement gives a player the increment they earn for a roll
+func addTimeIncrement(state *models.MatchState, playerID string) {
+	if banks := state.TimeBanks; banks != nil {
+		if _, ok := banks.RemainingMs[playerID]; ok {
+			banks.RemainingMs[playerID] += banks.IncrementMs
+		}
+	}
+}
+
+// flagTime returns when the running clock will run out
+func flagTime(state *models.MatchState) (time.Time, bool) {
+	banks := state.TimeBanks
+	if banks == nil || banks.Running == "" {
+		return time.Time{}, false
+	}
+	remaining := time.Duration(banks.RemainingMs[banks.Running]) * time.Millisecond
+	return banks.RunningSince.Add(remaining), true
+}
+
+// flaggedPlayer returns the first player whose time bank has run out
+func flaggedPlayer(state *models.MatchState) string {
+	if state.TimeBanks == nil {
+		return ""
+	}
+	for _, playerID := range state.Players {
+		if remaining, ok := state.TimeBanks.RemainingMs[playerID]; ok && remaining <= 0 {
+			return playerID
+		}
+	}
+	return ""
+}
+
+// tickTimeBanks brings the running clock up to date so clients can render
+// the clocks, ending the match when a flag falls. It reports whether it did.
+func (ge *GameEngine) tickTimeBanks(activeMatch *ActiveMatch, now time.Time) bool {
+	if flagged := ge.chargeRunningClock(activeMatch, now); flagged != "" {
+		ge.logger.Info("Time bank ran out",
+			zap.String("match_id", activeMatch.Match.ID),
+			zap.String("player_id", flagged))
+		ge.finishMatch(activeMatch, concededMatch(models.WinReasonFlagFall, flagged))
+		return true
+	}
+	return false
+}
+
+// chargeRunningClock charges the running clock up to now and broadcasts the
+// clocks, returning the player whose flag fell, if any
+func (ge *GameEngine) chargeRunningClock(activeMatch *ActiveMatch, now time.Time) string {
+	activeMatch.mutex.Lock()
+	defer activeMatch.mutex.Unlock()
+
+	banks := activeMatch.State.TimeBanks
+	if banks == nil || banks.Running == "" {
+		return ""
+	}
+	chargeTimeBank(activeMatch.State, now)
+	if flagged := flaggedPlayer(activeMatch.State); flagged != "" {
+		return flagged
+	}
+
+	if err := ge.broadcastStateUpdate(activeMatch); err != nil {
+		ge.logger.Warn("Failed to broadcast clocks",
+			zap.String("match_id", activeMatch.Match.ID),
+			zap.Error(err))
+	}
+	return ""
+}
@@ -0,0 +1,90 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+func TestTimeBankTicks(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	state := &models.MatchState{
+		ID:          "match",
+		Players:     []string{"a", "b"},
+		CurrentTurn: "a",
+		TimeBanks:   newTimeBanks([]string{"a", "b"}, 10*time.Second, 2*time.Second),
+	}
+	activeMatch := &ActiveMatch{
+		Match:     &models.Match{ID: "match", Players: state.Players},
+		State:     state,
+		GamePhase: models.MatchPhaseActive,
+		StateChan: make(chan *models.MatchState, 10),
+	}
+	ge := &GameEngine{logger: zap.NewNop()}
+	runTimeBank(activeMatch, start)
+
+	// Ticks a fraction of a millisecond apart charge as much as one tick would
+	for i := 1; i <= 4; i++ {
+		if flagged := ge.chargeRunningClock(activeMatch, start.Add(time.Duration(i)*(time.Second+400*time.Microsecond))); flagged != "" {
+			t.Fatalf("tick %d flagged %s", i, flagged)
+		}
+	}
+	if left := state.TimeBanks.RemainingMs["a"]; left != 5999 {
+		t.Errorf("a has %d ms after 4.0016s, want 5999", left)
+	}
+	if len(activeMatch.StateChan) != 4 {
+		t.Errorf("broadcast %d clock updates, want 4", len(activeMatch.StateChan))
+	}
+
+	// A roll earns the increment, and the turn passes the clock to b
+	addTimeIncrement(state, "a")
+	state.CurrentTurn = "b"
+	runTimeBank(activeMatch, start.Add(5*time.Second))
+	if left := state.TimeBanks.RemainingMs["a"]; left != 7000 {
+		t.Errorf("a has %d ms after the turn, want 7000", left)
+	}
+	ge.chargeRunningClock(activeMatch, start.Add(8*time.Second))
+	if a, b := state.TimeBanks.RemainingMs["a"], state.TimeBanks.RemainingMs["b"]; a != 7000 || b != 7000 {
+		t.Errorf("banks are a %d and b %d ms, want 7000 each", a, b)
+	}
+	if flag, running := flagTime(state); !running || !flag.Equal(start.Add(15*time.Second)) {
+		t.Errorf("flag falls at %v, want %v", flag, start.Add(15*time.Second))
+	}
+
+	// b's flag falls on the first tick past the bank, which stops at zero
+	if flagged := ge.chargeRunningClock(activeMatch, start.Add(14*time.Second)); flagged != "" {
+		t.Fatalf("flag fell for %s with 1s left", flagged)
+	}
+	if flagged := ge.chargeRunningClock(activeMatch, start.Add(16*time.Second)); flagged != "b" {
+		t.Fatalf("flag fell for %q, want b", flagged)
+	}
+	if left := state.TimeBanks.RemainingMs["b"]; left != 0 {
+		t.Errorf("b has %d ms after the flag fell, want 0", left)
+	}
+}
+
+func TestTimeBankStopsOutsidePlay(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	state := &models.MatchState{
+		Players:     []string{"a", "b"},
+		CurrentTurn: "a",
+		TimeBanks:   newTimeBanks([]string{"a", "b"}, 10*time.Second, 0),
+		Pause:       &models.MatchPause{PausedAt: start},
+	}
+	activeMatch := &ActiveMatch{State: state, GamePhase: models.MatchPhaseActive}
+
+	runTimeBank(activeMatch, start)
+	if _, running := flagTime(state); running {
+		t.Error("clock runs while the match is paused")
+	}
+
+	state.Pause = nil
+	activeMatch.GamePhase = models.MatchPhaseTurnDecider
+	runTimeBank(activeMatch, start)
+	if _, running := flagTime(state); running {
+		t.Error("clock runs during the turn decider")
+	}
+}
@@ -0,0 +1,215 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+// DoubleEffect describes what rolling a specific double does
+type DoubleEffect struct {
+	ScoreBonus      int `json:"scoreBonus"`
+	Multiplier      int `json:"multiplier"`
+	OpponentPenalty int `json:"opponentPenalty"`
+}
+
+// defaultZeroHourDoubles is the per-double effects table, keyed by die face.
+// Snake eyes is worth a flat 20, every other double is worth its total.
+var defaultZeroHourDoubles = map[int]DoubleEffect{
+	1: {ScoreBonus: 20, Multiplier: 2, OpponentPenalty: 20},
+	2: {ScoreBonus: 4, Multiplier: 2, OpponentPenalty: 4},
+	3: {ScoreBonus: 6, Multiplier: 2, OpponentPenalty: 6},
+	4: {ScoreBonus: 8, Multiplier: 2, OpponentPenalty: 8},
+	5: {ScoreBonus: 10, Multiplier: 2, OpponentPenalty: 10},
+	6: {ScoreBonus: 12, Multiplier: 2, OpponentPenalty: 12},
+}
+
+// zeroHourRules counts down from the starting score to exactly zero
+type zeroHourRules struct {
+	config  ModeConfig
+	doubles map[int]DoubleEffect
+}
+
+func newZeroHourRules(config ModeConfig) (GameModeRules, error) {
+	var settings zeroHourSettings
+	if err := decodeSettings(config.Settings, &settings); err != nil {
+		return nil, err
+	}
+	return &zeroHourRules{
+		config:  config,
+		doubles: mergeDoubleEffects(defaultZeroHourDoubles, settings.DoublesEffects),
+	}, nil
+}
+
+// mergeDoubleEffects overlays a "doublesEffects" setting on a default effects table.
+// The setting uses the frontend's "double1".."double6" keys.
+func mergeDoubleEffects(defaults map[int]DoubleEffect, overrides map[string]DoubleEffect) map[int]DoubleEffect {
+	doubles := make(map[int]DoubleEffect, len(defaults))
+	for face, effect := range defaults {
+		doubles[face] = effect
+	}
+
+	for face := 1; face <= 6; face++ {
+		if effect, ok := overrides[fmt.Sprintf("double%d", face)]; ok {
+			doubles[face] = effect
+		}
+	}
+	return doubles
+}
+
+// Config returns the mode configuration
+func (zr *zeroHourRules) Config() ModeConfig {
+	return zr.config
+}
+
+// Initialize starts every player at the countdown score
+func (zr *zeroHourRules) Initialize(activeMatch *ActiveMatch) error {
+	activeMatch.State.Status = "active"
+	activeMatch.State.Settings.WinCondition = zr.config.TargetScore
+	activeMatch.State.Settings.MaxTurns = zr.config.MaxTurns
+
+	activeMatch.State.GameModeData = map[string]interface{}{
+		"starting_score": zr.config.StartingScore,
+		"target_score":   zr.config.TargetScore,
+		"exact_landing":  true,
+	}
+
+	for _, playerID := range activeMatch.State.Players {
+		activeMatch.State.Scores[playerID] = zr.config.StartingScore
+	}
+
+	return nil
+}
+
+// ProcessRoll applies Zero Hour scoring: doubles bank points for the roller,
+// push every opponent back up and raise the turn multiplier
+func (zr *zeroHourRules) ProcessRoll(state *models.MatchState, roll *models.DiceRoll) *models.GameActionResult {
+	playerID := roll.PlayerID
+	if state.Multipliers == nil {
+		state.Multipliers = make(map[string]int)
+	}
+	multiplier := turnMultiplier(state, playerID)
+
+	result := &models.GameActionResult{
+		Success: true,
+		Data:    make(map[string]interface{}),
+		Dice1:   roll.Dice1,
+		Dice2:   roll.Dice2,
+		Total:   roll.Total,
+	}
+
+	switch {
+	case isSingleOne(roll):
+		result.Message = "Single 1 rolled, turn score lost"
+		result.SpecialEffect = "bust"
+		result.ScoreChange = -state.TurnScore
+		state.TurnScore = 0
+		result.TurnOver = true
+
+	case roll.IsDouble:
+		effect := zr.doubles[roll.Dice1]
+		state.TurnScore += effect.ScoreBonus
+
+		// Each further double this turn steps the multiplier up
+		next := effect.Multiplier
+		if multiplier > 1 && multiplier+1 > next {
+			next = multiplier + 1
+		}
+		if next > 1 {
+			state.Multipliers[playerID] = next
+		}
+
+		penalties := make(map[string]int)
+		if effect.OpponentPenalty > 0 {
+			for _, opponentID := range state.Players {
+				if opponentID == playerID {
+					continue
+				}
+				state.Scores[opponentID] += effect.OpponentPenalty
+				penalties[opponentID] = effect.OpponentPenalty
+			}
+		}
+
+		result.Message = fmt.Sprintf("Double %ds rolled", roll.Dice1)
+		result.SpecialEffect = fmt.Sprintf("double_%d", roll.Dice1)
+		if isSnakeEyes(roll) {
+			result.SpecialEffect = "snake_eyes"
+		}
+		result.BonusPoints = effect.ScoreBonus
+		result.ScoreChange = effect.ScoreBonus
+		result.Data["opponentPenalties"] = penalties
+
+	default:
+		result.Message = "Roll added to turn score"
+		result.ScoreChange = roll.Total * multiplier
+		state.TurnScore += roll.Total * multiplier
+	}
+
+	roll.Multiplier = turnMultiplier(state, playerID)
+	roll.BonusPoints = result.BonusPoints
+	roll.SpecialEffect = result.SpecialEffect
+
+	result.Multiplier = roll.Multiplier
+	result.NewScore = state.Scores[playerID]
+	result.Data["turnScore"] = state.TurnScore
+
+	return result
+}
+
+// ProcessBank subtracts the turn score, which must not overshoot zero.
+// An overshoot leaves the score untouched and resets the turn score and multiplier.
+func (zr *zeroHourRules) ProcessBank(state *models.MatchState, playerID string) *models.GameActionResult {
+	banked := state.TurnScore
+	proposed := state.Scores[playerID] - banked
+
+	if proposed < zr.config.TargetScore {
+		overshoot := zr.config.TargetScore - proposed
+		state.TurnScore = 0
+		delete(state.Multipliers, playerID)
+
+		return &models.GameActionResult{
+			Success:       true,
+			Message:       fmt.Sprintf("Banking %d would overshoot zero, turn score reset", banked),
+			Data:          map[string]interface{}{"banked": 0, "overshoot": overshoot},
+			ScoreChange:   0,
+			NewScore:      state.Scores[playerID],
+			SpecialEffect: "overshoot",
+		}
+	}
+
+	state.Scores[playerID] = proposed
+	state.TurnScore = 0
+
+	return &models.GameActionResult{
+		Success:     true,
+		Message:     fmt.Sprintf("Banked %d points", banked),
+		Data:        map[string]interface{}{"banked": banked},
+		ScoreChange: -banked,
+		NewScore:    proposed,
+		TurnOver:    true,
+	}
+}
+
+// TimeoutAction banks for a player whose clock ran out when the bank lands on
+// or short of zero, and otherwise ends their turn. Rolling for them could bust
+// a turn they meant to bank, and an overshooting bank would throw it away.
+func (zr *zeroHourRules) TimeoutAction(state *models.MatchState, turnOver bool) string {
+	playerID := state.CurrentTurn
+	if state.TurnScore > 0 && state.Scores[playerID]-state.TurnScore >= zr.config.TargetScore {
+		return "bank"
+	}
+	return "end_turn"
+}
+
+// CheckWin finishes the match when a player lands exactly on the target
+func (zr *zeroHourRules) CheckWin(state *models.MatchState) (string, bool) {
+	for _, playerID := range state.Players {
+		if state.Scores[playerID] == zr.config.TargetScore {
+			return playerID, true
+		}
+	}
+	return "", false
+}
+
+// OnTurnEnd has no Zero Hour specific behaviour
+func (zr *zeroHourRules) OnTurnEnd(state *models.MatchState, playerID string) {}
@@ -0,0 +1,132 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/LukeAtkinz/dashdice/go-services/shared/models"
+)
+
+func TestZeroHourBank(t *testing.T) {
+	tests := []struct {
+		name      string
+		score     int
+		turnScore int
+		want      int
+		turnOver  bool
+		winner    string
+		finished  bool
+	}{
+		{name: "bank short of zero", score: 100, turnScore: 43, want: 57, turnOver: true},
+		{name: "exact landing wins", score: 57, turnScore: 57, want: 0, turnOver: true, winner: "a", finished: true},
+		{name: "overshoot resets the turn", score: 57, turnScore: 60, want: 57},
+		{name: "overshoot by one", score: 1, turnScore: 2, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, state := newModeMatch(t, models.GameModeZeroHour, nil, "a", "b")
+			state.Scores["a"] = tt.score
+			state.TurnScore = tt.turnScore
+			state.Multipliers["a"] = 2
+
+			result := rules.ProcessBank(state, "a")
+			if state.Scores["a"] != tt.want {
+				t.Errorf("score = %d, want %d", state.Scores["a"], tt.want)
+			}
+			if result.TurnOver != tt.turnOver {
+				t.Errorf("TurnOver = %v, want %v", result.TurnOver, tt.turnOver)
+			}
+			if state.TurnScore != 0 {
+				t.Errorf("turn score = %d, want 0", state.TurnScore)
+			}
+			if !tt.turnOver && turnMultiplier(state, "a") != 1 {
+				t.Errorf("multiplier = %d after an overshoot, want 1", turnMultiplier(state, "a"))
+			}
+
+			winner, finished := rules.CheckWin(state)
+			if winner != tt.winner || finished != tt.finished {
+				t.Errorf("CheckWin() = %q, %v, want %q, %v", winner, finished, tt.winner, tt.finished)
+			}
+		})
+	}
+}
+
+func TestZeroHourRoll(t *testing.T) {
+	tests := []struct {
+		name         string
+		dice         [2]int
+		multiplier   int
+		turnScore    int
+		opponent     int
+		wantMultiple int
+	}{
+		{name: "plain roll", dice: [2]int{2, 4}, turnScore: 6, opponent: 100, wantMultiple: 1},
+		{name: "plain roll under a multiplier", dice: [2]int{2, 4}, multiplier: 3, turnScore: 18, opponent: 100, wantMultiple: 3},
+		{name: "double pushes opponents back", dice: [2]int{3, 3}, turnScore: 6, opponent: 106, wantMultiple: 2},
+		{name: "further double steps the multiplier", dice: [2]int{5, 5}, multiplier: 2, turnScore: 10, opponent: 110, wantMultiple: 3},
+		{name: "snake eyes", dice: [2]int{1, 1}, turnScore: 20, opponent: 120, wantMultiple: 2},
+		{name: "single one busts", dice: [2]int{1, 5}, turnScore: 0, opponent: 100, wantMultiple: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, state := newModeMatch(t, models.GameModeZeroHour, nil, "a", "b")
+			if tt.multiplier > 1 {
+				state.Multipliers["a"] = tt.multiplier
+			}
+
+			rules.ProcessRoll(state, &models.DiceRoll{
+				PlayerID: "a",
+				Dice1:    tt.dice[0],
+				Dice2:    tt.dice[1],
+				Total:    tt.dice[0] + tt.dice[1],
+				IsDouble: tt.dice[0] == tt.dice[1],
+			})
+			if state.TurnScore != tt.turnScore {
+				t.Errorf("turn score = %d, want %d", state.TurnScore, tt.turnScore)
+			}
+			if state.Scores["b"] != tt.opponent {
+				t.Errorf("opponent score = %d, want %d", state.Scores["b"], tt.opponent)
+			}
+			if got := turnMultiplier(state, "a"); got != tt.wantMultiple {
+				t.Errorf("multiplier = %d, want %d", got, tt.wantMultiple)
+			}
+			if _, finished := rules.CheckWin(state); finished {
+				t.Error("rolling finished the match")
+			}
+		})
+	}
+}
+
+func TestZeroHourTimeout(t *testing.T) {
+	tests := []struct {
+		name      string
+		score     int
+		turnScore int
+		turnOver  bool
+		want      string
+	}{
+		{name: "nothing to bank", score: 100, turnScore: 0, want: "end_turn"},
+		{name: "bank short of zero", score: 100, turnScore: 43, want: "bank"},
+		{name: "bank lands on zero", score: 43, turnScore: 43, want: "bank"},
+		{name: "bank would overshoot", score: 20, turnScore: 43, want: "end_turn"},
+		{name: "turn over with a safe bank", score: 100, turnScore: 43, turnOver: true, want: "bank"},
+		{name: "turn over with an overshoot", score: 20, turnScore: 43, turnOver: true, want: "end_turn"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, state := newModeMatch(t, models.GameModeZeroHour, nil, "a", "b")
+			state.Scores["a"] = tt.score
+			state.TurnScore = tt.turnScore
+
+			policy, ok := rules.(TimeoutRules)
+			if !ok {
+				t.Fatal("Zero Hour has no timeout policy")
+			}
+			if got := policy.TimeoutAction(state, tt.turnOver); got != tt.want {
+				t.Errorf("TimeoutAction() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
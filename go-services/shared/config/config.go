@@ -63,6 +63,10 @@ type Config struct {
 	MatchServiceAddr    string
 	QueueServiceAddr    string
 	APIGatewayAddr      string
+
+	// Replica identity, for services that run more than one instance
+	InstanceID   string
+	InstanceAddr string
 }
 
 // LoadConfig loads configuration from environment variables
@@ -125,6 +129,11 @@ func LoadConfig() (*Config, error) {
 		APIGatewayAddr:      getEnv("API_GATEWAY_ADDR", "api-gateway:8080"),
 	}
 
+	// Replicas are told apart by hostname unless configured otherwise
+	hostname, _ := os.Hostname()
+	config.InstanceID = getEnv("INSTANCE_ID", hostname)
+	config.InstanceAddr = getEnv("INSTANCE_ADDR", fmt.Sprintf("%s:%s", hostname, config.Port))
+
 	// Validate required configuration
 	if err := config.Validate(); err != nil {
 		return nil, fmt.Errorf("configuration validation failed: %w", err)
@@ -3,6 +3,7 @@ package database
 import (
 	"context"
 	"fmt"
+	"reflect"
 	"time"
 	
 	"cloud.google.com/go/firestore"
@@ -380,9 +381,35 @@ func (f *FirestoreClient) ListenDocument(ctx context.Context, collection, docID
 
 // Helper functions
 
+// documentsToSlice decodes documents into the slice dest points to, whose
+// elements may be structs, maps or pointers to either
 func (f *FirestoreClient) documentsToSlice(docs []*firestore.DocumentSnapshot, dest interface{}) error {
-	// Implementation would depend on reflection to convert docs to proper slice type
-	// This is a simplified version - in production you'd want proper type conversion
+	target := reflect.ValueOf(dest)
+	if target.Kind() != reflect.Ptr || target.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("destination must be a pointer to a slice, got %T", dest)
+	}
+	
+	sliceType := target.Elem().Type()
+	elemType := sliceType.Elem()
+	items := reflect.MakeSlice(sliceType, 0, len(docs))
+	for _, doc := range docs {
+		if elemType.Kind() == reflect.Ptr {
+			item := reflect.New(elemType.Elem())
+			if err := doc.DataTo(item.Interface()); err != nil {
+				return fmt.Errorf("failed to decode document %s: %w", doc.Ref.ID, err)
+			}
+			items = reflect.Append(items, item)
+			continue
+		}
+		
+		item := reflect.New(elemType)
+		if err := doc.DataTo(item.Interface()); err != nil {
+			return fmt.Errorf("failed to decode document %s: %w", doc.Ref.ID, err)
+		}
+		items = reflect.Append(items, item.Elem())
+	}
+	
+	target.Elem().Set(items)
 	return nil
 }
 
@@ -2,6 +2,7 @@ package database
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"time"
 	
@@ -491,7 +492,11 @@ func (dm *DatabaseManagerImpl) StoreMatch(ctx context.Context, match *models.Mat
 // UpdateMatchState updates match state in Redis
 func (dm *DatabaseManagerImpl) UpdateMatchState(ctx context.Context, matchID string, state *models.MatchState) error {
 	key := fmt.Sprintf("match_state:%s", matchID)
-	if err := dm.redis.Set(ctx, key, state, time.Hour); err != nil {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode match state: %w", err)
+	}
+	if err := dm.redis.Set(ctx, key, data, time.Hour); err != nil {
 		return fmt.Errorf("failed to update match state: %w", err)
 	}
 	return nil
@@ -2,6 +2,7 @@ package errors
 
 import (
 	"encoding/json"
+	stderrors "errors"
 	"fmt"
 	"net/http"
 	"runtime"
@@ -429,7 +430,7 @@ func logError(c *gin.Context, err *AppError) {
 // IsType checks if an error is of a specific type
 func IsType(err error, errType string) bool {
 	var appErr *AppError
-	if errors.As(err, &appErr) {
+	if stderrors.As(err, &appErr) {
 		return appErr.Type == errType
 	}
 	return false
@@ -438,7 +439,7 @@ func IsType(err error, errType string) bool {
 // IsClientError checks if an error is a client error (4xx)
 func IsClientError(err error) bool {
 	var appErr *AppError
-	if errors.As(err, &appErr) {
+	if stderrors.As(err, &appErr) {
 		return appErr.StatusCode >= 400 && appErr.StatusCode < 500
 	}
 	return false
@@ -447,7 +448,7 @@ func IsClientError(err error) bool {
 // IsServerError checks if an error is a server error (5xx)
 func IsServerError(err error) bool {
 	var appErr *AppError
-	if errors.As(err, &appErr) {
+	if stderrors.As(err, &appErr) {
 		return appErr.StatusCode >= 500
 	}
 	return false
@@ -456,7 +457,7 @@ func IsServerError(err error) bool {
 // GetStatusCode extracts the HTTP status code from an error
 func GetStatusCode(err error) int {
 	var appErr *AppError
-	if errors.As(err, &appErr) {
+	if stderrors.As(err, &appErr) {
 		return appErr.StatusCode
 	}
 	return http.StatusInternalServerError
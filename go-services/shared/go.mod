@@ -6,6 +6,7 @@ require (
 	cloud.google.com/go/firestore v1.13.0
 	firebase.google.com/go/v4 v4.12.0
 	github.com/gin-gonic/gin v1.9.1
+	github.com/stretchr/testify v1.9.0
 	go.uber.org/zap v1.25.0
 	google.golang.org/api v0.126.0
 	google.golang.org/grpc v1.56.2
@@ -6,10 +6,14 @@ import (
 
 // Game mode constants
 const (
+	GameModeQuickfire  = "quickfire"
 	GameModeClassic    = "classic"
 	GameModeBlitz      = "blitz"
 	GameModeTournament = "tournament"
 	GameModeCustom     = "custom"
+	GameModeZeroHour   = "zero-hour"
+	GameModeLastLine   = "last-line"
+	GameModeTrueGrit   = "true-grit"
 )
 
 // Match represents a simplified match record for database operations
@@ -19,6 +23,7 @@ type Match struct {
 	Players     []string          `json:"players" firestore:"players"`
 	PlayerIDs   []string          `json:"playerIds" firestore:"playerIds"`
 	GameMode    string            `json:"gameMode" firestore:"gameMode"`
+	GameType    string            `json:"gameType,omitempty" firestore:"gameType"` // "quick", "ranked", "tournament", "lobby"
 	Region      string            `json:"region,omitempty" firestore:"region"`
 	CreatedAt   time.Time         `json:"createdAt" firestore:"createdAt"`
 	UpdatedAt   time.Time         `json:"updatedAt" firestore:"updatedAt"`
@@ -26,6 +31,9 @@ type Match struct {
 	Winner      string            `json:"winner,omitempty" firestore:"winner"`
 	Scores      map[string]int    `json:"scores" firestore:"scores"`
 	Settings    map[string]interface{} `json:"settings,omitempty" firestore:"settings"`
+	ClientSeeds map[string]string `json:"clientSeeds,omitempty" firestore:"clientSeeds"`
+	Loadouts    map[string][]string `json:"loadouts,omitempty" firestore:"loadouts"`
+	Bots        map[string]string   `json:"bots,omitempty" firestore:"bots"` // bot difficulty by player
 }
 
 // MatchState represents the complete state of an active match
@@ -34,25 +42,49 @@ type MatchState struct {
 	GameMode    string    `json:"gameMode" redis:"gameMode"`
 	GameType    string    `json:"gameType" redis:"gameType"` // "quick", "ranked", "tournament"
 	Status      string    `json:"status" redis:"status"`     // "waiting", "active", "paused", "completed", "abandoned"
+	Phase       string    `json:"phase" redis:"phase"`       // "setup", "turn_decider", "active", "completed"
 	
 	// Players
 	Players     []string  `json:"players" redis:"players"`
 	PlayerData  map[string]MatchPlayer `json:"playerData" redis:"playerData"`
 	
+	// Pre-game odd/even pick that decides who starts
+	TurnDecider *TurnDecider `json:"turnDecider,omitempty" redis:"turnDecider"`
+	
+	// Deadline of the decision the current player faces
+	TurnClock   *TurnClock   `json:"turnClock,omitempty" redis:"turnClock"`
+	
+	// Chess clocks, for modes where each player has a time bank
+	TimeBanks   *TimeBanks   `json:"timeBanks,omitempty" redis:"timeBanks"`
+	
+	// Set while play is halted for disconnected players
+	Pause       *MatchPause  `json:"pause,omitempty" redis:"pause"`
+	
 	// Game state
 	CurrentTurn string    `json:"currentTurn" redis:"currentTurn"`
 	TurnNumber  int       `json:"turnNumber" redis:"turnNumber"`
 	Scores      map[string]int `json:"scores" redis:"scores"`
 	TurnScore   int       `json:"turnScore" redis:"turnScore"`
 	
+	// AURA balances spent on abilities
+	Aura        map[string]int `json:"aura" redis:"aura"`
+	
+	// Abilities used per player and effects still in force
+	AbilityUses   map[string]map[string]int `json:"abilityUses,omitempty" redis:"abilityUses"`
+	ActiveEffects []ActiveEffect            `json:"activeEffects,omitempty" redis:"activeEffects"`
+	
 	// Last action
 	LastRoll    *DiceRoll `json:"lastRoll,omitempty" redis:"lastRoll"`
 	LastAction  *GameAction `json:"lastAction,omitempty" redis:"lastAction"`
+	LastResult  *GameActionResult `json:"lastResult,omitempty" redis:"lastResult"`
 	
 	// Game mode specific data
 	GameModeData map[string]interface{} `json:"gameModeData" redis:"gameModeData"`
 	Multipliers  map[string]int        `json:"multipliers,omitempty" redis:"multipliers"`
 	
+	// Provably fair dice commitment
+	Fairness    *FairnessProof `json:"fairness,omitempty" redis:"fairness"`
+	
 	// Match metadata
 	Region      string    `json:"region" redis:"region"`
 	CreatedAt   time.Time `json:"createdAt" redis:"createdAt"`
@@ -66,15 +98,71 @@ type MatchState struct {
 	// Real-time tracking
 	ConnectedPlayers []string `json:"connectedPlayers" redis:"connectedPlayers"`
 	Spectators      []string `json:"spectators,omitempty" redis:"spectators"`
+	SpectatorCount  int      `json:"spectatorCount" redis:"spectatorCount"`
 	
-	// Match history for recovery
+	// Match history for recovery: every applied action in sequence order.
+	// Replaying it from the create_match event rebuilds the state.
 	ActionHistory []GameAction `json:"actionHistory" redis:"actionHistory"`
+	Sequence      int64        `json:"sequence" redis:"sequence"` // Sequence number of the last event
 	
 	// Winner information
 	Winner      string `json:"winner,omitempty" redis:"winner"`
 	WinReason   string `json:"winReason,omitempty" redis:"winReason"`
 }
 
+// Match phase constants
+const (
+	MatchPhaseSetup       = "setup"
+	MatchPhaseTurnDecider = "turn_decider"
+	MatchPhaseActive      = "active"
+	MatchPhaseCompleted   = "completed"
+)
+
+// Match outcome constants, recorded as the WinReason of an ended match
+const (
+	WinReasonVictory   = "victory"   // A player met the mode's win condition
+	WinReasonSurrender = "surrender" // A player conceded
+	WinReasonForfeit   = "forfeit"   // A player ran out of reconnect grace
+	WinReasonAbandoned = "abandoned" // A player let too many turns in a row time out
+	WinReasonFlagFall  = "flag_fall" // A player's time bank ran out
+	WinReasonDraw      = "draw"      // The turn limit was reached, or the leaders tied
+	WinReasonVoid      = "void"      // No contest, counted for no one
+)
+
+// TurnDecider represents the pre-game pick: the chooser calls odd or even,
+// a die is rolled, and a correct call means the chooser starts
+type TurnDecider struct {
+	ChooserID  string    `json:"chooserId"`
+	Choice     string    `json:"choice,omitempty"` // "odd" or "even"
+	AutoPicked bool      `json:"autoPicked,omitempty"`
+	Roll       int       `json:"roll,omitempty"`
+	StarterID  string    `json:"starterId,omitempty"`
+	Deadline   time.Time `json:"deadline"`
+}
+
+// TurnClock times the decision the current player faces. Each decision has its
+// own limit, and none may run past the end of the turn.
+type TurnClock struct {
+	Decision   string    `json:"decision"`             // "choose_parity", "roll" when the player must roll, "bank" when they may bank
+	Deadline   time.Time `json:"deadline"`             // When the engine decides for the player
+	TurnEndsAt time.Time `json:"turnEndsAt,omitempty"` // When the whole turn is up
+}
+
+// TimeBanks are per-player chess clocks. Only the current player's clock runs,
+// and each roll they make adds the increment back.
+type TimeBanks struct {
+	RemainingMs  map[string]int64 `json:"remainingMs"`
+	IncrementMs  int64            `json:"incrementMs"`
+	Running      string           `json:"running,omitempty"` // Player whose clock is running
+	RunningSince time.Time        `json:"runningSince"`      // When the running clock was last charged
+}
+
+// MatchPause records a match halted until its disconnected players return
+type MatchPause struct {
+	PausedAt       time.Time `json:"pausedAt"`
+	TurnTimeLeftMs int64     `json:"turnTimeLeftMs"` // Turn clock left when play stopped, restored on resume
+}
+
 // MatchPlayer represents a player in a match
 type MatchPlayer struct {
 	UserID      string    `json:"userId"`
@@ -85,9 +173,25 @@ type MatchPlayer struct {
 	JoinedAt    time.Time `json:"joinedAt"`
 	LastSeen    time.Time `json:"lastSeen"`
 	
+	// Reconnect grace, spent while the player is disconnected
+	DisconnectedAt    *time.Time `json:"disconnectedAt,omitempty"`
+	ReconnectDeadline *time.Time `json:"reconnectDeadline,omitempty"` // Player forfeits unless back by then
+	ReconnectGraceMs  int64      `json:"reconnectGraceMs"`            // Grace left for the rest of the match
+	
+	// Turns in a row the player let time out
+	ConsecutiveTimeouts int      `json:"consecutiveTimeouts"`
+	
 	// Player state
 	IsReady     bool      `json:"isReady"`
 	IsSpectator bool      `json:"isSpectator"`
+	SpectatingDisabled bool `json:"spectatingDisabled,omitempty"` // Player opted out of being watched
+	
+	// Seats played by the engine rather than a person
+	IsBot         bool   `json:"isBot,omitempty"`
+	BotDifficulty string `json:"botDifficulty,omitempty"`
+	
+	// Abilities equipped for the match, fixed at creation
+	Loadout     Loadout   `json:"loadout"`
 	
 	// Connection info
 	ConnectionQuality string `json:"connectionQuality"`
@@ -95,13 +199,22 @@ type MatchPlayer struct {
 	UserAgent        string `json:"userAgent,omitempty"`
 }
 
+// Loadout represents the abilities a player brings into a match
+type Loadout struct {
+	Abilities  []string `json:"abilities"`
+	StarCost   int      `json:"starCost"`
+	StarBudget int      `json:"starBudget"`
+}
+
 // MatchSettings represents configurable match settings
 type MatchSettings struct {
 	TimeLimit         int    `json:"timeLimit"`         // Time limit per turn in seconds
 	MaxTurns          int    `json:"maxTurns"`          // Maximum turns before draw
 	AllowReconnect    bool   `json:"allowReconnect"`    // Allow players to reconnect
 	SpectatorMode     bool   `json:"spectatorMode"`     // Allow spectators
+	SpectatorDelay    int    `json:"spectatorDelay"`    // Seconds the spectator feed lags behind play
 	PauseOnDisconnect bool   `json:"pauseOnDisconnect"` // Pause match when player disconnects
+	ReconnectGracePeriod int `json:"reconnectGracePeriod"` // Seconds each player may spend disconnected per match
 	
 	// Game mode specific settings
 	WinCondition      int    `json:"winCondition"`      // Points needed to win (varies by mode)
@@ -118,27 +231,78 @@ type DiceRoll struct {
 	IsDouble  bool      `json:"isDouble"`
 	Timestamp time.Time `json:"timestamp"`
 	
+	// Position of the roll in the provably fair stream
+	TurnNumber int `json:"turnNumber"`
+	RollIndex  int `json:"rollIndex"`
+	
+	// Face weights when an ability modified the dice for this roll
+	Weights []float64 `json:"weights,omitempty"`
+	
 	// Game mode specific data
 	Multiplier    int    `json:"multiplier,omitempty"`
 	BonusPoints   int    `json:"bonusPoints,omitempty"`
 	SpecialEffect string `json:"specialEffect,omitempty"`
 }
 
+// ActiveEffect is an ability effect still in force
+type ActiveEffect struct {
+	AbilityID      string `json:"abilityId"`
+	PlayerID       string `json:"playerId"`                 // Player who used the ability
+	RollsRemaining int    `json:"rollsRemaining,omitempty"` // Rolls left before the effect wears off
+	TurnNumber     int    `json:"turnNumber,omitempty"`     // Turn the effect is limited to, 0 if it spans turns
+}
+
+// FairnessAlgorithmHMACSHA256 derives each roll from HMAC-SHA256(serverSeed, clientSeeds:turn:rollIndex:block)
+const FairnessAlgorithmHMACSHA256 = "hmac-sha256"
+
+// FairnessProof holds the commit-reveal data players use to verify dice rolls
+type FairnessProof struct {
+	Algorithm      string            `json:"algorithm"`
+	ServerSeedHash string            `json:"serverSeedHash"`       // SHA-256 of the server seed, committed at creation
+	ServerSeed     string            `json:"serverSeed,omitempty"` // Revealed when the match ends
+	ClientSeeds    map[string]string `json:"clientSeeds"`          // Player supplied seeds, mixed in seating order
+	DiceWeights    [6]float64        `json:"diceWeights"`          // Per-face weights of the match dice
+}
+
 // GameAction represents any action taken in the game
 type GameAction struct {
 	ID        string                 `json:"id"`
+	Sequence  int64                  `json:"sequence,omitempty"` // Position in the match event log, set once applied
 	MatchID   string                 `json:"matchId"`
 	PlayerID  string                 `json:"playerId"`
-	Type      string                 `json:"type"` // "roll", "bank", "pass", "timeout", "disconnect", "reconnect"
+	Type      string                 `json:"type"` // "roll", "bank", "pass", "use_ability", "timeout", "disconnect", "reconnect"
 	Data      map[string]interface{} `json:"data"`
 	Timestamp time.Time              `json:"timestamp"`
 	
+	// State sequence the client made this action against; 0 skips the check
+	ExpectedVersion int64 `json:"expectedVersion,omitempty"`
+	
 	// Result of the action
 	Success   bool   `json:"success"`
 	Error     string `json:"error,omitempty"`
 	
+	// Dice rolled by this action
+	Roll      *DiceRoll `json:"roll,omitempty"`
+	
+	// AURA credited or spent by this action
+	AuraTransactions []AuraTransaction `json:"auraTransactions,omitempty"`
+	
 	// State changes caused by this action
 	StateChanges map[string]interface{} `json:"stateChanges,omitempty"`
+	
+	// Outcome the engine settled for this action
+	Result *GameActionResult `json:"result,omitempty"`
+}
+
+// AuraTransaction records a single AURA credit or spend
+type AuraTransaction struct {
+	PlayerID   string    `json:"playerId"`
+	Amount     int       `json:"amount"`           // Positive for credits, negative for spends
+	Reason     string    `json:"reason"`           // "roll", "double", "snake_eyes", "ability", ...
+	Source     string    `json:"source,omitempty"` // Ability or player the AURA came from
+	Balance    int       `json:"balance"`          // Balance after the transaction
+	TurnNumber int       `json:"turnNumber"`
+	Timestamp  time.Time `json:"timestamp"`
 }
 
 // GameActionResult represents the result of a game action
@@ -42,11 +42,20 @@ type User struct {
 	BanReason   string `json:"banReason,omitempty" firestore:"banReason,omitempty"`
 }
 
+// UserProgression represents a user's level and ability unlocks
+type UserProgression struct {
+	UserID            string   `json:"userId" firestore:"userId"`
+	Level             int      `json:"level" firestore:"level"`
+	XP                int      `json:"xp" firestore:"xp"`
+	UnlockedAbilities []string `json:"unlockedAbilities" firestore:"unlockedAbilities"`
+}
+
 // PlayerStats represents player game statistics
 type PlayerStats struct {
 	TotalMatches     int                    `json:"totalMatches" firestore:"totalMatches"`
 	Wins            int                    `json:"wins" firestore:"wins"`
 	Losses          int                    `json:"losses" firestore:"losses"`
+	Draws           int                    `json:"draws" firestore:"draws"`
 	WinRate         float64               `json:"winRate" firestore:"winRate"`
 	TotalScore      int64                 `json:"totalScore" firestore:"totalScore"`
 	HighestScore    int                   `json:"highestScore" firestore:"highestScore"`
@@ -71,6 +80,7 @@ type GameModeStats struct {
 	Matches       int     `json:"matches"`
 	Wins         int     `json:"wins"`
 	Losses       int     `json:"losses"`
+	Draws        int     `json:"draws"`
 	WinRate      float64 `json:"winRate"`
 	BestScore    int     `json:"bestScore"`
 	AverageScore float64 `json:"averageScore"`
@@ -90,6 +100,7 @@ type UserPreferences struct {
 	// Privacy settings
 	ShowOnlineStatus    bool              `json:"showOnlineStatus" firestore:"showOnlineStatus"`
 	AllowFriendRequests bool              `json:"allowFriendRequests" firestore:"allowFriendRequests"`
+	DisableSpectating   bool              `json:"disableSpectating" firestore:"disableSpectating"`
 	
 	// Matchmaking preferences
 	MatchmakingPrefs    MatchmakingPreferences `json:"matchmakingPrefs" firestore:"matchmakingPrefs"`
@@ -145,6 +145,7 @@ func (rb *RequestBuilder) WithHeader(key, value string) *RequestBuilder {
 // WithAuth adds authorization header
 func (rb *RequestBuilder) WithAuth(token string) *RequestBuilder {
 	rb.headers["Authorization"] = "Bearer " + token
+	return rb
 }
 
 // WithJSON sets content type to JSON
@@ -262,34 +263,28 @@ type UserFactory struct{}
 // CreateUser creates a test user
 func (uf *UserFactory) CreateUser(options ...func(*models.User)) *models.User {
 	user := &models.User{
-		ID:          "test-user-" + generateID(),
+		UID:         "test-user-" + generateID(),
 		Email:       "test@example.com",
-		Username:    "testuser",
 		DisplayName: "Test User",
-		Bio:         "Test bio",
-		Stats: &models.UserStats{
-			GamesPlayed:    10,
-			GamesWon:       7,
-			WinRate:        70.0,
-			CurrentStreak:  3,
-			LongestStreak:  5,
-			ELORating:      1500,
-			Rank:           "Intermediate",
-			TotalScore:     1000,
+		Stats: models.PlayerStats{
+			TotalMatches:  10,
+			Wins:          7,
+			Losses:        3,
+			WinRate:       70.0,
+			CurrentStreak: 3,
+			BestStreak:    5,
+			TotalScore:    1000,
+			EloRatings:    map[string]int{models.GameModeClassic: 1500},
 		},
-		Preferences: &models.UserPreferences{
-			Theme:           "dark",
-			SoundEnabled:    true,
-			MusicEnabled:    true,
+		Preferences: models.UserPreferences{
+			Theme:                "dark",
+			SoundEnabled:         true,
 			NotificationsEnabled: true,
-			Language:        "en",
-		},
-		Privacy: &models.UserPrivacy{
-			ProfilePublic:    true,
-			StatsPublic:      true,
-			OnlineStatus:     true,
-			FriendRequests:   "everyone",
+			Language:             "en",
+			ShowOnlineStatus:     true,
+			AllowFriendRequests:  true,
 		},
+		IsActive:  true,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
@@ -309,20 +304,20 @@ func WithEmail(email string) func(*models.User) {
 	}
 }
 
-// WithUsername sets username
+// WithUsername sets the name the user is shown by
 func WithUsername(username string) func(*models.User) {
 	return func(u *models.User) {
-		u.Username = username
+		u.DisplayName = username
 	}
 }
 
-// WithELO sets ELO rating
+// WithELO sets the classic ELO rating
 func WithELO(elo int) func(*models.User) {
 	return func(u *models.User) {
-		if u.Stats == nil {
-			u.Stats = &models.UserStats{}
+		if u.Stats.EloRatings == nil {
+			u.Stats.EloRatings = make(map[string]int)
 		}
-		u.Stats.ELORating = elo
+		u.Stats.EloRatings[models.GameModeClassic] = elo
 	}
 }
 
@@ -335,14 +330,11 @@ func (mf *MatchFactory) CreateMatch(options ...func(*models.Match)) *models.Matc
 		ID:       "test-match-" + generateID(),
 		GameMode: "classic",
 		Status:   "waiting",
-		Players:  make([]models.Player, 0),
-		Settings: &models.MatchSettings{
-			MaxPlayers:      4,
-			IsPrivate:       false,
-			TurnTimeLimit:   60,
-			DiceCount:       2,
-			DiceSides:       6,
-			TargetScore:     100,
+		Players:  make([]string, 0),
+		Scores:   make(map[string]int),
+		Settings: map[string]interface{}{
+			"max_players":  4,
+			"target_score": 100,
 		},
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
@@ -373,17 +365,12 @@ func WithStatus(status string) func(*models.Match) {
 // WithPlayers adds players to match
 func WithPlayers(count int) func(*models.Match) {
 	return func(m *models.Match) {
-		m.Players = make([]models.Player, count)
+		m.Players = make([]string, count)
 		for i := 0; i < count; i++ {
-			m.Players[i] = models.Player{
-				UserID:      fmt.Sprintf("player-%d", i+1),
-				DisplayName: fmt.Sprintf("Player %d", i+1),
-				Position:    i,
-				Score:       0,
-				IsReady:     true,
-				JoinedAt:    time.Now(),
-			}
+			m.Players[i] = fmt.Sprintf("player-%d", i+1)
+			m.Scores[m.Players[i]] = 0
 		}
+		m.PlayerIDs = m.Players
 	}
 }
 
@@ -397,8 +384,8 @@ func (nf *NotificationFactory) CreateNotification(options ...func(*models.Notifi
 		UserID:  "test-user",
 		Type:    "system",
 		Title:   "Test Notification",
-		Message: "This is a test notification",
-		Read:    false,
+		Body:    "This is a test notification",
+		Status:  "pending",
 		CreatedAt: time.Now(),
 	}
 	
@@ -435,16 +422,12 @@ func WithUserID(userID string) func(*models.Notification) {
 
 // AssertUser asserts user properties
 func AssertUser(t *testing.T, expected, actual *models.User) {
-	assert.Equal(t, expected.ID, actual.ID)
+	assert.Equal(t, expected.UID, actual.UID)
 	assert.Equal(t, expected.Email, actual.Email)
-	assert.Equal(t, expected.Username, actual.Username)
 	assert.Equal(t, expected.DisplayName, actual.DisplayName)
-	
-	if expected.Stats != nil && actual.Stats != nil {
-		assert.Equal(t, expected.Stats.ELORating, actual.Stats.ELORating)
-		assert.Equal(t, expected.Stats.GamesPlayed, actual.Stats.GamesPlayed)
-		assert.Equal(t, expected.Stats.GamesWon, actual.Stats.GamesWon)
-	}
+	assert.Equal(t, expected.Stats.EloRatings, actual.Stats.EloRatings)
+	assert.Equal(t, expected.Stats.TotalMatches, actual.Stats.TotalMatches)
+	assert.Equal(t, expected.Stats.Wins, actual.Stats.Wins)
 }
 
 // AssertMatch asserts match properties
@@ -455,8 +438,8 @@ func AssertMatch(t *testing.T, expected, actual *models.Match) {
 	assert.Len(t, actual.Players, len(expected.Players))
 	
 	if expected.Settings != nil && actual.Settings != nil {
-		assert.Equal(t, expected.Settings.MaxPlayers, actual.Settings.MaxPlayers)
-		assert.Equal(t, expected.Settings.TargetScore, actual.Settings.TargetScore)
+		assert.Equal(t, expected.Settings["max_players"], actual.Settings["max_players"])
+		assert.Equal(t, expected.Settings["target_score"], actual.Settings["target_score"])
 	}
 }
 
@@ -466,7 +449,7 @@ func AssertNotification(t *testing.T, expected, actual *models.Notification) {
 	assert.Equal(t, expected.UserID, actual.UserID)
 	assert.Equal(t, expected.Type, actual.Type)
 	assert.Equal(t, expected.Title, actual.Title)
-	assert.Equal(t, expected.Message, actual.Message)
+	assert.Equal(t, expected.Body, actual.Body)
 }
 
 // AssertError asserts error properties